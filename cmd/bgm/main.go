@@ -7,21 +7,35 @@ import (
 	"math/rand"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"gopkg.in/ini.v1"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/control/client"
+	"github.com/synrais/SAM-GO/pkg/mister"
+	"github.com/synrais/SAM-GO/pkg/service"
 )
 
+var logger = service.Component("bgm")
+
 const (
 	MUSIC_FOLDER   = "/media/fat/music"
 	BOOT_FOLDER    = MUSIC_FOLDER + "/boot"
 	INI_FILE       = MUSIC_FOLDER + "/bgm.ini"
-	LOG_FILE       = "/tmp/bgm.log"
 	HISTORY_RATIO  = 0.2
 	MIDI_PORT      = "128:0"
+	CORE_POLL      = time.Second
+	// tracks which end quicker than this probably didn't play, and the
+	// next one waits a bit longer each time up to MAX_RETRY_DELAY
+	MIN_TRACK_TIME  = time.Second
+	MAX_RETRY_DELAY = 30 * time.Second
 )
 
 var CONFIG_DEFAULTS = map[string]interface{}{
@@ -99,21 +113,6 @@ func getConfig() Config {
 	}
 }
 
-func logMsg(msg string, always bool) {
-	cfg := getConfig()
-	if msg == "" {
-		return
-	}
-	if always || cfg.Debug {
-		fmt.Println(msg)
-	}
-	if cfg.Debug {
-		f, _ := os.OpenFile(LOG_FILE, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		defer f.Close()
-		f.WriteString(fmt.Sprintf("[%s] %s\n", time.Now().Format(time.RFC3339), msg))
-	}
-}
-
 func isValidFile(name string) bool {
 	l := strings.ToLower(name)
 	if strings.HasSuffix(l, ".mp3") ||
@@ -144,6 +143,10 @@ type Player struct {
 	Playing  string
 	Playlist *string
 	Playback string
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	skipped bool
 }
 
 func (p *Player) addHistory(track string, total int) {
@@ -161,11 +164,25 @@ func (p *Player) playFile(cmd ...string) {
 	c := exec.Command(cmd[0], cmd[1:]...)
 	stdout, _ := c.StdoutPipe()
 	c.Stderr = c.Stdout
-	_ = c.Start()
+	if err := c.Start(); err != nil {
+		logger.Error("failed to start %s: %s", cmd[0], err)
+		return
+	}
+
+	p.mu.Lock()
+	p.cmd = c
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.cmd = nil
+		p.mu.Unlock()
+	}()
 
 	scanner := bufio.NewScanner(stdout)
 	for scanner.Scan() {
-		logMsg(scanner.Text(), false)
+		if line := scanner.Text(); line != "" {
+			logger.Debug("%s", line)
+		}
 	}
 	c.Wait()
 }
@@ -174,12 +191,15 @@ func (p *Player) Play(track string) {
 	if !isValidFile(track) {
 		return
 	}
+	p.mu.Lock()
 	p.Playing = track
+	p.skipped = false
+	p.mu.Unlock()
 	p.addHistory(track, 100) // placeholder for total track count
 	loops := getLoopAmount(track)
-	logMsg("Now playing: "+track, true)
+	logger.Info("now playing: %s", track)
 
-	for loops > 0 {
+	for loops > 0 && !p.isSkipped() {
 		if strings.HasSuffix(strings.ToLower(track), ".mp3") ||
 			strings.HasSuffix(strings.ToLower(track), ".pls") {
 			p.playFile("mpg123", "--no-control", track)
@@ -195,7 +215,28 @@ func (p *Player) Play(track string) {
 		loops--
 	}
 
+	p.mu.Lock()
 	p.Playing = ""
+	p.mu.Unlock()
+}
+
+// Skip stops the current track, including any loops left of it.
+func (p *Player) Skip() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Playing == "" {
+		return
+	}
+	p.skipped = true
+	if p.cmd != nil && p.cmd.Process != nil {
+		_ = p.cmd.Process.Kill()
+	}
+}
+
+func (p *Player) isSkipped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.skipped
 }
 
 func getTracks(playlist *string) []string {
@@ -224,6 +265,10 @@ func (p *Player) getRandomTrack() string {
 	}
 	for {
 		track := tracks[rand.Intn(len(tracks))]
+		if len(tracks) <= len(p.History) {
+			// nothing left that hasn't played recently
+			return track
+		}
 		// avoid repeats
 		found := false
 		for _, h := range p.History {
@@ -238,10 +283,88 @@ func (p *Player) getRandomTrack() string {
 	}
 }
 
+// activeCore asks the SAM service what's running, or reads it from MiSTer
+// directly if the service isn't running.
+func activeCore() string {
+	if playing, err := client.NowPlaying(); err == nil {
+		return playing.Core
+	}
+	data, err := os.ReadFile(config.CoreNameFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func inMenu(core string) bool {
+	return core == "" || core == config.MenuCore
+}
+
+func setVolume(level int) {
+	if level < 0 {
+		return
+	}
+	if err := mister.SetVolume(level); err != nil {
+		logger.Error("failed to set volume: %s", err)
+	}
+}
+
+// watchCores ducks the music when a core starts: the volume goes to
+// defaultvolume and, unless playincore is set, the track stops until the
+// menu is back. menuvolume is set again on the way back.
+func (p *Player) watchCores(cfg Config, menu chan<- bool) {
+	wasMenu := true
+	for {
+		isMenu := inMenu(activeCore())
+		if isMenu != wasMenu {
+			if isMenu {
+				logger.Debug("back in the menu")
+				setVolume(cfg.MenuVolume)
+			} else {
+				logger.Debug("core started")
+				setVolume(cfg.DefaultVolume)
+				if !cfg.PlayInCore {
+					p.Skip()
+				}
+			}
+			wasMenu = isMenu
+		}
+		select {
+		case menu <- isMenu:
+		default:
+		}
+		time.Sleep(CORE_POLL)
+	}
+}
+
+func writePid() (func(), error) {
+	pidFile := fmt.Sprintf(config.PidFileTemplate, "bgm")
+	if err := os.WriteFile(pidFile, []byte(fmt.Sprintf("%d", os.Getpid())), 0644); err != nil {
+		return nil, err
+	}
+	return func() { _ = os.Remove(pidFile) }, nil
+}
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 	cfg := getConfig()
 
+	// the config is only read once, debug decides what goes to the log
+	bgmLogger := service.NewLogger("bgm")
+	bgmLogger.SetConsole(os.Stdout)
+	if cfg.Debug {
+		bgmLogger.SetLevel(service.LevelDebug)
+	}
+	service.SetDefault(bgmLogger)
+
+	// the SAM service skips tracks by pid
+	removePid, err := writePid()
+	if err != nil {
+		logger.Error("failed to write pid file: %s", err)
+		return
+	}
+	defer removePid()
+
 	player := Player{
 		Playlist: cfg.Playlist,
 		Playback: cfg.Playback,
@@ -249,13 +372,55 @@ func main() {
 
 	tracks := getTracks(player.Playlist)
 	if len(tracks) == 0 {
-		logMsg("No music files found in "+MUSIC_FOLDER, true)
+		logger.Info("no music files found in %s", MUSIC_FOLDER)
 		return
 	}
 
-	// Just play one random track for now
-	track := player.getRandomTrack()
-	if track != "" {
-		player.Play(track)
-	}
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	next := make(chan os.Signal, 1)
+	signal.Notify(next, syscall.SIGUSR1)
+
+	go func() {
+		for range next {
+			logger.Debug("skipping track")
+			player.Skip()
+		}
+	}()
+
+	menu := make(chan bool)
+	go player.watchCores(cfg, menu)
+	setVolume(cfg.MenuVolume)
+
+	go func() {
+		var delay time.Duration
+		for {
+			if !cfg.PlayInCore {
+				for !<-menu {
+				}
+			}
+			started := time.Now()
+			if track := player.getRandomTrack(); track != "" {
+				player.Play(track)
+			}
+
+			// a missing player or a bad file ends straight away, don't
+			// spin through the playlist retrying it
+			if time.Since(started) >= MIN_TRACK_TIME || player.isSkipped() {
+				delay = 0
+				continue
+			}
+			delay *= 2
+			if delay == 0 {
+				delay = CORE_POLL
+			} else if delay > MAX_RETRY_DELAY {
+				delay = MAX_RETRY_DELAY
+			}
+			logger.Debug("track ended early, waiting %s", delay)
+			time.Sleep(delay)
+		}
+	}()
+
+	<-quit
+	player.Skip()
 }
@@ -15,11 +15,13 @@ import (
 	gc "github.com/rthornton128/goncurses"
 
 	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/control/client"
 	"github.com/synrais/SAM-GO/pkg/curses"
 	"github.com/synrais/SAM-GO/pkg/games"
 	"github.com/synrais/SAM-GO/pkg/gamesdb"
 	"github.com/synrais/SAM-GO/pkg/mister"
 	"github.com/synrais/SAM-GO/pkg/attract"
+	"github.com/synrais/SAM-GO/pkg/service"
 )
 
 // -------------------------
@@ -155,6 +157,8 @@ func optionsMenu(cfg *config.UserConfig, stdscr *gc.Window, files []MenuFile) ([
 	}, []string{
 		"Rebuild games database...",
 		"Start Attract Mode",
+		"Generate M3U playlists",
+		"Edit MiSTer.ini video settings...",
 	})
 	if err != nil {
 		return nil, err
@@ -167,16 +171,271 @@ func optionsMenu(cfg *config.UserConfig, stdscr *gc.Window, files []MenuFile) ([
 		case 0:
 			return generateIndexWindow(cfg, stdscr)
 		case 1:
+			if client.Running() {
+				// attract mode runs in the service, the menu hands over
+				// to it and closes
+				err := client.StartAttract()
+				if err == nil {
+					err = client.ResumeAttract()
+				}
+				if err != nil {
+					_ = curses.InfoBox(stdscr, "Error",
+						fmt.Sprintf("Failed to start attract mode: %v", err), false, true)
+					break
+				}
+				gc.End()
+				os.Exit(0)
+			}
 			gc.End()
 			if err := attract.StartAttractMode(cfg, files); err != nil {
 				_ = curses.InfoBox(stdscr, "Error",
 					fmt.Sprintf("Failed to start attract mode: %v", err), false, true)
 			}
+		case 2:
+			written, err := gamesdb.GenerateM3Us(files)
+			if err != nil {
+				_ = curses.InfoBox(stdscr, "Error",
+					fmt.Sprintf("Failed to write playlists: %v", err), false, true)
+			} else {
+				_ = curses.InfoBox(stdscr, "M3U Playlists",
+					fmt.Sprintf("Wrote %d playlists, rebuild the database to use them.", written), false, true)
+			}
+		case 3:
+			if err := iniEditor(stdscr); err != nil {
+				_ = curses.InfoBox(stdscr, "Error",
+					fmt.Sprintf("Failed to edit MiSTer.ini: %v", err), false, true)
+			}
 		}
 	}
 	return nil, nil
 }
 
+// -------------------------
+// MiSTer.ini Editor
+// -------------------------
+
+// iniEditor changes video settings in a MiSTer.ini, in [MiSTer] or a core
+// section. Nothing is written until the changes are reviewed and saved.
+func iniEditor(stdscr *gc.Window) error {
+	inis, err := mister.GetAllWithDefaultMisterIni()
+	if err != nil {
+		return err
+	}
+
+	mi := inis[0]
+	if len(inis) > 1 {
+		var names []string
+		for _, i := range inis {
+			names = append(names, i.DisplayName)
+		}
+		button, selected, err := curses.ListPicker(stdscr, curses.ListPickerOpts{
+			Title:         "MiSTer.ini",
+			Buttons:       []string{"Select", "Back"},
+			DefaultButton: 0,
+			ActionButton:  0,
+			Width:         60,
+			Height:        10,
+		}, names)
+		if err != nil || button != 0 {
+			return err
+		}
+		mi = inis[selected]
+	}
+
+	if err := mi.Load(); err != nil {
+		return err
+	}
+
+	const newSection = "New core section..."
+	index := 0
+	for {
+		stdscr.Clear()
+		stdscr.Refresh()
+
+		sections := mi.Sections()
+		items := make([]string, 0, len(sections)+1)
+		for _, name := range sections {
+			items = append(items, "["+name+"]")
+		}
+		items = append(items, newSection)
+
+		button, selected, err := curses.ListPicker(stdscr, curses.ListPickerOpts{
+			Title:         mi.DisplayName,
+			Buttons:       []string{"Select", "Save", "Back"},
+			DefaultButton: 0,
+			ActionButton:  0,
+			Width:         60,
+			Height:        16,
+			InitialIndex:  index,
+		}, items)
+		if err != nil {
+			return err
+		}
+		index = selected
+
+		switch button {
+		case 0:
+			section := items[selected]
+			if section == newSection {
+				button, name, err := curses.OnScreenKeyboard(stdscr, "Core Name", []string{"OK", "Back"}, "", 0)
+				if err != nil {
+					return err
+				}
+				name = strings.TrimSpace(name)
+				if button != 0 || name == "" {
+					continue
+				}
+				section = name
+			} else {
+				section = sections[selected]
+			}
+			if err := iniSectionEditor(stdscr, &mi, section); err != nil {
+				return err
+			}
+		case 1:
+			saved, err := iniSaveChanges(stdscr, &mi)
+			if err != nil || saved {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// iniSectionEditor lists the video keys in one section and lets them be
+// changed, one at a time.
+func iniSectionEditor(stdscr *gc.Window, mi *mister.MisterIni, section string) error {
+	index := 0
+	for {
+		stdscr.Clear()
+		stdscr.Refresh()
+
+		var items []string
+		for _, key := range mister.VideoIniKeys {
+			value, err := mi.GetSectionKey(section, key)
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				value = "-"
+			}
+			items = append(items, fmt.Sprintf("%-28s %s", key, value))
+		}
+
+		button, selected, err := curses.ListPicker(stdscr, curses.ListPickerOpts{
+			Title:         "[" + section + "]",
+			Buttons:       []string{"PgUp", "PgDn", "Change", "Back"},
+			DefaultButton: 2,
+			ActionButton:  2,
+			Width:         60,
+			Height:        20,
+			InitialIndex:  index,
+		}, items)
+		if err != nil || button != 2 {
+			return err
+		}
+		index = selected
+
+		key := mister.VideoIniKeys[selected]
+		current, err := mi.GetSectionKey(section, key)
+		if err != nil {
+			return err
+		}
+		value, ok, err := pickIniValue(stdscr, key, current)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := mi.SetSectionKey(section, key, value); err != nil {
+			stdscr.Clear()
+			stdscr.Refresh()
+			_ = curses.InfoBox(stdscr, "Invalid Value", err.Error(), false, true)
+		}
+	}
+}
+
+// pickIniValue picks a new value for a key from the values it accepts. The
+// first choice unsets the key.
+func pickIniValue(stdscr *gc.Window, key string, current string) (string, bool, error) {
+	const unset = "(not set)"
+
+	choices := mister.IniValueChoices(key)
+	if len(choices) == 0 {
+		button, value, err := curses.OnScreenKeyboard(stdscr, key, []string{"OK", "Back"}, current, 0)
+		return strings.TrimSpace(value), err == nil && button == 0, err
+	}
+
+	items := append([]string{unset}, choices...)
+	index := 0
+	for i, choice := range choices {
+		if strings.EqualFold(choice, current) {
+			index = i + 1
+		}
+	}
+
+	stdscr.Clear()
+	stdscr.Refresh()
+	button, selected, err := curses.ListPicker(stdscr, curses.ListPickerOpts{
+		Title:         key,
+		Buttons:       []string{"PgUp", "PgDn", "Set", "Back"},
+		DefaultButton: 2,
+		ActionButton:  2,
+		Width:         60,
+		Height:        16,
+		InitialIndex:  index,
+	}, items)
+	if err != nil || button != 2 {
+		return "", false, err
+	}
+	if selected == 0 {
+		return "", true, nil
+	}
+	return items[selected], true, nil
+}
+
+// iniSaveChanges shows what will change in the file and saves it if that's
+// confirmed. It reports whether the file was saved.
+func iniSaveChanges(stdscr *gc.Window, mi *mister.MisterIni) (bool, error) {
+	changes, err := mi.Diff()
+	if err != nil {
+		return false, err
+	}
+
+	stdscr.Clear()
+	stdscr.Refresh()
+	if len(changes) == 0 {
+		_ = curses.InfoBox(stdscr, "Save", "No changes to save.", false, true)
+		return false, nil
+	}
+
+	var items []string
+	for _, change := range changes {
+		items = append(items, change.String())
+	}
+	button, _, err := curses.ListPicker(stdscr, curses.ListPickerOpts{
+		Title:         "Save Changes?",
+		Buttons:       []string{"Save", "Back"},
+		DefaultButton: 1,
+		ActionButton:  0,
+		Width:         70,
+		Height:        16,
+	}, items)
+	if err != nil || button != 0 {
+		return false, err
+	}
+
+	if err := mi.Save(); err != nil {
+		return false, err
+	}
+	stdscr.Clear()
+	stdscr.Refresh()
+	_ = curses.InfoBox(stdscr, "Save", "Saved, changes apply when a core loads.", false, true)
+	return true, nil
+}
+
 // -------------------------
 // Tree Navigation
 // -------------------------
@@ -277,8 +536,9 @@ func browseNode(cfg *config.UserConfig, stdscr *gc.Window, node *Node, startInde
 				currentIndex = childIdx
 			} else {
 				file := node.Files[selected-len(folders)]
-				sys, _ := games.GetSystem(file.SystemId)
-				_ = mister.LaunchGame(cfg, *sys, file.Path)
+				if err := launchMenuFile(cfg, stdscr, file.SystemId, file.Path); err != nil {
+					return currentIndex, err
+				}
 				stdscr.Clear()
 				stdscr.Refresh()
 			}
@@ -290,6 +550,74 @@ func browseNode(cfg *config.UserConfig, stdscr *gc.Window, node *Node, startInde
 	}
 }
 
+// -------------------------
+// Launching
+// -------------------------
+
+// launchMenuFile launches a game with the system it was indexed under,
+// unless detection thinks it could just as well be for another system, in
+// which case the user picks one.
+func launchMenuFile(cfg *config.UserConfig, stdscr *gc.Window, systemId string, path string) error {
+	sys, err := games.GetSystem(systemId)
+	if err != nil {
+		return err
+	}
+
+	detection, err := games.DetectSystem(cfg, path)
+	if err == nil && !detection.Confident() {
+		chosen, ok, err := pickSystem(stdscr, detection, *sys)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		sys = &chosen
+	}
+
+	// through the service, which stops attract mode rather than have it
+	// carry on once the menu closes
+	if client.Running() {
+		_ = client.Launch(path, sys.Id)
+		return nil
+	}
+	_ = mister.LaunchGame(cfg, *sys, path)
+	return nil
+}
+
+// pickSystem asks which system to launch a game with. The indexed system is
+// listed first, then the other candidates from best to worst.
+func pickSystem(stdscr *gc.Window, detection games.Detection, indexed games.System) (games.System, bool, error) {
+	systems := []games.System{indexed}
+	for _, c := range detection {
+		if c.System.Id != indexed.Id {
+			systems = append(systems, c.System)
+		}
+	}
+
+	var items []string
+	for _, sys := range systems {
+		items = append(items, sys.Name)
+	}
+
+	stdscr.Clear()
+	stdscr.Refresh()
+	button, selected, err := curses.ListPicker(stdscr, curses.ListPickerOpts{
+		Title:         "Launch With",
+		Buttons:       []string{"PgUp", "PgDn", "Launch", "Back"},
+		ActionButton:  2,
+		DefaultButton: 2,
+		Width:         70,
+		Height:        12,
+	}, items)
+	stdscr.Clear()
+	stdscr.Refresh()
+	if err != nil || button != 2 {
+		return games.System{}, false, err
+	}
+	return systems[selected], true, nil
+}
+
 // -------------------------
 // Main Menu
 // -------------------------
@@ -466,8 +794,9 @@ func searchWindow(cfg *config.UserConfig, stdscr *gc.Window) error {
 			startIndex = selected
 			if button == 2 {
 				game := results[selected]
-				sys, _ := games.GetSystem(game.SystemId)
-				_ = mister.LaunchGame(cfg, *sys, game.Path)
+				if err := launchMenuFile(cfg, stdscr, game.SystemId, game.Path); err != nil {
+					return err
+				}
 				stdscr.Clear()
 				stdscr.Refresh()
 			} else if button == 3 {
@@ -557,6 +886,11 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// logging to the terminal would draw over the menu
+	logger := service.NewLogger("gamesmenu")
+	_ = logger.Configure(cfg.Logging)
+	service.SetDefault(logger)
+
 	stdscr, err := curses.Setup()
 	if err != nil {
 		log.Fatal(err)
@@ -565,8 +899,13 @@ func main() {
 
 	gc.Cursor(0)
 
-	files, err := loadingWindow(stdscr, loadMenuDb)
-	if err != nil {
+	// games the downloader fetched since the last index would be missing
+	var files []MenuFile
+	newer, _ := mister.DownloadedSinceIndex()
+	if !newer {
+		files, err = loadingWindow(stdscr, loadMenuDb)
+	}
+	if newer || err != nil {
 		files, err = generateIndexWindow(cfg, stdscr)
 		if err != nil {
 			log.Fatal(err)
@@ -574,6 +913,11 @@ func main() {
 	}
 
 	if launchGame {
+		// attract mode in the service waits on its current game while
+		// the menu is open
+		if paused, _ := client.PauseAttract(); paused {
+			defer client.ResumeAttract()
+		}
 		if err := mainMenu(cfg, stdscr, files); err != nil {
 			log.Fatal(err)
 		}
@@ -8,23 +8,17 @@ import (
 	"time"
 
 	"github.com/synrais/SAM-GO/pkg/assets"
+	"github.com/synrais/SAM-GO/pkg/mister"
 )
 
 const (
-	playerDir            = "/tmp/mrext-mplayer"
-	menuCore             = "/media/fat/menu.rbf"
-	misterCmdDevice      = "/dev/MiSTer_cmd"
-	samvideoDisplayWait  = 2 * time.Second // adjust if needed
-	defaultResolution    = "640 480"       // fallback resolution
+	playerDir           = "/tmp/mrext-mplayer"
+	menuCore            = "/media/fat/menu.rbf"
+	samvideoDisplayWait = 2 * time.Second // adjust if needed
+	defaultWidth        = 640             // fallback resolution
+	defaultHeight       = 480
 )
 
-func runCmd(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
 func setupPlayer() error {
 	if err := os.MkdirAll(playerDir, 0755); err != nil {
 		return err
@@ -34,16 +28,12 @@ func setupPlayer() error {
 
 // tell MiSTer to load the menu core
 func loadMenuCore() error {
-	cmd := exec.Command("sh", "-c", fmt.Sprintf("echo load_core %s > %s", menuCore, misterCmdDevice))
-	return cmd.Run()
+	return mister.GetCommander().LoadCore(menuCore)
 }
 
-// set resolution via vmode
-func setResolution(resSpace string) error {
-	if resSpace == "" {
-		resSpace = defaultResolution
-	}
-	return runCmd("vmode", "-r", resSpace, "rgb32")
+// set the menu core's framebuffer resolution
+func setResolution(width, height int) error {
+	return mister.SetVideoMode(width, height)
 }
 
 // run mplayer with nice -n -20 and LD_LIBRARY_PATH
@@ -85,7 +75,7 @@ func main() {
 	time.Sleep(samvideoDisplayWait)
 
 	// Set resolution (for now static, later detect like SAM does)
-	if err := setResolution(defaultResolution); err != nil {
+	if err := setResolution(defaultWidth, defaultHeight); err != nil {
 		fmt.Println("warning: failed to set resolution:", err)
 	}
 
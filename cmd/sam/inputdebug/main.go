@@ -8,13 +8,24 @@ import "C"
 import (
 	"bufio"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/input"
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
 )
 
+const mapStepTimeout = 10 * time.Second
+
 // Matches C struct input_event from <linux/input.h>
 type inputEvent struct {
 	Sec   int64
@@ -136,7 +147,87 @@ func readDevice(dev InputDevice, wg *sync.WaitGroup) {
 	}
 }
 
-func main() {
+// record writes the normalized event stream to a file until interrupted.
+func record(path string) {
+	cfg, err := config.LoadINI()
+	if err != nil {
+		fmt.Println("[WARN] Using default input settings:", err)
+		cfg = nil
+	}
+
+	rec, err := input.NewRecorder(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	events := make(chan input.Event, 100)
+	input.RelayInputs(cfg, events)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	fmt.Printf("Recording to %s, press Ctrl+C to stop.\n", path)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				fmt.Println("Input devices stopped.")
+				if err := rec.Close(); err != nil {
+					fmt.Println("Error:", err)
+				}
+				os.Exit(1)
+			}
+			fmt.Printf("[REC] %s: %s\n", ev.Device, ev.Name)
+			if err := rec.Record(ev); err != nil {
+				fmt.Println("[ERROR]", err)
+			}
+		case <-sig:
+			if err := rec.Close(); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+}
+
+// replay plays a recording back through virtual uinput devices.
+func replay(path string, speed float64) {
+	events, err := input.LoadRecording(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	kbd, err := virtualinput.NewKeyboard(virtualinput.DefaultTimeout)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	defer kbd.Close()
+
+	gpd, err := virtualinput.NewGamepad(virtualinput.DefaultTimeout)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	defer gpd.Close()
+
+	injector := input.UinputInjector{Keyboard: &kbd, Gamepad: &gpd}
+	fmt.Printf("Replaying %d events from %s\n", len(events), path)
+	err = input.Replay(events, speed, func(ev input.Event) error {
+		fmt.Printf("[PLAY] %s: %s\n", ev.Device, ev.Name)
+		return injector.Inject(ev)
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// dumpRaw prints raw evdev events from every input device.
+func dumpRaw() {
 	devices, err := getInputDevices()
 	if err != nil {
 		fmt.Println("Error reading devices:", err)
@@ -162,3 +253,133 @@ func main() {
 
 	wg.Wait()
 }
+
+// chooseJoystick lists the connected joysticks and asks which one to map.
+func chooseJoystick(stdin *bufio.Reader) (string, error) {
+	paths, _ := filepath.Glob("/dev/input/js*")
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no joysticks found")
+	}
+	if len(paths) == 1 {
+		return paths[0], nil
+	}
+
+	fmt.Println("=== Joysticks Found ===")
+	for i, p := range paths {
+		fmt.Printf("%d) %s\n", i+1, p)
+	}
+	fmt.Print("Map which one? ")
+	line, _ := stdin.ReadString('\n')
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(paths) {
+		return "", fmt.Errorf("invalid choice: %s", strings.TrimSpace(line))
+	}
+	return paths[n-1], nil
+}
+
+// conflict returns the step a binding is already used by. Both halves of an
+// axis can be bound separately, but not together with the full axis.
+func conflict(used map[string]string, bind string) string {
+	bind = strings.TrimSuffix(bind, "~")
+	candidates := []string{bind}
+	if strings.HasPrefix(bind, "a") {
+		candidates = append(candidates, "+"+bind, "-"+bind)
+	} else if strings.HasPrefix(bind, "+") || strings.HasPrefix(bind, "-") {
+		candidates = append(candidates, bind[1:])
+	}
+	for _, c := range candidates {
+		if step, ok := used[c]; ok {
+			return step
+		}
+	}
+	return ""
+}
+
+// mapJoystick walks through every control of a joystick and saves the result
+// as an SDL mapping in the user gamecontrollerdb.
+func mapJoystick() {
+	stdin := bufio.NewReader(os.Stdin)
+
+	path, err := chooseJoystick(stdin)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	dev, err := input.OpenJoystick(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	defer dev.Close()
+
+	if dev.Info.GUID == "" {
+		fmt.Printf("Error: %s has no USB ids, it can't be given a mapping\n", dev.Info)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Mapping %s (GUID=%s)\n", dev.Info, dev.Info.GUID)
+	fmt.Printf("Wait %s on a step to skip it.\n\n", mapStepTimeout)
+
+	binds := map[string]string{}
+	used := map[string]string{}
+	for _, step := range input.MappingSteps {
+		for {
+			fmt.Printf("%s... ", step.Prompt)
+			bind, err := dev.Capture(step, mapStepTimeout)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			if other := conflict(used, bind); other != "" {
+				fmt.Printf("%s is already used for %s, try again\n", bind, other)
+				continue
+			}
+			fmt.Println(bind)
+			binds[step.Name] = bind
+			used[strings.TrimSuffix(bind, "~")] = step.Name
+			break
+		}
+	}
+
+	if len(binds) == 0 {
+		fmt.Println("Nothing was mapped.")
+		return
+	}
+
+	line := input.BuildMappingLine(dev.Info.GUID, dev.Info.Name, binds)
+	fmt.Println()
+	fmt.Println(line)
+	fmt.Println()
+	fmt.Printf("Save to %s? [y/N] ", config.UserControllerDbFile)
+	answer, _ := stdin.ReadString('\n')
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+		fmt.Println("Not saved.")
+		return
+	}
+
+	if err := input.SaveUserMapping(line); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Saved, SAM will use it next time the joystick is opened.")
+}
+
+func main() {
+	raw := flag.Bool("raw", false, "print raw evdev events from every device")
+	recordFile := flag.String("record", "", "record normalized input events to a file")
+	replayFile := flag.String("replay", "", "replay a recording through virtual input devices")
+	speed := flag.Float64("speed", 1, "replay speed multiplier, 0 to replay without delays")
+	flag.Parse()
+
+	switch {
+	case *raw:
+		dumpRaw()
+	case *recordFile != "":
+		record(*recordFile)
+	case *replayFile != "":
+		replay(*replayFile, *speed)
+	default:
+		mapJoystick()
+	}
+}
@@ -1,65 +1,487 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
 
+	"golang.org/x/term"
+
+	"github.com/synrais/SAM-GO/pkg/api"
 	"github.com/synrais/SAM-GO/pkg/assets"
 	"github.com/synrais/SAM-GO/pkg/attract"
 	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/control/client"
+	"github.com/synrais/SAM-GO/pkg/daemon"
+	"github.com/synrais/SAM-GO/pkg/games"
+	"github.com/synrais/SAM-GO/pkg/gamesdb"
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
+	"github.com/synrais/SAM-GO/pkg/mister"
+	"github.com/synrais/SAM-GO/pkg/nfc"
+	"github.com/synrais/SAM-GO/pkg/romheader"
+	"github.com/synrais/SAM-GO/pkg/service"
 )
 
 const iniFileName = "SAM.ini"
 
+// startupEntry names the entry in user-startup.sh which starts the service.
+const startupEntry = "SAM"
+
+var logger = service.Component("main")
+
 // CLI flags
 var (
-	streamDebug = flag.Bool("s", false, "Enable static detector stream debug output")
-	runPath     = flag.String("run", "", "Run a single game by path")
-	menuMode    = flag.Bool("menu", false, "Launch interactive game browser menu")
+	runPath    = flag.String("run", "", "Run a single game by path")
+	runSystem  = flag.String("system", "", "System to use with -run instead of detecting it")
+	menuMode   = flag.Bool("menu", false, "Launch interactive game browser menu")
+	dryRun     = flag.Bool("dryrun", false, "Print MiSTer commands instead of running them, without changing any files")
+	nfcMode    = flag.Bool("nfc", false, "Launch games from an NFC reader")
+	remoteMode = flag.Bool("remote", false, "Serve the remote control API")
+	serviceCmd = flag.String("service", "", "Manage the background service: start, stop, restart or status")
+
+	reindexMode = flag.Bool("reindex", false, "Rebuild the games database if the downloader has run since it was built")
+	startupCmd  = flag.String("startup", "", "Manage starting the service at boot: list, enable, disable, add or remove")
+	restoreMode = flag.Bool("restore", false, "List backups of MiSTer.ini and other system files, or restore the one numbered after it")
+
+	launchersCmd     = flag.String("launchers", "", "Manage the OSD launcher library: sync, prune or remove")
+	launchersDir     = flag.String("launchers-dir", config.LaunchersFolder, "Folder for -launchers")
+	launchersSystems = flag.String("launchers-systems", "", "Comma separated systems to sync with -launchers, default all")
+	launchersSearch  = flag.String("launchers-search", "", "Only sync games with all these words in their name")
 )
 
+// fatal logs an error which stops SAM, and exits.
+func fatal(format string, v ...any) {
+	logger.Error(format, v...)
+	os.Exit(1)
+}
+
 func main() {
 	// keep memory low on MiSTer
 	debug.SetMemoryLimit(128 * 1024 * 1024) // 128MB soft limit
 	flag.Parse()
 
+	if *dryRun {
+		mister.EnableDryRun()
+	}
+
 	exePath, _ := os.Executable()
-	iniPath := filepath.Join(filepath.Dir(exePath), iniFileName)
+	// the service runs from a copy in /tmp, and is told where the INI is
+	iniPath := os.Getenv(config.UserConfigEnv)
+	if iniPath == "" {
+		iniPath = filepath.Join(filepath.Dir(exePath), iniFileName)
+	}
 
 	// Ensure SAM.ini exists
 	if _, err := os.Stat(iniPath); os.IsNotExist(err) {
-		fmt.Println("[MAIN] No INI found, generating from embedded default...")
+		logger.Info("no INI found, generating from embedded default...")
 		if err := os.WriteFile(iniPath, []byte(assets.DefaultSAMIni), 0644); err != nil {
-			fmt.Fprintln(os.Stderr, "[MAIN] Failed to create default INI:", err)
-			os.Exit(1)
+			fatal("failed to create default INI: %s", err)
 		}
-		fmt.Println("[MAIN] Generated default INI at", iniPath)
+		logger.Info("generated default INI at %s", iniPath)
 	} else {
-		fmt.Println("[MAIN] Found INI at", iniPath)
+		logger.Debug("found INI at %s", iniPath)
 	}
 
 	// Load config
 	cfg, err := config.LoadUserConfig("SAM", &config.UserConfig{})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "[MAIN] Config load error:", err)
-		os.Exit(1)
+		fatal("config load error: %s", err)
+	}
+	if err := service.Default().Configure(cfg.Logging); err != nil {
+		logger.Warn("%s", err)
+	}
+	logger.Debug("loaded config from %s", cfg.IniPath)
+
+	if *serviceCmd != "" {
+		// everything the service does is logged to a file in /tmp
+		svcLogger := service.NewLogger("SAM")
+		svcLogger.SetConsole(os.Stdout)
+		_ = svcLogger.Configure(cfg.Logging)
+		service.SetDefault(svcLogger)
+
+		svc, err := service.NewService(service.ServiceArgs{
+			Name:   "SAM",
+			Logger: svcLogger.Component("service"),
+			Entry: func() (func() error, error) {
+				return daemon.Start(cfg, svcLogger)
+			},
+		})
+		if err != nil {
+			fatal("service error: %s", err)
+		}
+		// exits when done
+		svc.ServiceHandler(serviceCmd)
 	}
-	fmt.Println("[MAIN] Loaded config from:", cfg.IniPath)
 
 	// --- Mode selection ---
 	switch {
 	case *runPath != "":
 		// Direct run mode
-		if err := attract.Run([]string{*runPath}); err != nil {
-			fmt.Fprintln(os.Stderr, "[MAIN] Run error:", err)
-			os.Exit(1)
+		if err := runFile(cfg, *runPath); err != nil {
+			fatal("run error: %s", err)
+		}
+
+	case *menuMode:
+		if err := runMenu(exePath); err != nil {
+			fatal("menu error: %s", err)
+		}
+
+	case *nfcMode:
+		if err := runNfc(cfg); err != nil {
+			fatal("NFC error: %s", err)
+		}
+
+	case *remoteMode:
+		if err := runRemote(cfg); err != nil {
+			fatal("remote error: %s", err)
+		}
+
+	case *reindexMode:
+		if err := runReindex(cfg); err != nil {
+			fatal("reindex error: %s", err)
+		}
+
+	case *startupCmd != "":
+		if err := runStartup(*startupCmd); err != nil {
+			fatal("startup error: %s", err)
+		}
+
+	case *restoreMode:
+		if err := runRestore(flag.Arg(0)); err != nil {
+			fatal("restore error: %s", err)
+		}
+
+	case *launchersCmd != "":
+		if err := runLaunchers(cfg, *launchersCmd); err != nil {
+			fatal("launchers error: %s", err)
+		}
+
+	case client.Running() && !*dryRun:
+		// the service runs attract mode itself
+		if err := client.StartAttract(); err != nil {
+			fatal("attract error: %s", err)
+		}
+		logger.Info("started attract mode in the SAM service")
+
+	default:
+		// Attract mode over the games database
+		files, err := gamesdb.AllFiles()
+		if err != nil {
+			fatal("no games database, build one from the games menu first: %s", err)
+		}
+		if err := attract.StartAttractMode(cfg, files); err != nil {
+			fatal("attract error: %s", err)
+		}
+	}
+}
+
+// runFile launches a file, asking which system to use if detection isn't
+// sure and SAM is running in a terminal.
+func runFile(cfg *config.UserConfig, path string) error {
+	if *runSystem != "" {
+		system, err := games.LookupSystem(*runSystem)
+		if err != nil {
+			return err
+		}
+		return launchPath(cfg, *system, path)
+	}
+
+	detection, err := games.DetectSystem(cfg, path)
+	if err != nil {
+		// may still be launchable without a system, e.g. an mgl
+		return launchPath(cfg, games.System{}, path)
+	}
+
+	system, _ := detection.Best()
+	if !detection.Confident() {
+		system = chooseSystem(detection)
+	}
+	if hdr, err := romheader.Read(path); err == nil && hdr.Title != "" {
+		logger.Info("%s: %s (%s)", hdr.Format, hdr.Title, hdr.Region)
+	}
+	return launchPath(cfg, system, path)
+}
+
+// launchPath launches a file through the SAM service when it's running, so
+// it stops attract mode and logs the game, or directly otherwise. A dry run
+// is always direct, the service would really launch it. An empty system is
+// detected from the path.
+func launchPath(cfg *config.UserConfig, system games.System, path string) error {
+	if client.Running() && !*dryRun {
+		return client.Launch(path, system.Id)
+	}
+	if system.Id == "" {
+		return mister.LaunchGenericFile(cfg, path)
+	}
+	return mister.LaunchGenericFileAs(cfg, system, path)
+}
+
+// runMenu opens the games menu, which is a separate program next to SAM.
+// The menu pauses attract mode in the service itself while it's open.
+func runMenu(exePath string) error {
+	cmd := exec.Command(filepath.Join(filepath.Dir(exePath), "gamesmenu"))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// chooseSystem prompts for one of the detected systems, defaulting to the
+// best. Without a terminal the best is used.
+func chooseSystem(detection games.Detection) games.System {
+	best, _ := detection.Best()
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		logger.Warn("not sure which system this is for, using %s (-system to choose)", best.Id)
+		return best
+	}
+
+	fmt.Println("Not sure which system this is for:")
+	for i, c := range detection {
+		fmt.Printf("  %d) %s [%s]\n", i+1, c.System.Name, strings.Join(c.Reasons, ", "))
+	}
+	fmt.Printf("Choose a system [1]: ")
+
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return best
+	}
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 || n > len(detection) {
+		logger.Warn("invalid choice, using %s", best.Id)
+		return best
+	}
+	return detection[n-1].System
+}
+
+// runNfc runs the NFC reader service until SAM is interrupted.
+func runNfc(cfg *config.UserConfig) error {
+	if client.Running() {
+		// two of them can't share the reader
+		return fmt.Errorf("the SAM service reads NFC tags while it's running, restart it after changing [nfc]: SAM -service restart")
+	}
+
+	reader, err := nfc.OpenReader(cfg.Nfc)
+	if err != nil {
+		return err
+	}
+
+	var kbd *virtualinput.Keyboard
+	if k, err := virtualinput.NewKeyboard(virtualinput.DefaultTimeout); err != nil {
+		logger.Warn("no virtual keyboard, NFC key commands are disabled: %s", err)
+	} else {
+		kbd = &k
+		defer kbd.Close()
+	}
+
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		close(stop)
+	}()
+
+	logger.Info("waiting for NFC tags...")
+	return nfc.NewService(cfg, reader, kbd).Run(stop)
+}
+
+// runRemote serves the remote control API until SAM is interrupted.
+func runRemote(cfg *config.UserConfig) error {
+	stop, err := api.Start(cfg, service.Component("api"))
+	if err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+
+	return stop()
+}
+
+// runLaunchers manages the launcher library. sync creates launchers for new
+// games and prunes ones that are gone, prune only removes launchers for
+// missing games, and remove deletes every launcher SAM made. Launchers
+// which weren't made by SAM are left alone.
+func runLaunchers(cfg *config.UserConfig, cmd string) error {
+	folder := *launchersDir
+
+	switch strings.ToLower(cmd) {
+	case "sync":
+		files, err := gamesdb.AllFiles()
+		if err != nil {
+			return fmt.Errorf("no games database, build one from the games menu first: %w", err)
+		}
+
+		filter := mister.LauncherFilter{Query: *launchersSearch}
+		if *launchersSystems != "" {
+			filter.Systems = strings.Split(*launchersSystems, ",")
+		}
+
+		logger.Info("syncing launchers in %s", folder)
+		result, err := mister.SyncLaunchers(cfg, files, folder, filter, nil)
+		fmt.Printf("%d created, %d existing, %d removed, %d failed\n",
+			result.Created, result.Existing, result.Pruned, result.Failed)
+		return err
+
+	case "prune":
+		pruned, err := mister.PruneLaunchers(folder)
+		fmt.Printf("%d removed\n", pruned)
+		return err
+
+	case "remove":
+		removed, err := mister.RemoveLaunchers(folder)
+		fmt.Printf("%d removed\n", removed)
+		return err
+
+	default:
+		return fmt.Errorf("unknown launchers command: %s", cmd)
+	}
+}
+
+// runRestore lists the backups made before system files were changed, newest
+// first. Given the number of one, it's put back in place of its file.
+func runRestore(arg string) error {
+	backups, err := mister.ListBackups("")
+	if err != nil {
+		return err
+	}
+
+	if arg == "" {
+		if len(backups) == 0 {
+			fmt.Println("No backups found in", mister.BackupsFolder)
+			return nil
+		}
+		for i, b := range backups {
+			fmt.Printf("%3d  %s  %s\n", i+1, b.Time.Format("2006-01-02 15:04:05"), b.Original)
+		}
+		fmt.Println("Run SAM -restore <number> to restore a backup")
+		return nil
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(backups) {
+		return fmt.Errorf("no backup numbered %s, run SAM -restore to list them", arg)
+	}
+
+	backup := backups[n-1]
+	if err := mister.RestoreBackup(backup); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s from %s\n", backup.Original, backup.Time.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// runStartup manages the entry in user-startup.sh which starts the service
+// at boot. Every command can be run again safely, and all but list replace
+// entries left by the bash version of SAM, or duplicates, with one entry.
+func runStartup(cmd string) error {
+	var startup mister.Startup
+	if err := startup.Load(); err != nil {
+		return err
+	}
+
+	cmd = strings.ToLower(cmd)
+	if cmd == "list" {
+		if len(startup.Entries) == 0 {
+			fmt.Println("No entries in", config.StartupFile)
 		}
+		for _, entry := range startup.Entries {
+			state := "disabled"
+			if entry.Enabled {
+				state = "enabled "
+			}
+			name := entry.Name
+			if name == "" {
+				name = "(unnamed)"
+			}
+			if entry.IsLegacySAM() {
+				name += " [old SAM, run SAM -startup add to replace it]"
+			}
+			fmt.Printf("%s  %s\n", state, name)
+		}
+		return nil
+	}
+
+	migrated, err := startup.MigrateService(startupEntry)
+	if err != nil {
+		return err
+	}
+	if migrated {
+		logger.Info("replaced old SAM startup entries")
+	}
+
+	switch cmd {
+	case "add":
+		if err := startup.AddService(startupEntry); err != nil {
+			return err
+		}
+		fmt.Println("SAM service starts at boot")
+
+	case "enable":
+		if !startup.Exists(startupEntry) {
+			return fmt.Errorf("no SAM startup entry, run SAM -startup add")
+		}
+		if err := startup.Enable(startupEntry); err != nil {
+			return err
+		}
+		fmt.Println("SAM service starts at boot")
+
+	case "disable":
+		if startup.Exists(startupEntry) {
+			if err := startup.Disable(startupEntry); err != nil {
+				return err
+			}
+		}
+		fmt.Println("SAM service doesn't start at boot")
+
+	case "remove":
+		if startup.Exists(startupEntry) {
+			if err := startup.Remove(startupEntry); err != nil {
+				return err
+			}
+		}
+		fmt.Println("SAM startup entry removed")
 
 	default:
-		// Attract mode (with optional -s stream debug)
-		attract.PrepareAttractLists(cfg, *streamDebug)
+		return fmt.Errorf("unknown startup command: %s", cmd)
+	}
+
+	return startup.Save()
+}
+
+// runReindex rebuilds the games database if the MiSTer downloader has run
+// since it was built, so games it fetched can be found.
+func runReindex(cfg *config.UserConfig) error {
+	newer, err := mister.DownloadedSinceIndex()
+	if err != nil {
+		return err
+	}
+	if !newer {
+		fmt.Println("Games database is up to date")
+		return nil
+	}
+
+	logger.Info("downloader has run since the games database was built, rebuilding")
+	total, err := gamesdb.NewNamesIndex(cfg, games.AllSystems(), func(status gamesdb.IndexStatus) {
+		if status.SystemId != "" {
+			logger.Debug("indexing %s", status.SystemId)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Indexed %d games\n", total)
+	if client.Running() {
+		// the service keeps the old database loaded
+		fmt.Println("Restart the service to use it: SAM -service restart")
 	}
+	return nil
 }
@@ -17,13 +17,13 @@ require github.com/fsnotify/fsnotify v1.6.0
 require (
 	github.com/BurntSushi/toml v1.2.1 // indirect
 	github.com/miekg/dns v1.1.55 // indirect
-	golang.org/x/mod v0.11.0 // indirect
-	golang.org/x/net v0.11.0 // indirect
-	golang.org/x/tools v0.10.0 // indirect
+	golang.org/x/mod v0.17.0 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
-require golang.org/x/term v0.9.0
+require golang.org/x/term v0.28.0
 
 require (
 	github.com/bendahl/uinput v1.6.0
@@ -39,16 +39,17 @@ require (
 	github.com/txn2/txeh v1.4.0
 	go.etcd.io/bbolt v1.3.9
 	golang.org/x/image v0.9.0
-	golang.org/x/sync v0.6.0
-	golang.org/x/sys v0.18.0
+	golang.org/x/sync v0.10.0
+	golang.org/x/sys v0.29.0
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
 
 require (
-    github.com/rivo/tview v0.0.0-20250625164341-a4a78f1e05cb
-    github.com/gdamore/tcell/v2 v2.8.1
-    github.com/mattn/go-runewidth v0.0.16
-    github.com/rivo/uniseg v0.4.7
-    github.com/lucasb-eyer/go-colorful v1.2.0
-    github.com/gdamore/encoding v1.0.1
+	github.com/gdamore/encoding v1.0.1
+	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/lucasb-eyer/go-colorful v1.2.0
+	github.com/mattn/go-runewidth v0.0.16
+	github.com/rivo/tview v0.0.0-20250625164341-a4a78f1e05cb
+	github.com/rivo/uniseg v0.4.7
+	golang.org/x/text v0.21.0
 )
@@ -0,0 +1,410 @@
+// Package api serves SAM's remote control API: HTTP endpoints to see what's
+// playing, drive attract mode, search and launch games, plus a WebSocket
+// stream of launches and inputs. It lets a phone or another computer on the
+// network control the cabinet.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+
+	"github.com/synrais/SAM-GO/pkg/attract"
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/control/client"
+	"github.com/synrais/SAM-GO/pkg/games"
+	"github.com/synrais/SAM-GO/pkg/gamesdb"
+	"github.com/synrais/SAM-GO/pkg/mister"
+	"github.com/synrais/SAM-GO/pkg/service"
+)
+
+const DefaultPort = 8182
+
+// Version is the API version, advertised over mDNS so clients can tell what
+// they're talking to.
+const Version = "1"
+
+// maxSearchResults keeps responses a sensible size for a phone.
+const maxSearchResults = 250
+
+type Server struct {
+	cfg    *config.UserConfig
+	logger *service.Logger
+	hub    *hub
+	router *mux.Router
+
+	// inputs starts streaming input events, the first time a client
+	// connects to /api/events
+	inputs     func()
+	inputsOnce sync.Once
+
+	// done is closed when the server stops
+	done      chan struct{}
+	closeOnce sync.Once
+	unlisten  func()
+}
+
+func NewServer(cfg *config.UserConfig, logger *service.Logger) *Server {
+	srv := &Server{
+		cfg:    cfg,
+		logger: logger,
+		hub:    newHub(),
+		done:   make(chan struct{}),
+	}
+
+	r := mux.NewRouter()
+	api := r.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/status", srv.handleStatus).Methods(http.MethodGet)
+	api.HandleFunc("/systems", srv.handleSystems).Methods(http.MethodGet)
+	api.HandleFunc("/search", srv.handleSearch).Methods(http.MethodGet)
+	api.HandleFunc("/launch", srv.handleLaunch).Methods(http.MethodPost)
+	api.HandleFunc("/attract/{action}", srv.handleAttract).Methods(http.MethodPost)
+	api.HandleFunc("/events", srv.handleEvents).Methods(http.MethodGet)
+	srv.router = r
+	srv.inputs = srv.relayInputs
+
+	srv.unlisten = mister.OnLaunch(func(ev mister.LaunchEvent) {
+		srv.hub.broadcast(newEvent("launch", launchInfo(ev)))
+	})
+
+	return srv
+}
+
+// Close disconnects every client and stops listening for launches and
+// inputs, so a restarted server doesn't leave them behind.
+func (srv *Server) Close() {
+	srv.closeOnce.Do(func() {
+		close(srv.done)
+		srv.unlisten()
+		srv.hub.close()
+	})
+}
+
+// Handler returns the server's routes. Browsers may only use them from pages
+// on the same host or in allowed_origins, and if a secret is set every
+// request must include it.
+func (srv *Server) Handler() http.Handler {
+	c := cors.New(cors.Options{
+		AllowOriginRequestFunc: func(r *http.Request, _ string) bool {
+			return srv.originAllowed(r)
+		},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+	})
+	return c.Handler(srv.guard(srv.router))
+}
+
+// originAllowed reports whether a request may be made from the page it came
+// from. Requests without an Origin header aren't from a browser page.
+func (srv *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range srv.cfg.Remote.AllowedOrigins {
+		allowed = strings.TrimRight(strings.TrimSpace(allowed), "/")
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized checks the secret, sent as a bearer token or, for WebSockets
+// which can't set headers from a browser, a token query parameter.
+func (srv *Server) authorized(r *http.Request) bool {
+	secret := srv.cfg.Remote.Secret
+	if secret == "" {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// guard rejects requests from other web pages, which CORS alone doesn't stop
+// from launching games, and requests without the secret.
+func (srv *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !srv.originAllowed(r) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("origin not allowed: %s", r.Header.Get("Origin")))
+			return
+		}
+		if !srv.authorized(r) {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong secret"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Port returns the configured API port.
+func Port(cfg *config.UserConfig) int {
+	if cfg.Remote.ApiPort > 0 {
+		return cfg.Remote.ApiPort
+	}
+	return DefaultPort
+}
+
+// Start serves the API in the background, advertising it over mDNS if that's
+// enabled. The returned function shuts it down.
+func Start(cfg *config.UserConfig, logger *service.Logger) (func() error, error) {
+	port := Port(cfg)
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
+
+	srv := NewServer(cfg, logger)
+	httpServer := &http.Server{
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := httpServer.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server stopped: %s", err)
+		}
+	}()
+	logger.Info("listening on port %d", port)
+
+	stopMdns := func() error { return nil }
+	if cfg.Remote.MdnsService {
+		// mdns retries for a while if the network isn't up yet
+		done := make(chan func() error, 1)
+		go func() {
+			if stop := mister.TryStartMdns(logger, Version, port); stop != nil {
+				done <- stop
+			}
+			close(done)
+		}()
+		stopMdns = func() error {
+			if stop, ok := <-done; ok {
+				return stop()
+			}
+			return nil
+		}
+	}
+
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Close()
+		err := httpServer.Shutdown(ctx)
+		if mdnsErr := stopMdns(); err == nil {
+			err = mdnsErr
+		}
+		return err
+	}, nil
+}
+
+// --------------------------------------------------
+// Responses
+// --------------------------------------------------
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+type LaunchInfo struct {
+	SystemId string    `json:"systemId"`
+	Path     string    `json:"path,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+func launchInfo(ev mister.LaunchEvent) LaunchInfo {
+	return LaunchInfo{SystemId: ev.SystemId, Path: ev.Path, Time: ev.Time}
+}
+
+type StatusResponse struct {
+	Playing *LaunchInfo `json:"playing"`
+	Core    string      `json:"core"`
+	Attract bool        `json:"attract"`
+}
+
+type SystemResponse struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+type SearchResponse struct {
+	SystemId string `json:"systemId"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+}
+
+type LaunchRequest struct {
+	Path  string `json:"path"`
+	Token string `json:"token"`
+}
+
+// --------------------------------------------------
+// Handlers
+// --------------------------------------------------
+
+func (srv *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	resp := StatusResponse{Attract: attract.Running()}
+	if ev, ok := mister.NowPlaying(); ok {
+		info := launchInfo(ev)
+		resp.Playing = &info
+	}
+	if core, err := mister.GetActiveCoreName(); err == nil {
+		resp.Core = strings.TrimSpace(core)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (srv *Server) handleSystems(w http.ResponseWriter, _ *http.Request) {
+	systems := games.AllSystems()
+	resp := make([]SystemResponse, 0, len(systems))
+	for _, system := range systems {
+		resp = append(resp, SystemResponse{
+			Id:       system.Id,
+			Name:     system.Name,
+			Category: system.Category,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleSearch takes q, words which must all be in the name, and optionally
+// system to limit results to one system.
+func (srv *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no search query"))
+		return
+	}
+	system := r.URL.Query().Get("system")
+
+	results, err := gamesdb.SearchNamesWords(nil, query)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("games database not available: %w", err))
+		return
+	}
+
+	resp := make([]SearchResponse, 0)
+	for _, result := range results {
+		if system != "" && !strings.EqualFold(system, result.SystemId) {
+			continue
+		}
+		resp = append(resp, SearchResponse{
+			SystemId: result.SystemId,
+			Name:     result.Name,
+			Path:     result.Path,
+		})
+		if len(resp) >= maxSearchResults {
+			break
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// stopAttract stops attract mode before a launch, so it doesn't replace the
+// game a moment later. With the service running, attract mode runs there
+// rather than in this process.
+func (srv *Server) stopAttract() {
+	attract.Stop()
+	if client.Running() {
+		if err := client.StopAttract(); err != nil {
+			srv.logger.Warn("failed to stop attract mode in the service: %s", err)
+		}
+	}
+}
+
+// handleLaunch launches a path or a token. Tokens run as if from a card, so
+// commands which need to be run manually aren't allowed.
+func (srv *Server) handleLaunch(w http.ResponseWriter, r *http.Request) {
+	var req LaunchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid launch request: %w", err))
+		return
+	}
+	if req.Token == "" && req.Path == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("path or token is required"))
+		return
+	}
+
+	srv.stopAttract()
+
+	var err error
+	if req.Token != "" {
+		srv.logger.Info("launching token: %s", req.Token)
+		err = mister.LaunchToken(srv.cfg, false, nil, req.Token)
+	} else {
+		srv.logger.Info("launching path: %s", req.Path)
+		err = mister.LaunchGenericFile(srv.cfg, req.Path)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) handleAttract(w http.ResponseWriter, r *http.Request) {
+	action := mux.Vars(r)["action"]
+
+	switch action {
+	case "start":
+		if !attract.Running() {
+			files, err := gamesdb.AllFiles()
+			if err != nil {
+				writeError(w, http.StatusServiceUnavailable, fmt.Errorf("games database not available: %w", err))
+				return
+			}
+			go func() {
+				if err := attract.StartAttractMode(srv.cfg, files); err != nil {
+					srv.logger.Error("attract mode: %s", err)
+				}
+			}()
+		}
+	case "stop":
+		attract.Stop()
+	case "next":
+		if !attract.Next() {
+			writeError(w, http.StatusConflict, fmt.Errorf("attract mode is not running"))
+			return
+		}
+	case "back":
+		if !attract.Back() {
+			writeError(w, http.StatusConflict, fmt.Errorf("attract mode is not running"))
+			return
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown attract action: %s", action))
+		return
+	}
+
+	srv.hub.broadcast(newEvent("attract", action))
+	w.WriteHeader(http.StatusNoContent)
+}
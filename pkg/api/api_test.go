@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/input"
+	"github.com/synrais/SAM-GO/pkg/service"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	srv := NewServer(&config.UserConfig{}, service.NewLogger("api_test"))
+	srv.inputs = nil // don't open real input devices
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	t.Cleanup(srv.Close)
+	return srv, ts
+}
+
+func TestSystems(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/api/systems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var systems []SystemResponse
+	if err := json.NewDecoder(resp.Body).Decode(&systems); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, s := range systems {
+		if s.Id == "SNES" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("SNES missing from %d systems", len(systems))
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodPost, "/api/launch", "not json", http.StatusBadRequest},
+		{http.MethodPost, "/api/launch", "{}", http.StatusBadRequest},
+		{http.MethodGet, "/api/launch", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/search", "", http.StatusBadRequest},
+		{http.MethodPost, "/api/attract/sideways", "", http.StatusNotFound},
+		{http.MethodPost, "/api/attract/next", "", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	srv, ts := newTestServer(t)
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/events"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the subscription happens just after the upgrade, keep sending until
+	// the client is listening
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				srv.hub.broadcast(newEvent("attract", "next"))
+			}
+		}
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ev Event
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != "attract" || ev.Data != "next" {
+		t.Errorf("got event %+v", ev)
+	}
+}
+
+func TestRequestGuard(t *testing.T) {
+	srv, ts := newTestServer(t)
+	srv.cfg.Remote.AllowedOrigins = []string{"http://phone.local:8080"}
+
+	tests := []struct {
+		origin string
+		auth   string
+		query  string
+		secret string
+		want   int
+	}{
+		{"", "", "", "", http.StatusOK},
+		{ts.URL, "", "", "", http.StatusOK},
+		{"http://phone.local:8080", "", "", "", http.StatusOK},
+		{"http://evil.example", "", "", "", http.StatusForbidden},
+		{"", "", "", "s3cret", http.StatusUnauthorized},
+		{"", "Bearer wrong", "", "s3cret", http.StatusUnauthorized},
+		{"", "Bearer s3cret", "", "s3cret", http.StatusOK},
+		{"", "", "?token=s3cret", "s3cret", http.StatusOK},
+		{"http://evil.example", "Bearer s3cret", "", "s3cret", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		srv.cfg.Remote.Secret = tt.secret
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/systems"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("origin %q auth %q query %q = %d, want %d", tt.origin, tt.auth, tt.query, resp.StatusCode, tt.want)
+		}
+	}
+
+	// other pages can't open the event stream either
+	srv.cfg.Remote.Secret = ""
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/events"
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"http://evil.example"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin WebSocket allowed: %v", err)
+	}
+}
+
+func TestForwardInputs(t *testing.T) {
+	srv, _ := newTestServer(t)
+	events := srv.hub.subscribe()
+
+	// a closed input stream hands back to be subscribed again
+	in := make(chan input.Event, 2)
+	in <- input.Event{Device: input.DeviceInfo{Kind: input.KindKeyboard}, Name: "a"}
+	in <- input.Event{Device: input.DeviceInfo{Kind: input.KindMouse}, Name: "left"}
+	close(in)
+	if !srv.forwardInputs(in) {
+		t.Error("forwardInputs() = false for a closed stream, want true")
+	}
+
+	for _, want := range []string{keyPressed, "left"} {
+		ev := <-events
+		if info, ok := ev.Data.(InputInfo); !ok || info.Input != want {
+			t.Errorf("got event %+v, want input %q", ev, want)
+		}
+	}
+
+	// and stopping the server ends it for good
+	srv.Close()
+	if srv.forwardInputs(make(chan input.Event)) {
+		t.Error("forwardInputs() = true after Close, want false")
+	}
+}
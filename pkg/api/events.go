@@ -0,0 +1,201 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/input"
+)
+
+// Event is a message on the /api/events WebSocket. Types are "launch" with a
+// LaunchInfo, "input" with an InputInfo and "attract" with the action taken.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+func newEvent(kind string, data any) Event {
+	return Event{Type: kind, Time: time.Now(), Data: data}
+}
+
+type InputInfo struct {
+	Kind   string `json:"kind"`
+	Device string `json:"device"`
+	Input  string `json:"input"`
+}
+
+const (
+	clientBuffer = 64
+	writeTimeout = 10 * time.Second
+)
+
+// hub fans events out to every connected client. A client which can't keep
+// up misses events rather than holding up the others.
+type hub struct {
+	mu      sync.Mutex
+	clients map[chan Event]struct{}
+	closed  bool
+}
+
+func newHub() *hub {
+	return &hub{clients: make(map[chan Event]struct{})}
+}
+
+func (h *hub) subscribe() chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan Event, clientBuffer)
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.clients[ch] = struct{}{}
+	return ch
+}
+
+func (h *hub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[ch]; ok {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+func (h *hub) broadcast(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// close disconnects every client.
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.clients {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// --------------------------------------------------
+// WebSocket
+// --------------------------------------------------
+
+// keyPressed is sent instead of the key for keyboard input, unless
+// keyboard_events is on, so typed passwords don't go out over the network.
+const keyPressed = "key"
+
+// inputRetryDelay is how long to wait before listening for inputs again
+// after the input relay ends.
+const inputRetryDelay = 5 * time.Second
+
+// relayInputs streams inputs to clients. Input devices are only opened once
+// the first client connects, and stay open until the server stops. If the
+// input relay ends, it's subscribed to again.
+func (srv *Server) relayInputs() {
+	attractCfg, err := config.LoadINI()
+	if err != nil {
+		srv.logger.Warn("input events using default settings: %s", err)
+		attractCfg = nil
+	}
+
+	go func() {
+		for {
+			events := input.Subscribe(attractCfg)
+			if !srv.forwardInputs(events) {
+				input.Unsubscribe(events)
+				return
+			}
+
+			srv.logger.Warn("input events stopped, listening again in %s", inputRetryDelay)
+			select {
+			case <-srv.done:
+				return
+			case <-time.After(inputRetryDelay):
+			}
+		}
+	}()
+}
+
+// forwardInputs broadcasts input events until the channel closes, returning
+// true, or the server stops, returning false.
+func (srv *Server) forwardInputs(events <-chan input.Event) bool {
+	for {
+		select {
+		case <-srv.done:
+			return false
+		case ev, ok := <-events:
+			if !ok {
+				return true
+			}
+			name := ev.Name
+			if ev.Device.Kind == input.KindKeyboard && !srv.cfg.Remote.KeyboardEvents {
+				name = keyPressed
+			}
+			srv.hub.broadcast(newEvent("input", InputInfo{
+				Kind:   ev.Device.Kind,
+				Device: ev.Device.String(),
+				Input:  name,
+			}))
+		}
+	}
+}
+
+func (srv *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	// guard has already checked the origin
+	upgrader := websocket.Upgrader{CheckOrigin: srv.originAllowed}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied
+		return
+	}
+	defer conn.Close()
+
+	if srv.inputs != nil {
+		srv.inputsOnce.Do(srv.inputs)
+	}
+
+	events := srv.hub.subscribe()
+	defer srv.hub.unsubscribe(events)
+
+	// clients only listen, reading is just to notice when they go
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+					time.Now().Add(writeTimeout))
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -4,17 +4,50 @@ import (
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/synrais/SAM-GO/pkg/config"
 	"github.com/synrais/SAM-GO/pkg/games"
 	"github.com/synrais/SAM-GO/pkg/gamesdb"
 	"github.com/synrais/SAM-GO/pkg/mister"
+	"github.com/synrais/SAM-GO/pkg/service"
 )
 
-// StartAttractMode picks and plays random games endlessly using the existing menu database.
+var logger = service.Component("attract")
+
+// historySize is how many games Back can go back through.
+const historySize = 50
+
+var (
+	runMu   sync.Mutex
+	stopCh  chan struct{}
+	skipCh  chan int
+	pauseCh chan bool
+	paused  bool
+)
+
+// StartAttractMode picks and plays random games using the existing menu
+// database, until Stop is called.
 func StartAttractMode(userCfg *config.UserConfig, files []gamesdb.FileInfo) error {
-	fmt.Println("=== Starting Attract Mode ===")
+	runMu.Lock()
+	if stopCh != nil {
+		runMu.Unlock()
+		return fmt.Errorf("attract mode is already running")
+	}
+	stop := make(chan struct{})
+	skip := make(chan int, 1)
+	pause := make(chan bool, 1)
+	stopCh, skipCh, pauseCh, paused = stop, skip, pause, false
+	runMu.Unlock()
+
+	defer func() {
+		runMu.Lock()
+		stopCh, skipCh, pauseCh, paused = nil, nil, nil, false
+		runMu.Unlock()
+	}()
+
+	logger.Info("starting attract mode")
 
 	cfg, err := config.LoadINI()
 	if err != nil {
@@ -52,9 +85,31 @@ func StartAttractMode(userCfg *config.UserConfig, files []gamesdb.FileInfo) erro
 
 	rand.Seed(time.Now().UnixNano())
 
+	var history []gamesdb.FileInfo
+	back := false
+
 	for {
-		// choose a completely random game each iteration
-		game := filtered[rand.Intn(len(filtered))]
+		select {
+		case <-stop:
+			logger.Info("stopped")
+			return nil
+		default:
+		}
+
+		// choose a completely random game each iteration, unless going
+		// back to the one before
+		var game gamesdb.FileInfo
+		if back && len(history) > 1 {
+			history = history[:len(history)-1]
+			game = history[len(history)-1]
+		} else {
+			game = filtered[rand.Intn(len(filtered))]
+			history = append(history, game)
+			if len(history) > historySize {
+				history = history[1:]
+			}
+		}
+		back = false
 
 		sys, err := games.GetSystem(game.SystemId)
 		if err != nil || sys == nil {
@@ -65,10 +120,18 @@ func StartAttractMode(userCfg *config.UserConfig, files []gamesdb.FileInfo) erro
 		if game.Ext != "" {
 			display += "." + game.Ext
 		}
-		fmt.Printf("[Attract] Launching %s (%s)\n", display, sys.Name)
+		logger.Info("launching %s (%s)", display, sys.Name)
 
-		if err := mister.LaunchGame(userCfg, *sys, game.Path); err != nil {
-			fmt.Printf("[Attract] failed to launch %s: %v\n", display, err)
+		if cfg.Attract.LaunchTimeout > 0 {
+			timeout := time.Duration(cfg.Attract.LaunchTimeout) * time.Second
+			if err := mister.LaunchGameAndWait(userCfg, *sys, game.Path, timeout); err != nil {
+				// a game that crashed back to the menu or never loaded is
+				// skipped straight away rather than shown for its play time
+				logger.Warn("skipping %s: %v", display, err)
+				continue
+			}
+		} else if err := mister.LaunchGame(userCfg, *sys, game.Path); err != nil {
+			logger.Error("failed to launch %s: %v", display, err)
 			continue
 		}
 
@@ -76,8 +139,135 @@ func StartAttractMode(userCfg *config.UserConfig, files []gamesdb.FileInfo) erro
 		if minTime != maxTime {
 			playTime = rand.Intn(maxTime-minTime+1) + minTime
 		}
-		time.Sleep(time.Duration(playTime) * time.Second)
+		if !waitPlayTime(time.Duration(playTime)*time.Second, stop, skip, pause, &back) {
+			logger.Info("stopped")
+			return nil
+		}
+	}
+}
+
+// waitPlayTime waits while a game plays, returning false if attract mode was
+// stopped. The play time doesn't run down while paused, and starts over on
+// resume.
+func waitPlayTime(playTime time.Duration, stop chan struct{}, skip chan int, pause chan bool, back *bool) bool {
+	timer := time.NewTimer(playTime)
+	defer timer.Stop()
+
+	isPaused := Paused()
+	if isPaused {
+		timer.Stop()
+	}
+
+	for {
+		select {
+		case <-stop:
+			return false
+		case dir := <-skip:
+			*back = dir < 0
+			return true
+		case p := <-pause:
+			if p && !isPaused {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+			} else if !p && isPaused {
+				timer.Reset(playTime)
+			}
+			isPaused = p
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// Running reports whether attract mode is currently running.
+func Running() bool {
+	runMu.Lock()
+	defer runMu.Unlock()
+	return stopCh != nil
+}
+
+// Stop ends attract mode after the current game. It returns false if attract
+// mode wasn't running.
+func Stop() bool {
+	runMu.Lock()
+	defer runMu.Unlock()
+	if stopCh == nil {
+		return false
 	}
+	select {
+	case <-stopCh:
+	default:
+		close(stopCh)
+	}
+	return true
+}
+
+// Next skips to a new game straight away. It returns false if attract mode
+// wasn't running.
+func Next() bool {
+	return sendSkip(1)
+}
+
+// Back goes back to the previous game. It returns false if attract mode
+// wasn't running.
+func Back() bool {
+	return sendSkip(-1)
+}
+
+// Pause keeps the current game running until Resume, for example while a
+// menu is open. Next and Back still work while paused. It returns false if
+// attract mode wasn't running.
+func Pause() bool {
+	return setPaused(true)
+}
+
+// Resume carries on after Pause, giving the current game a full play time. It
+// returns false if attract mode wasn't running.
+func Resume() bool {
+	return setPaused(false)
+}
+
+// Paused reports whether attract mode is running but paused.
+func Paused() bool {
+	runMu.Lock()
+	defer runMu.Unlock()
+	return paused
+}
+
+func setPaused(p bool) bool {
+	runMu.Lock()
+	defer runMu.Unlock()
+	if pauseCh == nil {
+		return false
+	}
+	paused = p
+	// only the latest state matters to the game loop
+	select {
+	case <-pauseCh:
+	default:
+	}
+	pauseCh <- p
+	return true
+}
+
+func sendSkip(dir int) bool {
+	runMu.Lock()
+	defer runMu.Unlock()
+	if skipCh == nil {
+		return false
+	}
+	// a skip already waiting is replaced, pressing next twice while a game
+	// loads only skips once
+	select {
+	case <-skipCh:
+	default:
+	}
+	skipCh <- dir
+	return true
 }
 
 func filterSystems(files []gamesdb.FileInfo, cfg *config.Config) []gamesdb.FileInfo {
@@ -100,6 +290,11 @@ func filterSystems(files []gamesdb.FileInfo, cfg *config.Config) []gamesdb.FileI
 		if exclude[sys] {
 			continue
 		}
+		// later discs of a set that wasn't collapsed in the index, which
+		// would start a game part way through
+		if gamesdb.DiscSystems[f.SystemId] && gamesdb.DiscNumber(f.Path) > 1 {
+			continue
+		}
 		out = append(out, f)
 	}
 	return out
@@ -0,0 +1,54 @@
+package attract
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/synrais/SAM-GO/pkg/gamesdb"
+	"github.com/synrais/SAM-GO/pkg/mister"
+)
+
+// **attract:start, stop, next, back, pause and resume. Attract imports mister, so the command
+// is registered from here rather than with the other built-ins.
+func init() {
+	mister.RegisterTokenCommand(mister.TokenCommand{
+		Name: "attract",
+		Run:  tokenAttract,
+	})
+}
+
+func tokenAttract(env mister.TokenEnv, args mister.TokenArgs) error {
+	switch strings.ToLower(args.String()) {
+	case "start":
+		if Running() {
+			return nil
+		}
+		files, err := gamesdb.AllFiles()
+		if err != nil {
+			return fmt.Errorf("failed to load games: %w", err)
+		}
+		go func() {
+			if err := StartAttractMode(env.Cfg, files); err != nil {
+				logger.Error("%s", err)
+			}
+		}()
+		return nil
+	case "stop":
+		Stop()
+		return nil
+	case "next":
+		Next()
+		return nil
+	case "back":
+		Back()
+		return nil
+	case "pause":
+		Pause()
+		return nil
+	case "resume":
+		Resume()
+		return nil
+	default:
+		return fmt.Errorf("unknown attract action: %s", args.String())
+	}
+}
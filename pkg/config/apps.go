@@ -9,6 +9,7 @@ const PlayLogDbFile   = SdFolder + "/playlog.db"
 
 const PidFileTemplate = TempFolder + "/%s.pid"
 const LogFileTemplate = TempFolder + "/%s.log"
+const StatusFileTemplate = TempFolder + "/%s.status"
 
 const ScriptsConfigFolder = ScriptsFolder + "/.config"
 const SAMConfigFolder     = ScriptsConfigFolder + "/sam"
@@ -19,6 +20,14 @@ const ArcadeDBFile = SAMConfigFolder + "/ArcadeDatabase.csv"
 const NfcDatabaseFile = SdFolder + "/nfc.csv"
 const NfcLastScanFile = TempFolder + "/NFCSCAN"
 
+const ControlSocketFile = TempFolder + "/SAM.sock"
+
 const LastLaunchFile = "/tmp/.LASTLAUNCH.mgl"
 
 const MenuDb = SAMConfigFolder + "/menu.db"
+
+const CoreRulesFile = SAMConfigFolder + "/core_rules.ini"
+
+const UserControllerDbFile = SAMConfigFolder + "/gamecontrollerdb_user.txt"
+
+const BackupsFolder = SAMConfigFolder + "/backups"
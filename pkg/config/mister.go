@@ -37,6 +37,10 @@ const DownloaderLastRun = ScriptsFolder + "/.config/downloader/downloader.last_s
 // TODO: this can't be hardcoded if we want dynamic arcade folders
 const ArcadeCoresFolder = "/media/fat/_Arcade/cores"
 
+// LaunchersFolder is where SAM -launchers builds its tree of game launchers,
+// which shows in the MiSTer OSD as a browseable folder.
+const LaunchersFolder = SdFolder + "/_Games"
+
 // TODO: not the order mister actually checks, it does games folders second, but this is simpler for checking prefix
 var GamesFolders = []string{
 	"/media/usb0/games",
@@ -21,6 +21,11 @@ type AttractConfig struct {
 	Include           []string `ini:"include" delim:","`
 	Exclude           []string `ini:"exclude" delim:","`
 	UseStaticDetector bool     `ini:"usestaticdetector"`
+	LaunchTimeout     int      `ini:"launchtimeout"`
+	IdleTimeout       int      `ini:"idletimeout"`
+	IdleInCores       bool     `ini:"idleincores"`
+	IdleExempt        []string `ini:"idleexempt" delim:","`
+	ExitToMenu        bool     `ini:"exittomenu"`
 }
 
 type ListConfig struct {
@@ -42,26 +47,51 @@ type DisableRules struct {
 	Extensions []string `ini:"extensions" delim:","`
 }
 
+type InputDetectorConfig struct {
+	Mouse         bool     `ini:"mouse"`
+	Keyboard      bool     `ini:"keyboard"`
+	Joystick      bool     `ini:"joystick"`
+	Ignore        []string `ini:"ignore" delim:","`
+	SwipeWindow   int      `ini:"swipewindow"`
+	SwipeDistance int      `ini:"swipedistance"`
+	SwipeVelocity int      `ini:"swipevelocity"`
+	DoubleClick   int      `ini:"doubleclick"`
+	LongPress     int      `ini:"longpress"`
+}
+
+// InputBindings maps normalized input names to actions for one device kind,
+// taken from an [InputDetector.<Kind>] section. Devices holds the
+// [InputDetector.<Kind>.<device>] overrides, keyed by the device pattern.
+type InputBindings struct {
+	Actions map[string]string
+	Devices map[string]map[string]string
+}
+
 type Config struct {
-	Path    string
-	Attract AttractConfig
-	List    ListConfig
-	Disable map[string]DisableRules
+	Path          string
+	Attract       AttractConfig
+	List          ListConfig
+	Disable       map[string]DisableRules
+	InputDetector InputDetectorConfig
+	Inputs        map[string]InputBindings
 }
 
 // --------------------------------------------------
 //  Loader
 // --------------------------------------------------
 
-// LoadINI loads SAM.ini (next to the executable).
+// LoadINI loads SAM.ini (next to the executable, or the file in
+// SAM_CONFIG, which the background service is started with).
 // If it's missing, it writes the embedded default.ini first.
 func LoadINI() (*Config, error) {
-	exe, err := os.Executable()
-	if err != nil {
-		return nil, fmt.Errorf("cannot locate executable: %w", err)
+	userPath := os.Getenv(UserConfigEnv)
+	if userPath == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("cannot locate executable: %w", err)
+		}
+		userPath = filepath.Join(filepath.Dir(exe), "SAM.ini")
 	}
-	baseDir := filepath.Dir(exe)
-	userPath := filepath.Join(baseDir, "SAM.ini")
 
 	// If SAM.ini missing → write embedded default.ini from assets
 	if _, err := os.Stat(userPath); os.IsNotExist(err) {
@@ -72,11 +102,20 @@ func LoadINI() (*Config, error) {
 	}
 
 	cfg := &Config{
-		Path:    userPath,
+		Path: userPath,
+		Attract: AttractConfig{
+			LaunchTimeout: 30,
+		},
 		Disable: make(map[string]DisableRules),
+		InputDetector: InputDetectorConfig{
+			Mouse:    true,
+			Keyboard: true,
+			Joystick: true,
+		},
+		Inputs: make(map[string]InputBindings),
 	}
 
-	file, err := ini.Load(userPath)
+	file, err := ini.LoadSources(ini.LoadOptions{Insensitive: true}, userPath)
 	if err != nil {
 		return cfg, err
 	}
@@ -84,6 +123,7 @@ func LoadINI() (*Config, error) {
 	// Map main sections
 	_ = file.Section("Attract").MapTo(&cfg.Attract)
 	_ = file.Section("List").MapTo(&cfg.List)
+	_ = file.Section("InputDetector").MapTo(&cfg.InputDetector)
 
 	// Map Disable.* sections
 	for _, sec := range file.Sections() {
@@ -96,5 +136,40 @@ func LoadINI() (*Config, error) {
 		}
 	}
 
+	// Map InputDetector.<kind> and InputDetector.<kind>.<device> sections
+	for _, sec := range file.Sections() {
+		name := strings.ToLower(sec.Name())
+		if !strings.HasPrefix(name, "inputdetector.") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(name, "inputdetector."), ".", 2)
+		kind := parts[0]
+		bindings, ok := cfg.Inputs[kind]
+		if !ok {
+			bindings = InputBindings{
+				Actions: make(map[string]string),
+				Devices: make(map[string]map[string]string),
+			}
+		}
+
+		if len(parts) == 1 {
+			for _, key := range sec.Keys() {
+				if v := strings.TrimSpace(key.Value()); v != "" {
+					bindings.Actions[key.Name()] = v
+				}
+			}
+		} else {
+			// keys with empty values are kept so a device can unbind an input
+			overrides := make(map[string]string)
+			for _, key := range sec.Keys() {
+				overrides[key.Name()] = strings.TrimSpace(key.Value())
+			}
+			bindings.Devices[parts[1]] = overrides
+		}
+
+		cfg.Inputs[kind] = bindings
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadINIInputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "SAM.ini")
+	err := os.WriteFile(path, []byte(`[InputDetector]
+Mouse = false
+Ignore = *Light Gun*, 0079:0006
+
+[InputDetector.Keyboard]
+Left  = back
+right = next
+space =
+
+[InputDetector.Joystick]
+dpleft = back
+
+[InputDetector.Joystick.0079:0006]
+back   = next
+leftx- =
+
+[InputDetector.Joystick.8BitDo SN30 Pro]
+start = next
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(UserConfigEnv, path)
+
+	cfg, err := LoadINI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detector := cfg.InputDetector
+	if detector.Mouse || !detector.Keyboard || !detector.Joystick {
+		t.Errorf("kinds = mouse %v, keyboard %v, joystick %v, want only mouse off",
+			detector.Mouse, detector.Keyboard, detector.Joystick)
+	}
+	if want := []string{"*Light Gun*", "0079:0006"}; !reflect.DeepEqual(detector.Ignore, want) {
+		t.Errorf("Ignore = %q, want %q", detector.Ignore, want)
+	}
+
+	want := map[string]InputBindings{
+		"keyboard": {
+			// names are case-insensitive, and empty actions are dropped
+			Actions: map[string]string{"left": "back", "right": "next"},
+			Devices: map[string]map[string]string{},
+		},
+		"joystick": {
+			Actions: map[string]string{"dpleft": "back"},
+			Devices: map[string]map[string]string{
+				// an empty action unbinds the input for that device
+				"0079:0006":       {"back": "next", "leftx-": ""},
+				"8bitdo sn30 pro": {"start": "next"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(cfg.Inputs, want) {
+		t.Errorf("Inputs =\n%+v\nwant\n%+v", cfg.Inputs, want)
+	}
+}
@@ -17,6 +17,13 @@ type PlayLogConfig struct {
 	OnGameStop  string `ini:"on_game_stop,omitempty"`
 }
 
+type LoggingConfig struct {
+	Level      string   `ini:"level,omitempty"`
+	Components []string `ini:"components,omitempty" delim:","`
+	MaxSize    int      `ini:"max_size,omitempty"`
+	Backups    int      `ini:"backups,omitempty"`
+}
+
 type RandomConfig struct{}
 
 type SearchConfig struct {
@@ -33,16 +40,20 @@ type LastPlayedConfig struct {
 }
 
 type RemoteConfig struct {
-	MdnsService     bool   `ini:"mdns_service,omitempty"`
-	SyncSSHKeys     bool   `ini:"sync_ssh_keys,omitempty"`
-	CustomLogo      string `ini:"custom_logo,omitempty"`
-	AnnounceGameUrl string `ini:"announce_game_url,omitempty"`
+	MdnsService     bool     `ini:"mdns_service,omitempty"`
+	SyncSSHKeys     bool     `ini:"sync_ssh_keys,omitempty"`
+	CustomLogo      string   `ini:"custom_logo,omitempty"`
+	AnnounceGameUrl string   `ini:"announce_game_url,omitempty"`
+	ApiPort         int      `ini:"api_port,omitempty"`
+	ServiceApi      bool     `ini:"service_api,omitempty"`
+	Secret          string   `ini:"secret,omitempty"`
+	AllowedOrigins  []string `ini:"allowed_origins,omitempty" delim:","`
+	KeyboardEvents  bool     `ini:"keyboard_events,omitempty"`
 }
 
 type NfcConfig struct {
 	ConnectionString string `ini:"connection_string,omitempty"`
 	AllowCommands    bool   `ini:"allow_commands,omitempty"`
-	DisableSounds    bool   `ini:"disable_sounds,omitempty"`
 	ProbeDevice      bool   `ini:"probe_device,omitempty"`
 }
 
@@ -51,6 +62,10 @@ type SystemsConfig struct {
 	SetCore     []string `ini:"set_core,omitempty,allowshadow"`
 }
 
+type MacrosConfig struct {
+	Boot []string `ini:"boot,omitempty,allowshadow"`
+}
+
 type UserConfig struct {
 	AppPath    string
 	IniPath    string
@@ -62,6 +77,8 @@ type UserConfig struct {
 	Remote     RemoteConfig     `ini:"remote,omitempty"`
 	Nfc        NfcConfig        `ini:"nfc,omitempty"`
 	Systems    SystemsConfig    `ini:"systems,omitempty"`
+	Macros     MacrosConfig     `ini:"macros,omitempty"`
+	Logging    LoggingConfig    `ini:"logging,omitempty"`
 }
 
 func LoadUserConfig(name string, defaultConfig *UserConfig) (*UserConfig, error) {
@@ -88,7 +105,12 @@ func LoadUserConfig(name string, defaultConfig *UserConfig) (*UserConfig, error)
 		return defaultConfig, nil
 	}
 
-	cfg, err := ini.ShadowLoad(iniPath)
+	// boot macros separate their steps with ";", which would otherwise be
+	// read as the start of a comment
+	cfg, err := ini.LoadSources(ini.LoadOptions{
+		AllowShadows:        true,
+		IgnoreInlineComment: true,
+	}, iniPath)
 	if err != nil {
 		return defaultConfig, err
 	}
@@ -0,0 +1,77 @@
+// Package client calls the SAM service over its control socket. Every
+// function returns control.ErrNotRunning if the service isn't running, so
+// callers can fall back to doing the work themselves.
+package client
+
+import (
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/control"
+)
+
+// SocketPath is the control socket of the service.
+var SocketPath = config.ControlSocketFile
+
+// Running reports whether the service is running and listening for
+// commands.
+func Running() bool {
+	return control.Available(SocketPath)
+}
+
+// Launch launches a file, stopping attract mode. An empty system is
+// detected from the path.
+func Launch(path string, system string) error {
+	return control.Call(SocketPath, control.MethodLaunch, control.LaunchParams{
+		Path:   path,
+		System: system,
+	}, nil)
+}
+
+func Status() (control.Status, error) {
+	var status control.Status
+	err := control.Call(SocketPath, control.MethodStatus, nil, &status)
+	return status, err
+}
+
+// NowPlaying returns the running core and game.
+func NowPlaying() (control.Playing, error) {
+	var playing control.Playing
+	err := control.Call(SocketPath, control.MethodPlaying, nil, &playing)
+	return playing, err
+}
+
+func StartAttract() error {
+	return control.Call(SocketPath, control.MethodAttractStart, nil, nil)
+}
+
+func StopAttract() error {
+	return control.Call(SocketPath, control.MethodAttractStop, nil, nil)
+}
+
+// PauseAttract keeps the current attract game running until ResumeAttract.
+// It returns false if attract mode wasn't running.
+func PauseAttract() (bool, error) {
+	var paused bool
+	err := control.Call(SocketPath, control.MethodAttractPause, nil, &paused)
+	return paused, err
+}
+
+func ResumeAttract() error {
+	return control.Call(SocketPath, control.MethodAttractResume, nil, nil)
+}
+
+// SetVolume sets MiSTer's master volume, from 0 to mister.MaxVolume. bgm
+// sets it again when a core starts or stops if it has menuvolume or
+// defaultvolume set.
+func SetVolume(level int) error {
+	return control.Call(SocketPath, control.MethodVolume, control.VolumeParams{Level: level}, nil)
+}
+
+// BgmNext skips to the next background music track.
+func BgmNext() error {
+	return control.Call(SocketPath, control.MethodBgmNext, nil, nil)
+}
+
+// ReloadConfig makes the service read SAM.ini again.
+func ReloadConfig() error {
+	return control.Call(SocketPath, control.MethodReloadConfig, nil, nil)
+}
@@ -0,0 +1,221 @@
+// Package control is the local control socket of the SAM service. Commands
+// run in the foreground, like SAM -run, and the other SAM tools use it to
+// ask the running service to do things instead of doing them alongside it.
+// The client package wraps the methods the service provides.
+//
+// The protocol is JSON-RPC 2.0, one request or response per line on a unix
+// socket:
+//
+//	{"jsonrpc": "2.0", "method": "launch", "params": {"path": "/media/fat/games/NES/Mario.nes"}, "id": 1}
+//	{"jsonrpc": "2.0", "result": null, "id": 1}
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const dialTimeout = 2 * time.Second
+
+// ErrNotRunning means nothing is listening on the socket.
+var ErrNotRunning = errors.New("service not running")
+
+const jsonRpcVersion = "2.0"
+
+// Error codes from the JSON-RPC spec. Errors returned by a handler use
+// CodeServerError.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeServerError    = -32000
+)
+
+type Request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Id      int             `json:"id"`
+}
+
+type Response struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Id      int             `json:"id"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Handler runs one method. params is empty if none were sent. The result is
+// sent back as JSON.
+type Handler func(params json.RawMessage) (any, error)
+
+type Server struct {
+	listener net.Listener
+	handlers map[string]Handler
+	wg       sync.WaitGroup
+}
+
+// Available reports whether a service is listening on the socket at path.
+func Available(path string) bool {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Listen starts serving handlers on a unix socket at path. A socket left
+// behind by a service which didn't shut down cleanly is replaced.
+func Listen(path string, handlers map[string]Handler) (*Server, error) {
+	if Available(path) {
+		return nil, fmt.Errorf("control socket already in use: %s", path)
+	}
+	_ = os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control socket: %w", err)
+	}
+
+	srv := &Server{listener: listener, handlers: handlers}
+	srv.wg.Add(1)
+	go srv.serve()
+	return srv, nil
+}
+
+func (srv *Server) serve() {
+	defer srv.wg.Done()
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		go srv.handle(conn)
+	}
+}
+
+func (srv *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = Response{JsonRpc: jsonRpcVersion, Error: &Error{CodeParseError, err.Error()}}
+		} else {
+			resp = srv.call(req)
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (srv *Server) call(req Request) Response {
+	resp := Response{JsonRpc: jsonRpcVersion, Id: req.Id}
+	if req.JsonRpc != jsonRpcVersion || req.Method == "" {
+		resp.Error = &Error{CodeInvalidRequest, "not a JSON-RPC 2.0 request"}
+		return resp
+	}
+
+	handler, ok := srv.handlers[req.Method]
+	if !ok {
+		resp.Error = &Error{CodeMethodNotFound, fmt.Sprintf("unknown method: %s", req.Method)}
+		return resp
+	}
+
+	result, err := handler(req.Params)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{CodeServerError, err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &Error{CodeServerError, fmt.Sprintf("invalid result: %s", err)}
+		return resp
+	}
+	resp.Result = data
+	return resp
+}
+
+// Close stops accepting requests and removes the socket.
+func (srv *Server) Close() error {
+	err := srv.listener.Close()
+	srv.wg.Wait()
+	return err
+}
+
+// InvalidParams is returned by handlers when the params can't be used.
+func InvalidParams(err error) error {
+	return &Error{CodeInvalidParams, fmt.Sprintf("invalid params: %s", err)}
+}
+
+// DecodeParams unmarshals a handler's params, returning an InvalidParams
+// error if they don't fit.
+func DecodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return InvalidParams(errors.New("missing"))
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return InvalidParams(err)
+	}
+	return nil
+}
+
+// Call runs a method on the service listening at path. params may be nil,
+// and result may be nil to ignore the result. Errors from the service are
+// returned as *Error.
+func Call(path string, method string, params any, result any) error {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return ErrNotRunning
+	}
+	defer conn.Close()
+
+	req := Request{JsonRpc: jsonRpcVersion, Method: method, Id: 1}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("invalid params: %w", err)
+		}
+		req.Params = data
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result != nil && len(resp.Result) > 0 {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sam.sock")
+
+	type echoParams struct {
+		Text string `json:"text"`
+	}
+	srv, err := Listen(path, map[string]Handler{
+		"echo": func(params json.RawMessage) (any, error) {
+			var p echoParams
+			if err := DecodeParams(params, &p); err != nil {
+				return nil, err
+			}
+			return p.Text, nil
+		},
+		"fail": func(json.RawMessage) (any, error) {
+			return nil, fmt.Errorf("it broke")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Available(path) {
+		t.Fatal("socket not available")
+	}
+
+	var got string
+	if err := Call(path, "echo", echoParams{Text: "hello"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello" {
+		t.Errorf("echo = %q", got)
+	}
+
+	codes := []struct {
+		method string
+		params any
+		code   int
+	}{
+		{"fail", nil, CodeServerError},
+		{"missing", nil, CodeMethodNotFound},
+		{"echo", nil, CodeInvalidParams},
+		{"echo", []int{1}, CodeInvalidParams},
+	}
+	for _, c := range codes {
+		var rpcErr *Error
+		err := Call(path, c.method, c.params, nil)
+		if !errors.As(err, &rpcErr) || rpcErr.Code != c.code {
+			t.Errorf("%s(%v) = %v, want code %d", c.method, c.params, err, c.code)
+		}
+	}
+	if err := Call(path, "fail", nil, nil); err == nil || err.Error() != "it broke" {
+		t.Errorf("fail = %v", err)
+	}
+
+	if _, err := Listen(path, nil); err == nil {
+		t.Error("second listener on the same socket didn't fail")
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Call(path, "echo", nil, nil); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("call after close = %v", err)
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sam.sock")
+	srv, err := Listen(path, map[string]Handler{
+		"ping": func(json.RawMessage) (any, error) { return "pong", nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewScanner(conn)
+
+	tests := []struct {
+		line string
+		code int
+	}{
+		{`not json`, CodeParseError},
+		{`{"method": "ping", "id": 2}`, CodeInvalidRequest},
+		{`{"jsonrpc": "2.0", "id": 3}`, CodeInvalidRequest},
+		{`{"jsonrpc": "2.0", "method": "ping", "id": 4}`, 0},
+	}
+	for _, tt := range tests {
+		if _, err := fmt.Fprintln(conn, tt.line); err != nil {
+			t.Fatal(err)
+		}
+		if !reader.Scan() {
+			t.Fatalf("%s: no response", tt.line)
+		}
+		var resp Response
+		if err := json.Unmarshal(reader.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.JsonRpc != "2.0" {
+			t.Errorf("%s: jsonrpc = %q", tt.line, resp.JsonRpc)
+		}
+		switch {
+		case tt.code == 0 && resp.Error != nil:
+			t.Errorf("%s: unexpected error %v", tt.line, resp.Error)
+		case tt.code != 0 && (resp.Error == nil || resp.Error.Code != tt.code):
+			t.Errorf("%s: error = %v, want code %d", tt.line, resp.Error, tt.code)
+		}
+	}
+}
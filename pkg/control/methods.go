@@ -0,0 +1,48 @@
+package control
+
+import "time"
+
+// Methods provided by the SAM service.
+const (
+	MethodLaunch        = "launch"
+	MethodStatus        = "status"
+	MethodPlaying       = "playing"
+	MethodAttractStart  = "attract.start"
+	MethodAttractStop   = "attract.stop"
+	MethodAttractPause  = "attract.pause"
+	MethodAttractResume = "attract.resume"
+	MethodVolume        = "volume"
+	MethodBgmNext       = "bgm.next"
+	MethodReloadConfig  = "config.reload"
+)
+
+// LaunchParams are the params of the launch method. System is optional,
+// without it the system is detected from the path.
+type LaunchParams struct {
+	Path   string `json:"path"`
+	System string `json:"system,omitempty"`
+}
+
+// Status is the result of the status method.
+type Status struct {
+	Attract bool   `json:"attract"`
+	Paused  bool   `json:"paused"`
+	Core    string `json:"core"`
+	Path    string `json:"path,omitempty"`
+}
+
+// Playing is the result of the playing method. It covers games started from
+// the OSD as well as by SAM, System and Started are only known for games SAM
+// launched.
+type Playing struct {
+	Core    string    `json:"core"`
+	Path    string    `json:"path,omitempty"`
+	System  string    `json:"system,omitempty"`
+	Started time.Time `json:"started,omitempty"`
+}
+
+// VolumeParams are the params of the volume method, a level from 0 to
+// mister.MaxVolume.
+type VolumeParams struct {
+	Level int `json:"level"`
+}
@@ -0,0 +1,361 @@
+// Package daemon is the SAM background service started by SAM -service. It
+// runs attract mode, the input listener, the play log, the control socket,
+// the NFC reader when one is set up in [nfc] and, with service_api set in
+// [remote], the remote API together in one process.
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/api"
+	"github.com/synrais/SAM-GO/pkg/attract"
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/control"
+	"github.com/synrais/SAM-GO/pkg/games"
+	"github.com/synrais/SAM-GO/pkg/gamesdb"
+	"github.com/synrais/SAM-GO/pkg/input"
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
+	"github.com/synrais/SAM-GO/pkg/mister"
+	"github.com/synrais/SAM-GO/pkg/nfc"
+	"github.com/synrais/SAM-GO/pkg/playlog"
+	"github.com/synrais/SAM-GO/pkg/service"
+)
+
+type daemon struct {
+	cfgMu   sync.RWMutex
+	cfg     *config.UserConfig
+	logger  *service.Logger
+	tracker *playlog.Tracker
+	tasks   *service.Supervisor
+}
+
+// Start starts the service, returning a function which stops it. It has the
+// shape of a service.ServiceEntry.
+//
+// Everything but the control socket runs as a supervised task, restarted if
+// it crashes, which SAM -service status shows the health of.
+func Start(cfg *config.UserConfig, logger *service.Logger) (func() error, error) {
+	d := &daemon{
+		cfg:     cfg,
+		logger:  logger.Component("daemon"),
+		tracker: playlog.NewTracker(cfg.PlayLog),
+		tasks:   service.NewSupervisor("SAM", logger.Component("supervisor")),
+	}
+
+	socket, err := control.Listen(config.ControlSocketFile, d.handlers())
+	if err != nil {
+		return nil, err
+	}
+
+	// a port that's taken is retried, the rest of the service is still
+	// useful without the api
+	if cfg.Remote.ServiceApi {
+		_ = d.tasks.Go("api", service.EntryTask(func() (func() error, error) {
+			return api.Start(cfg, logger.Component("api"))
+		}))
+	}
+	_ = d.tasks.Go("playlog", d.tracker.Run)
+	if nfc.Configured(cfg.Nfc) {
+		_ = d.tasks.Go("nfc", d.readNfc)
+	}
+
+	attractCfg, err := config.LoadINI()
+	if attractCfg == nil {
+		d.logger.Error("input listener not started: %s", err)
+	} else {
+		_ = d.tasks.Go(inputsTask, d.inputs(attractCfg))
+	}
+
+	// with an idle timeout attract mode waits until the MiSTer is left
+	// alone, otherwise it starts with the service
+	if attractCfg == nil || attractCfg.Attract.IdleTimeout <= 0 {
+		if err := d.startAttract(); err != nil {
+			d.logger.Error("attract mode not started: %s", err)
+		}
+	}
+
+	return func() error {
+		d.tasks.Stop()
+		return socket.Close()
+	}, nil
+}
+
+// config returns the current user config. A reload swaps in a new one
+// rather than changing it, so a config already handed out never changes
+// under its holder.
+func (d *daemon) config() *config.UserConfig {
+	d.cfgMu.RLock()
+	defer d.cfgMu.RUnlock()
+	return d.cfg
+}
+
+const attractTask = "attract"
+
+// stopAttract stops attract mode, and keeps the task from restarting it if
+// it was waiting to after a failure.
+func (d *daemon) stopAttract() {
+	d.tasks.StopTask(attractTask)
+	attract.Stop()
+}
+
+// startAttract runs attract mode as a task, so it's restarted if it fails
+// rather than silently ending. Stopping it for input finishes the task.
+func (d *daemon) startAttract() error {
+	if attract.Running() || d.tasks.Running(attractTask) {
+		return nil
+	}
+	files, err := gamesdb.AllFiles()
+	if err != nil {
+		return fmt.Errorf("no games database: %w", err)
+	}
+	return d.tasks.Go(attractTask, func(stop <-chan struct{}) error {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-stop:
+				attract.Stop()
+			case <-done:
+			}
+		}()
+		return attract.StartAttractMode(d.config(), files)
+	})
+}
+
+const inputsTask = "inputs"
+
+// inputs returns the task which listens to inputs with the settings in
+// attractCfg.
+func (d *daemon) inputs(attractCfg *config.Config) service.Task {
+	return func(stop <-chan struct{}) error {
+		return d.listenInputs(attractCfg, stop)
+	}
+}
+
+// listenInputs controls attract mode from the inputs bound in
+// [InputDetector]. Bound next and back actions skip games, and any other
+// input means someone wants to play, so attract mode stops and leaves the
+// current game running, or goes back to the menu with ExitToMenu. Inputs
+// and the running core are also watched to start attract mode after
+// IdleTimeout.
+func (d *daemon) listenInputs(attractCfg *config.Config, stop <-chan struct{}) error {
+	bindings := input.NewBindings(attractCfg)
+	idle := newIdleWatcher(attractCfg.Attract, time.Now())
+
+	ticker := time.NewTicker(idlePoll)
+	defer ticker.Stop()
+
+	events := input.Subscribe(attractCfg)
+	defer input.Unsubscribe(events)
+	for {
+		select {
+		case <-stop:
+			return nil
+		case now := <-ticker.C:
+			if attract.Running() || !idle.enabled() {
+				// idle time counts from when attract mode stops
+				idle.activity(now)
+				continue
+			}
+			core, _, _ := d.tracker.Current()
+			idle.setCore(core, now)
+			if idle.due(now) {
+				d.logger.Info("idle for %s, starting attract mode", idle.timeout)
+				if err := d.startAttract(); err != nil {
+					d.logger.Error("attract mode not started: %s", err)
+				}
+				idle.activity(now)
+			}
+		case ev, ok := <-events:
+			if !ok {
+				// the task is restarted, which starts the listeners again
+				return fmt.Errorf("input events stopped")
+			}
+			if !bindings.Enabled(ev.Device) {
+				continue
+			}
+			idle.activity(time.Now())
+			// a paused attract mode belongs to whoever paused it, like
+			// the games menu being browsed
+			if !attract.Running() || attract.Paused() {
+				continue
+			}
+
+			action, _ := bindings.Action(ev)
+			switch strings.ToLower(action) {
+			case "next":
+				attract.Next()
+			case "back":
+				attract.Back()
+			default:
+				d.logger.Info("input from %s, stopping attract mode", ev.Device)
+				d.stopAttract()
+				if attractCfg.Attract.ExitToMenu {
+					if err := mister.LaunchMenu(); err != nil {
+						d.logger.Error("failed to return to menu: %s", err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// readNfc launches tags put on the NFC reader, stopping attract mode first
+// so it doesn't replace the game. A reader which isn't plugged in yet, or is
+// unplugged, is opened again by the nfc service itself.
+func (d *daemon) readNfc(stop <-chan struct{}) error {
+	var kbd *virtualinput.Keyboard
+	if k, err := virtualinput.NewKeyboard(virtualinput.DefaultTimeout); err != nil {
+		d.logger.Warn("no virtual keyboard, NFC key commands are disabled: %s", err)
+	} else {
+		kbd = &k
+		defer kbd.Close()
+	}
+
+	svc := nfc.NewService(d.config(), nil, kbd)
+	launch := svc.Launch
+	svc.Launch = func(text string) error {
+		d.stopAttract()
+		return launch(text)
+	}
+	return svc.Run(stop)
+}
+
+// --------------------------------------------------
+// Control methods
+// --------------------------------------------------
+
+func (d *daemon) handlers() map[string]control.Handler {
+	return map[string]control.Handler{
+		control.MethodLaunch:       d.controlLaunch,
+		control.MethodStatus:       d.controlStatus,
+		control.MethodPlaying:      d.controlPlaying,
+		control.MethodAttractStart: func(json.RawMessage) (any, error) { return nil, d.startAttract() },
+		control.MethodAttractStop: func(json.RawMessage) (any, error) {
+			d.stopAttract()
+			return nil, nil
+		},
+		control.MethodAttractPause: func(json.RawMessage) (any, error) {
+			return attract.Pause(), nil
+		},
+		control.MethodAttractResume: func(json.RawMessage) (any, error) {
+			return attract.Resume(), nil
+		},
+		control.MethodVolume:       d.controlVolume,
+		control.MethodBgmNext:      d.controlBgmNext,
+		control.MethodReloadConfig: d.controlReloadConfig,
+	}
+}
+
+// controlLaunch launches a game for a foreground command, stopping attract
+// mode first so it doesn't replace the game a moment later.
+func (d *daemon) controlLaunch(params json.RawMessage) (any, error) {
+	var p control.LaunchParams
+	if err := control.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Path == "" {
+		return nil, control.InvalidParams(fmt.Errorf("no path to launch"))
+	}
+
+	d.stopAttract()
+	d.logger.Info("launching %s", p.Path)
+
+	if p.System != "" {
+		system, err := games.LookupSystem(p.System)
+		if err != nil {
+			return nil, err
+		}
+		return nil, mister.LaunchGenericFileAs(d.config(), *system, p.Path)
+	}
+	return nil, mister.LaunchGenericFile(d.config(), p.Path)
+}
+
+func (d *daemon) controlStatus(json.RawMessage) (any, error) {
+	status := control.Status{Attract: attract.Running(), Paused: attract.Paused()}
+	if core, err := mister.GetActiveCoreName(); err == nil {
+		status.Core = strings.TrimSpace(core)
+	}
+	if ev, ok := mister.NowPlaying(); ok {
+		status.Path = ev.Path
+	}
+	return status, nil
+}
+
+// controlPlaying reports what the play log last saw running, which includes
+// games started from the OSD.
+func (d *daemon) controlPlaying(json.RawMessage) (any, error) {
+	core, game, started := d.tracker.Current()
+	playing := control.Playing{Core: core, Path: game, Started: started}
+	if ev, ok := mister.NowPlaying(); ok && ev.Path == game {
+		playing.System = ev.SystemId
+	}
+	return playing, nil
+}
+
+// controlVolume sets MiSTer's master volume, which is what bgm changes
+// between the menu and cores too.
+func (d *daemon) controlVolume(params json.RawMessage) (any, error) {
+	var p control.VolumeParams
+	if err := control.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Level < 0 || p.Level > mister.MaxVolume {
+		return nil, control.InvalidParams(fmt.Errorf("level must be 0 to %d", mister.MaxVolume))
+	}
+	return nil, mister.SetVolume(p.Level)
+}
+
+// controlBgmNext asks the bgm player to skip its current track. bgm is its
+// own program, it skips on SIGUSR1.
+func (d *daemon) controlBgmNext(json.RawMessage) (any, error) {
+	data, err := os.ReadFile(fmt.Sprintf(config.PidFileTemplate, "bgm"))
+	if err != nil {
+		return nil, fmt.Errorf("bgm is not running")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bgm pid file: %w", err)
+	}
+	if err := syscall.Kill(pid, syscall.SIGUSR1); err != nil {
+		return nil, fmt.Errorf("bgm is not running: %w", err)
+	}
+	return nil, nil
+}
+
+// controlReloadConfig reads SAM.ini again. Launches and attract mode use
+// the new settings from when they next start, and the input listener is
+// restarted with the new bindings and idle settings. The API keeps the
+// settings it started with.
+func (d *daemon) controlReloadConfig(json.RawMessage) (any, error) {
+	cfg, err := config.LoadUserConfig("SAM", &config.UserConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload config: %w", err)
+	}
+	attractCfg, err := config.LoadINI()
+	if attractCfg == nil {
+		return nil, fmt.Errorf("failed to reload config: %w", err)
+	}
+
+	d.cfgMu.Lock()
+	d.cfg = cfg
+	d.cfgMu.Unlock()
+	d.tracker.SetConfig(cfg.PlayLog)
+	if err := d.tasks.Restart(inputsTask, d.inputs(attractCfg)); err != nil {
+		d.logger.Error("input listener not restarted: %s", err)
+	}
+	d.logger.Info("reloaded config from %s", cfg.IniPath)
+	return nil, nil
+}
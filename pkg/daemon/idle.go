@@ -0,0 +1,72 @@
+package daemon
+
+import (
+	"strings"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+// idlePoll is how often the running core is checked for the idle timeout.
+const idlePoll = time.Second
+
+// idleWatcher decides when the MiSTer has sat idle long enough to start
+// attract mode, from the idle settings in [Attract]. Inputs and core changes
+// both count as activity.
+type idleWatcher struct {
+	timeout    time.Duration
+	inCores    bool
+	exempt     []string
+	core       string
+	lastActive time.Time
+}
+
+func newIdleWatcher(cfg config.AttractConfig, now time.Time) *idleWatcher {
+	return &idleWatcher{
+		timeout:    time.Duration(cfg.IdleTimeout) * time.Second,
+		inCores:    cfg.IdleInCores,
+		exempt:     cfg.IdleExempt,
+		lastActive: now,
+	}
+}
+
+func (w *idleWatcher) enabled() bool {
+	return w.timeout > 0
+}
+
+// activity restarts the idle time.
+func (w *idleWatcher) activity(now time.Time) {
+	w.lastActive = now
+}
+
+// setCore records the running core. Loading a different one is activity.
+func (w *idleWatcher) setCore(core string, now time.Time) {
+	if core != w.core {
+		w.core = core
+		w.lastActive = now
+	}
+}
+
+func (w *idleWatcher) inMenu() bool {
+	return w.core == "" || w.core == config.MenuCore
+}
+
+func (w *idleWatcher) isExempt() bool {
+	for _, name := range w.exempt {
+		if strings.EqualFold(strings.TrimSpace(name), w.core) {
+			return true
+		}
+	}
+	return false
+}
+
+// due reports whether attract mode should start now.
+func (w *idleWatcher) due(now time.Time) bool {
+	if !w.enabled() || now.Sub(w.lastActive) < w.timeout {
+		return false
+	}
+	if w.inMenu() {
+		return true
+	}
+	return w.inCores && !w.isExempt()
+}
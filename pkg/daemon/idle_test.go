@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+func TestIdleWatcher(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(secs int) time.Time {
+		return start.Add(time.Duration(secs) * time.Second)
+	}
+
+	tests := []struct {
+		name  string
+		cfg   config.AttractConfig
+		steps func(w *idleWatcher)
+		now   int
+		want  bool
+	}{
+		{
+			name: "disabled",
+			cfg:  config.AttractConfig{},
+			steps: func(w *idleWatcher) {
+				w.setCore("MENU", at(0))
+			},
+			now:  1000,
+			want: false,
+		},
+		{
+			name: "idle in menu",
+			cfg:  config.AttractConfig{IdleTimeout: 60},
+			steps: func(w *idleWatcher) {
+				w.setCore("MENU", at(0))
+			},
+			now:  60,
+			want: true,
+		},
+		{
+			name: "not idle long enough",
+			cfg:  config.AttractConfig{IdleTimeout: 60},
+			steps: func(w *idleWatcher) {
+				w.setCore("MENU", at(0))
+			},
+			now:  59,
+			want: false,
+		},
+		{
+			name: "input restarts idle time",
+			cfg:  config.AttractConfig{IdleTimeout: 60},
+			steps: func(w *idleWatcher) {
+				w.setCore("MENU", at(0))
+				w.activity(at(30))
+			},
+			now:  80,
+			want: false,
+		},
+		{
+			name: "core change restarts idle time",
+			cfg:  config.AttractConfig{IdleTimeout: 60},
+			steps: func(w *idleWatcher) {
+				w.setCore("SNES", at(0))
+				w.setCore("MENU", at(30))
+			},
+			now:  80,
+			want: false,
+		},
+		{
+			name: "same core isn't activity",
+			cfg:  config.AttractConfig{IdleTimeout: 60},
+			steps: func(w *idleWatcher) {
+				w.setCore("MENU", at(0))
+				w.setCore("MENU", at(30))
+			},
+			now:  60,
+			want: true,
+		},
+		{
+			name: "core ignored by default",
+			cfg:  config.AttractConfig{IdleTimeout: 60},
+			steps: func(w *idleWatcher) {
+				w.setCore("SNES", at(0))
+			},
+			now:  600,
+			want: false,
+		},
+		{
+			name: "idle in core",
+			cfg:  config.AttractConfig{IdleTimeout: 60, IdleInCores: true},
+			steps: func(w *idleWatcher) {
+				w.setCore("SNES", at(0))
+			},
+			now:  60,
+			want: true,
+		},
+		{
+			name: "exempt core",
+			cfg: config.AttractConfig{
+				IdleTimeout: 60,
+				IdleInCores: true,
+				IdleExempt:  []string{"ao486", " Minimig"},
+			},
+			steps: func(w *idleWatcher) {
+				w.setCore("minimig", at(0))
+			},
+			now:  600,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newIdleWatcher(tt.cfg, start)
+			tt.steps(w)
+			if got := w.due(at(tt.now)); got != tt.want {
+				t.Errorf("due = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
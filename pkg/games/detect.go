@@ -0,0 +1,289 @@
+package games
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/romheader"
+	"github.com/synrais/SAM-GO/pkg/utils"
+)
+
+// System detection scores each system a file could belong to. Each kind of
+// evidence adds to (or takes from) a system's score, and the highest score
+// wins. A file is detected confidently when only one system matches or the
+// best is well ahead of the next, otherwise the user should be asked.
+const (
+	scoreFolder = 40 // in one of the system's games folders
+	scoreExt    = 20 // extension is one of the system's
+	scoreZip    = 15 // zip contains a file with one of the system's extensions
+	scoreHeader = 40 // ROM header is the system's
+	scoreSize   = 30 // file too big for the system, subtracted
+
+	confidentMargin = 20
+)
+
+type Candidate struct {
+	System  System
+	Score   int
+	Reasons []string
+}
+
+func (c *Candidate) add(score int, reason string) {
+	c.Score += score
+	c.Reasons = append(c.Reasons, fmt.Sprintf("%s %+d", reason, score))
+}
+
+// Detection is a list of candidate systems, best first.
+type Detection []Candidate
+
+// Best returns the highest scoring system.
+func (d Detection) Best() (System, bool) {
+	if len(d) == 0 {
+		return System{}, false
+	}
+	return d[0].System, true
+}
+
+// Confident reports whether the best system is clear enough to use without
+// asking.
+func (d Detection) Confident() bool {
+	switch len(d) {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		return d[0].Score-d[1].Score >= confidentMargin
+	}
+}
+
+// romInfo is what's read from a file for detection. Files inside zips are
+// read from the zip, either the member in the path (game.zip/game.nes) or
+// the first member with a known extension.
+type romInfo struct {
+	name   string
+	size   int64
+	header *romheader.Header
+	inZip  bool
+}
+
+func splitZipPath(path string) (string, string) {
+	lower := strings.ToLower(path)
+	if i := strings.Index(lower, ".zip/"); i != -1 {
+		return path[:i+4], path[i+5:]
+	}
+	return path, ""
+}
+
+func readRomInfo(path string) (*romInfo, error) {
+	info := &romInfo{name: filepath.Base(path)}
+
+	var r io.ReadCloser
+	zipPath, member := splitZipPath(path)
+	if member == "" && !utils.IsZip(path) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		r, info.size = f, stat.Size()
+	} else {
+		info.inZip = true
+		if member == "" {
+			files, err := utils.ListZip(zipPath)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range files {
+				if !strings.HasSuffix(name, "/") && len(extSystems(name)) > 0 {
+					member = name
+					break
+				}
+			}
+			if member == "" {
+				return info, nil
+			}
+		}
+
+		rc, size, err := utils.OpenZipFile(zipPath, member)
+		if err != nil {
+			return nil, err
+		}
+		r, info.size, info.name = rc, size, member
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, romheader.ReadSize))
+	if err != nil {
+		return nil, err
+	}
+	info.header, _ = romheader.Parse(data, info.size)
+
+	return info, nil
+}
+
+// extSystems returns the IDs of systems with a slot for a file's extension.
+func extSystems(name string) map[string]bool {
+	ids := make(map[string]bool)
+	for id, system := range Systems {
+		if MatchSystemFile(system, name) {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// inSystemFolder reports whether a path is inside one of the system's
+// folders in a games folder.
+func inSystemFolder(gamesFolders []string, system System, path string) bool {
+	path = strings.ToLower(path)
+	for _, gf := range gamesFolders {
+		for _, folder := range system.Folder {
+			systemPath := strings.ToLower(filepath.Join(gf, folder))
+			if strings.HasPrefix(path, systemPath+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DetectSystem scores every system a file could belong to by its folder,
+// extension, zip contents, ROM header and size. Systems with no evidence
+// at all aren't included, and it's an error if that leaves none.
+func DetectSystem(cfg *config.UserConfig, path string) (Detection, error) {
+	gamesFolders := GetGamesFolders(cfg)
+
+	rom, err := readRomInfo(path)
+	if err != nil {
+		// nothing to read, e.g. a folder, so go on folders and names alone
+		rom = &romInfo{name: filepath.Base(path)}
+	}
+
+	var zipExts map[string]bool
+	if rom.inZip && rom.name != filepath.Base(path) {
+		zipExts = extSystems(rom.name)
+	}
+
+	var detection Detection
+	for _, system := range Systems {
+		c := Candidate{System: system}
+		evidence := false
+
+		if inSystemFolder(gamesFolders, system, path) {
+			c.add(scoreFolder, "folder")
+			evidence = true
+		}
+		if MatchSystemFile(system, path) {
+			c.add(scoreExt, "extension")
+			evidence = true
+		}
+		if zipExts[system.Id] {
+			c.add(scoreZip, "zip contents")
+			evidence = true
+		}
+		if score := headerScore(system, rom.header); score != 0 {
+			c.add(score, "header")
+			evidence = evidence || score > 0
+		}
+		if max, ok := maxRomSizes[system.Id]; ok && rom.size > max {
+			c.add(-scoreSize, "size")
+		}
+
+		if evidence && c.Score > 0 {
+			detection = append(detection, c)
+		}
+	}
+
+	sort.Slice(detection, func(i, j int) bool {
+		a, b := detection[i], detection[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		// prefer the system with a setname, like a GBC game in the
+		// Gameboy folder
+		if (a.System.SetName != "") != (b.System.SetName != "") {
+			return a.System.SetName != ""
+		}
+		return a.System.Id < b.System.Id
+	})
+
+	if len(detection) == 0 {
+		return nil, fmt.Errorf("no systems found for %s", path)
+	}
+	return detection, nil
+}
+
+// --------------------------------------------------
+// ROM headers
+// --------------------------------------------------
+
+// headerCompat lists cores which run another system's games, so a header
+// for that system is evidence for them too.
+var headerCompat = map[string][]string{
+	"Gameboy2P":    {"Gameboy", "GameboyColor"},
+	"SuperGameboy": {"Gameboy"},
+	"GBA2P":        {"GBA"},
+}
+
+// headerSystems are the systems romheader can identify. A header for some
+// other system is evidence against them.
+var headerSystems = map[string]bool{
+	"NES": true, "FDS": true, "NESMusic": true, "SNES": true, "Gameboy": true, "GameboyColor": true,
+	"Gameboy2P": true, "SuperGameboy": true, "GBA": true, "GBA2P": true,
+	"MegaDrive": true, "Sega32X": true, "MasterSystem": true,
+	"GameGear": true, "Nintendo64": true,
+}
+
+// headerScore scores how well a ROM header matches a system.
+func headerScore(system System, hdr *romheader.Header) int {
+	if hdr == nil {
+		return 0
+	}
+
+	ids := append([]string{hdr.SystemId}, hdr.AltSystems...)
+	if system.Id == hdr.SystemId {
+		return scoreHeader
+	}
+	if utils.Contains(hdr.AltSystems, system.Id) {
+		return scoreHeader / 2
+	}
+	for _, id := range headerCompat[system.Id] {
+		if utils.Contains(ids, id) {
+			return scoreHeader / 2
+		}
+	}
+	if headerSystems[system.Id] {
+		return -scoreHeader / 2
+	}
+	return 0
+}
+
+// maxRomSizes are sizes no cartridge for a system comes close to, with room
+// for homebrew and headers. Bigger files are probably for something else.
+var maxRomSizes = map[string]int64{
+	"NES":          8 << 20,
+	"Gameboy":      8 << 20,
+	"GameboyColor": 8 << 20,
+	"Gameboy2P":    8 << 20,
+	"SuperGameboy": 8 << 20,
+	"GBA":          32 << 20,
+	"GBA2P":        32 << 20,
+	"SNES":         12 << 20,
+	"MegaDrive":    16 << 20,
+	"Sega32X":      8 << 20,
+	"MasterSystem": 4 << 20,
+	"GameGear":     4 << 20,
+	"SG1000":       1 << 20,
+	"TurboGrafx16": 4 << 20,
+	"Atari2600":    1 << 20,
+}
@@ -0,0 +1,151 @@
+package games
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+func gbRom(cgbFlag byte) []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x104:], []byte{0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B})
+	rom[0x143] = cgbFlag
+	return rom
+}
+
+func megaDriveRom(system string) []byte {
+	rom := make([]byte, 0x200)
+	copy(rom[0x100:], system)
+	return rom
+}
+
+func writeFile(t *testing.T, path string, data []byte) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeZip(t *testing.T, path string, name string, data []byte) string {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func scores(d Detection) string {
+	var out []string
+	for _, c := range d {
+		out = append(out, fmt.Sprintf("%s=%d", c.System.Id, c.Score))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestDetectSystem(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.UserConfig{Systems: config.SystemsConfig{GamesFolder: []string{dir}}}
+	games := filepath.Join(dir, "games")
+
+	tests := []struct {
+		name      string
+		path      string
+		want      string
+		confident bool
+	}{
+		{
+			"gb in gameboy folder",
+			writeFile(t, filepath.Join(games, "GAMEBOY", "a.gb"), gbRom(0x00)),
+			"Gameboy", true,
+		},
+		{
+			"colour only game named .gb",
+			writeFile(t, filepath.Join(games, "GAMEBOY", "b.gb"), gbRom(0xC0)),
+			"GameboyColor", true,
+		},
+		{
+			"gbc in gameboy folder",
+			writeFile(t, filepath.Join(games, "GAMEBOY", "c.gbc"), gbRom(0xC0)),
+			"GameboyColor", true,
+		},
+		{
+			"gameboy 2p folder",
+			writeFile(t, filepath.Join(games, "GAMEBOY2P", "d.gb"), gbRom(0x00)),
+			"Gameboy2P", true,
+		},
+		{
+			// header says 32X, folder says Mega Drive
+			"32x rom in the genesis folder",
+			writeFile(t, filepath.Join(games, "Genesis", "e.bin"), megaDriveRom("SEGA 32X")),
+			"MegaDrive", false,
+		},
+		{
+			"mega drive rom",
+			writeFile(t, filepath.Join(games, "Genesis", "f.md"), megaDriveRom("SEGA MEGA DRIVE")),
+			"MegaDrive", true,
+		},
+		{
+			"ines outside a games folder",
+			writeFile(t, filepath.Join(dir, "other", "g.nes"), append([]byte("NES\x1a"), make([]byte, 16)...)),
+			"NES", true,
+		},
+		{
+			// header says NSF, folder and extension fit either
+			"nsf in the nes folder",
+			writeFile(t, filepath.Join(games, "NES", "i.bin"), append([]byte("NESM\x1a"), make([]byte, 0x80)...)),
+			"NESMusic", true,
+		},
+		{
+			"fds disk outside a games folder",
+			writeFile(t, filepath.Join(dir, "other", "j.bin"), append([]byte("\x01*NINTENDO-HVC*"), make([]byte, 0x40)...)),
+			"FDS", true,
+		},
+		{
+			"zip contents",
+			writeZip(t, filepath.Join(dir, "h.zip"), "h.sfc", make([]byte, 0x8000)),
+			"SNES", true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detection, err := DetectSystem(cfg, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			best, _ := detection.Best()
+			if best.Id != tt.want {
+				t.Errorf("best = %s, want %s (%s)", best.Id, tt.want, scores(detection))
+			}
+			if detection.Confident() != tt.confident {
+				t.Errorf("confident = %v, want %v (%s)", detection.Confident(), tt.confident, scores(detection))
+			}
+		})
+	}
+
+	if _, err := DetectSystem(cfg, filepath.Join(dir, "unknown.xyz")); err == nil {
+		t.Error("expected error for unknown file")
+	}
+}
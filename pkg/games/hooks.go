@@ -1,7 +1,6 @@
 package games
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -41,134 +40,105 @@ func copySetnameBios(cfg *config.UserConfig, origSystem System, newSystem System
 	return utils.CopyFile(biosPath, filepath.Join(newFolder, name))
 }
 
-func hookFDS(cfg *config.UserConfig, system System, _ string) (string, error) {
+func hookFDS(cfg *config.UserConfig, system System, _ string) (*MglOverride, error) {
 	nesSystem, err := GetSystem("NES")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return "", copySetnameBios(cfg, *nesSystem, system, "boot0.rom")
+	return nil, copySetnameBios(cfg, *nesSystem, system, "boot0.rom")
 }
 
-func hookWSC(cfg *config.UserConfig, system System, _ string) (string, error) {
+func hookWSC(cfg *config.UserConfig, system System, _ string) (*MglOverride, error) {
 	wsSystem, err := GetSystem("WonderSwan")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	err = copySetnameBios(cfg, *wsSystem, system, "boot.rom")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return "", copySetnameBios(cfg, *wsSystem, system, "boot1.rom")
+	return nil, copySetnameBios(cfg, *wsSystem, system, "boot1.rom")
 }
 
-func hookAo486(_ *config.UserConfig, system System, path string) (string, error) {
+func hookAo486(_ *config.UserConfig, system System, path string) (*MglOverride, error) {
 	mglDef, err := PathToMglDef(system, path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var mgl string
-
 	if !strings.HasSuffix(strings.ToLower(path), ".vhd") {
-		return "", nil
+		return nil, nil
 	}
 
 	dir := filepath.Dir(path)
 	filename := filepath.Base(path)
+	override := &MglOverride{ResetDelay: 1}
 
 	// exception for Top 300 pack which uses 2 disks
 	if strings.HasSuffix(path, "IDE 0-1 Top 300 DOS Games.vhd") {
-		mgl += fmt.Sprintf(
-			"\t<file delay=\"%d\" type=\"%s\" index=\"%d\" path=\"../../../../..%s\"/>\n",
-			mglDef.Delay,
-			mglDef.Method,
-			mglDef.Index,
-			filepath.Join(dir, "IDE 0-0 BOOT-DOS98.vhd"),
-		)
-
-		mgl += fmt.Sprintf(
-			"\t<file delay=\"%d\" type=\"%s\" index=\"%d\" path=\"../../../../..%s\"/>\n",
-			mglDef.Delay,
-			mglDef.Method,
-			mglDef.Index+1,
-			path,
-		)
-
-		mgl += "\t<reset delay=\"1\"/>\n"
-
-		return mgl, nil
+		second := *mglDef
+		second.Index++
+		override.Files = []MglFile{
+			{MglParams: *mglDef, Path: filepath.Join(dir, "IDE 0-0 BOOT-DOS98.vhd")},
+			{MglParams: second, Path: path},
+		}
+		return override, nil
 	}
 
 	files, err := os.ReadDir(dir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// if there's an iso in the same folder, mount it too
 	for _, file := range files {
 		if (strings.HasSuffix(strings.ToLower(file.Name()), ".iso") || strings.HasSuffix(strings.ToLower(file.Name()), ".chd")) && file.Name() != filename {
-			mgl += fmt.Sprintf(
-				"\t<file delay=\"%d\" type=\"%s\" index=\"%d\" path=\"../../../../..%s\"/>\n",
-				mglDef.Delay,
-				mglDef.Method,
-				4,
-				filepath.Join(dir, file.Name()),
-			)
+			cd := *mglDef
+			cd.Index = 4
+			override.Files = append(override.Files, MglFile{MglParams: cd, Path: filepath.Join(dir, file.Name())})
 			break
 		}
 	}
 
-	mgl += fmt.Sprintf(
-		"\t<file delay=\"%d\" type=\"%s\" index=\"%d\" path=\"../../../../..%s\"/>\n",
-		mglDef.Delay,
-		mglDef.Method,
-		mglDef.Index,
-		path,
-	)
-
-	mgl += "\t<reset delay=\"1\"/>\n"
+	override.Files = append(override.Files, MglFile{MglParams: *mglDef, Path: path})
 
-	return mgl, nil
+	return override, nil
 }
 
-func hookAmiga(_ *config.UserConfig, system System, path string) (string, error) {
+func hookAmiga(_ *config.UserConfig, system System, path string) (*MglOverride, error) {
 	if !strings.HasSuffix(strings.ToLower(filepath.Dir(path)), "listings/games.txt") && !strings.HasSuffix(strings.ToLower(filepath.Dir(path)), "listings/demos.txt") {
-		return "", nil
+		return nil, nil
 	}
 
 	gameName := filepath.Base(path)
 	sharedPath, err := filepath.Abs(filepath.Join(filepath.Dir(path), "..", "..", "shared"))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	bootFile := filepath.Join(sharedPath, "ags_boot")
 	if err := os.WriteFile(bootFile, []byte(gameName+"\n"), 0644); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return "\t<setname>Amiga</setname>\n", nil
+	return &MglOverride{SetName: "Amiga"}, nil
 }
 
-func hookNeoGeo(_ *config.UserConfig, _ System, path string) (string, error) {
+func hookNeoGeo(_ *config.UserConfig, _ System, path string) (*MglOverride, error) {
 	// neogeo core allows launching zips and folders
 	if strings.HasSuffix(strings.ToLower(path), ".zip") || filepath.Ext(path) == "" {
-		return fmt.Sprintf(
-			"\t<file delay=\"%d\" type=\"%s\" index=\"%d\" path=\"../../../../..%s\"/>\n",
-			1,
-			"f",
-			1,
-			path,
-		), nil
+		return &MglOverride{
+			Files: []MglFile{{MglParams: MglParams{Delay: 1, Method: "f", Index: 1}, Path: path}},
+		}, nil
 	}
 
-	return "", nil
+	return nil, nil
 }
 
-var systemHooks = map[string]func(*config.UserConfig, System, string) (string, error){
+var systemHooks = map[string]func(*config.UserConfig, System, string) (*MglOverride, error){
 	"FDS":             hookFDS,
 	"WonderSwanColor": hookWSC,
 	"ao486":           hookAo486,
@@ -176,10 +146,18 @@ var systemHooks = map[string]func(*config.UserConfig, System, string) (string, e
 	"NeoGeo":          hookNeoGeo,
 }
 
-func RunSystemHook(cfg *config.UserConfig, system System, path string) (string, error) {
+// HasSystemHook reports whether a system has setup to run before a launch.
+func HasSystemHook(systemId string) bool {
+	_, ok := systemHooks[systemId]
+	return ok
+}
+
+// RunSystemHook runs any setup a system needs before launching path. It
+// returns a non-nil override when the MGL needs to differ from the default.
+func RunSystemHook(cfg *config.UserConfig, system System, path string) (*MglOverride, error) {
 	if hook, ok := systemHooks[system.Id]; ok {
 		return hook(cfg, system, path)
 	}
 
-	return "", nil
+	return nil, nil
 }
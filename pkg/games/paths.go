@@ -96,40 +96,15 @@ func FolderToSystems(cfg *config.UserConfig, path string) []System {
 	return matchedExtensions
 }
 
+// BestSystemMatch returns the most likely system for a file. Use
+// DetectSystem to also find out how likely it is.
 func BestSystemMatch(cfg *config.UserConfig, path string) (System, error) {
-	systems := FolderToSystems(cfg, path)
-
-	if len(systems) == 0 {
-		return System{}, fmt.Errorf("no systems found for %s", path)
-	}
-
-	if len(systems) == 1 {
-		return systems[0], nil
-	}
-
-	// check for system matches by file extension if possible
-	if filepath.Ext(path) != "" {
-		filtered := []System{}
-		for _, system := range systems {
-			if MatchSystemFile(system, path) {
-				filtered = append(filtered, system)
-			}
-		}
-
-		if len(filtered) > 0 {
-			systems = filtered
-		}
-	}
-
-	// prefer the system with a setname
-	for _, system := range systems {
-		if system.SetName != "" {
-			return system, nil
-		}
+	detection, err := DetectSystem(cfg, path)
+	if err != nil {
+		return System{}, err
 	}
-
-	// otherwise just return the first one
-	return systems[0], nil
+	system, _ := detection.Best()
+	return system, nil
 }
 
 type PathResult struct {
@@ -54,6 +54,21 @@ type MglParams struct {
 	Index  int
 }
 
+// MglFile is a file to mount in a generated MGL.
+type MglFile struct {
+	MglParams
+	Path string // absolute
+}
+
+// MglOverride is returned by system hooks which need a different MGL than
+// the default single file entry. When set, its files replace the default
+// entry entirely, so an override with no files launches the core alone.
+type MglOverride struct {
+	SetName    string
+	Files      []MglFile
+	ResetDelay int // reset the core this many seconds after loading, 0 for none
+}
+
 type Slot struct {
 	Label string
 	Exts  []string
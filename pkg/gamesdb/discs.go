@@ -0,0 +1,225 @@
+package gamesdb
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CD games which come on several discs are indexed as one game, a disc set.
+// Sets are found from .m3u playlists next to the discs, or failing that by
+// "(Disc N)" in the file names. The set's Path is the first disc, so
+// launching it starts from the beginning.
+
+// DiscSystems are the systems whose games can be disc sets.
+var DiscSystems = map[string]bool{
+	"PSX":            true,
+	"Saturn":         true,
+	"MegaCD":         true,
+	"TurboGrafx16CD": true,
+	"NeoGeoCD":       true,
+}
+
+var discRe = regexp.MustCompile(`(?i)\s*[(\[](?:disc|disk|cd)\s*([0-9]+)(?:\s*of\s*[0-9]+)?[)\]]`)
+
+// DiscNumber returns the disc number in a file name, or 0 if it has none.
+func DiscNumber(path string) int {
+	m := discRe.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// stripDiscTag removes the disc number from a name, leaving the set's name.
+func stripDiscTag(name string) string {
+	return strings.TrimSpace(discRe.ReplaceAllString(name, ""))
+}
+
+// ReadM3U returns the absolute paths of the files in a playlist. Paths in
+// the playlist are relative to it unless absolute.
+func ReadM3U(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = filepath.FromSlash(strings.ReplaceAll(line, "\\", "/"))
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(path), line)
+		}
+		files = append(files, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	return files, nil
+}
+
+// WriteM3U writes a playlist of discs, relative to the playlist where they
+// can be.
+func WriteM3U(path string, discs []string) error {
+	var b strings.Builder
+	for _, disc := range discs {
+		if rel, err := filepath.Rel(filepath.Dir(path), disc); err == nil && !strings.HasPrefix(rel, "..") {
+			disc = rel
+		}
+		b.WriteString(filepath.ToSlash(disc) + "\n")
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// newDiscSet makes a single FileInfo for a set from the FileInfos of its
+// discs, in order.
+func newDiscSet(name string, discs []FileInfo, playlist string) FileInfo {
+	set := discs[0]
+	set.Name = name
+	set.Playlist = playlist
+	for _, d := range discs {
+		set.Discs = append(set.Discs, d.Path)
+	}
+
+	display := name
+	if set.Ext != "" {
+		display += "." + set.Ext
+	}
+	if i := strings.LastIndex(set.MenuPath, "/"); i != -1 {
+		set.MenuPath = set.MenuPath[:i+1] + display
+	} else {
+		set.MenuPath = display
+	}
+	return set
+}
+
+// collapseDiscSets replaces the discs of each set in a system's files with
+// one FileInfo for the whole set.
+func collapseDiscSets(files []FileInfo) []FileInfo {
+	byPath := make(map[string]int, len(files))
+	dirs := make(map[string]bool)
+	for i, f := range files {
+		byPath[f.Path] = i
+		dirs[filepath.Dir(f.Path)] = true
+	}
+	used := make(map[int]bool)
+	var sets []FileInfo
+
+	// playlists first, they give the exact discs and order
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".m3u") {
+				continue
+			}
+			playlist := filepath.Join(dir, e.Name())
+			paths, err := ReadM3U(playlist)
+			if err != nil {
+				continue
+			}
+
+			var discs []FileInfo
+			for _, p := range paths {
+				if i, ok := byPath[p]; ok && !used[i] {
+					discs = append(discs, files[i])
+					used[i] = true
+				}
+			}
+			if len(discs) > 0 {
+				name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+				sets = append(sets, newDiscSet(name, discs, playlist))
+			}
+		}
+	}
+
+	// then anything named as a disc, grouped by folder and name
+	groups := make(map[string][]int)
+	var keys []string
+	for i, f := range files {
+		if used[i] || DiscNumber(f.Path) == 0 {
+			continue
+		}
+		key := strings.ToLower(filepath.Join(filepath.Dir(f.Path), stripDiscTag(f.Name)))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	for _, key := range keys {
+		idx := groups[key]
+		if len(idx) < 2 {
+			continue
+		}
+		sort.SliceStable(idx, func(a, b int) bool {
+			return DiscNumber(files[idx[a]].Path) < DiscNumber(files[idx[b]].Path)
+		})
+
+		var discs []FileInfo
+		seen := make(map[int]bool)
+		for _, i := range idx {
+			// the same disc as both .cue and .chd only counts once
+			n := DiscNumber(files[i].Path)
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			discs = append(discs, files[i])
+		}
+		for _, i := range idx {
+			used[i] = true
+		}
+		sets = append(sets, newDiscSet(stripDiscTag(discs[0].Name), discs, ""))
+	}
+
+	if len(sets) == 0 {
+		return files
+	}
+
+	out := make([]FileInfo, 0, len(files)-len(used)+len(sets))
+	for i, f := range files {
+		if !used[i] {
+			out = append(out, f)
+		}
+	}
+	sort.SliceStable(sets, func(a, b int) bool { return sets[a].Path < sets[b].Path })
+	return append(out, sets...)
+}
+
+// GenerateM3Us writes a playlist next to every disc set which doesn't have
+// one, and returns how many were written. Sets in zips are skipped.
+func GenerateM3Us(files []FileInfo) (int, error) {
+	written := 0
+	for _, f := range files {
+		if len(f.Discs) < 2 || f.Playlist != "" {
+			continue
+		}
+		if strings.Contains(strings.ToLower(f.Path), ".zip/") {
+			continue
+		}
+
+		path := filepath.Join(filepath.Dir(f.Path), f.Name+".m3u")
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := WriteM3U(path, f.Discs); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
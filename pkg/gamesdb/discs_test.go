@@ -0,0 +1,138 @@
+package gamesdb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscNumber(t *testing.T) {
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/games/PSX/Game (USA) (Disc 1).chd", 1},
+		{"/games/PSX/Game (USA) (Disc 2 of 3).cue", 2},
+		{"/games/PSX/Game [CD2].chd", 2},
+		{"/games/PSX/Game (USA).chd", 0},
+		{"/games/PSX/Discworld (USA).chd", 0},
+	}
+
+	for _, tt := range tests {
+		if got := DiscNumber(tt.path); got != tt.want {
+			t.Errorf("DiscNumber(%q) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
+// discFiles creates empty files in dir and returns FileInfos for them, like
+// NewNamesIndex would.
+func discFiles(t *testing.T, dir string, names ...string) []FileInfo {
+	t.Helper()
+	var files []FileInfo
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		ext := filepath.Ext(name)
+		files = append(files, FileInfo{
+			SystemId: "PSX",
+			Name:     strings.TrimSuffix(name, ext),
+			Ext:      strings.TrimPrefix(ext, "."),
+			Path:     path,
+			MenuPath: "PSX/" + name,
+		})
+	}
+	return files
+}
+
+func TestCollapseDiscSetsByName(t *testing.T) {
+	dir := t.TempDir()
+	files := discFiles(t, dir,
+		"Game (USA) (Disc 2).chd",
+		"Game (USA) (Disc 1).chd",
+		"Game (USA) (Disc 1).cue",
+		"Other (USA).chd",
+		"Lonely (USA) (Disc 1).chd",
+	)
+
+	got := collapseDiscSets(files)
+	if len(got) != 3 {
+		t.Fatalf("got %d files, want 3", len(got))
+	}
+
+	set := got[len(got)-1]
+	if set.Name != "Game (USA)" {
+		t.Errorf("set name = %q", set.Name)
+	}
+	if set.MenuPath != "PSX/Game (USA).chd" {
+		t.Errorf("set menu path = %q", set.MenuPath)
+	}
+	want := []string{
+		filepath.Join(dir, "Game (USA) (Disc 1).chd"),
+		filepath.Join(dir, "Game (USA) (Disc 2).chd"),
+	}
+	if !reflect.DeepEqual(set.Discs, want) {
+		t.Errorf("discs = %v, want %v", set.Discs, want)
+	}
+	if set.Path != want[0] {
+		t.Errorf("set path = %q, want disc 1", set.Path)
+	}
+}
+
+func TestCollapseDiscSetsPlaylist(t *testing.T) {
+	dir := t.TempDir()
+	files := discFiles(t, dir, "Alpha.chd", "Beta.chd")
+	playlist := filepath.Join(dir, "Saga.m3u")
+	if err := os.WriteFile(playlist, []byte("#EXTM3U\nBeta.chd\r\nAlpha.chd\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collapseDiscSets(files)
+	if len(got) != 1 {
+		t.Fatalf("got %d files, want 1", len(got))
+	}
+	if got[0].Name != "Saga" || got[0].Playlist != playlist {
+		t.Errorf("set = %q from %q", got[0].Name, got[0].Playlist)
+	}
+	want := []string{filepath.Join(dir, "Beta.chd"), filepath.Join(dir, "Alpha.chd")}
+	if !reflect.DeepEqual(got[0].Discs, want) {
+		t.Errorf("discs = %v, want %v", got[0].Discs, want)
+	}
+}
+
+func TestGenerateM3Us(t *testing.T) {
+	dir := t.TempDir()
+	files := collapseDiscSets(discFiles(t, dir,
+		"Game (Disc 1).chd",
+		"Game (Disc 2).chd",
+	))
+
+	written, err := GenerateM3Us(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 1 {
+		t.Fatalf("wrote %d playlists, want 1", written)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "Game.m3u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Game (Disc 1).chd\nGame (Disc 2).chd\n" {
+		t.Errorf("playlist = %q", data)
+	}
+
+	// the new playlist is used next time, and not written again
+	files = collapseDiscSets(discFiles(t, dir,
+		"Game (Disc 1).chd",
+		"Game (Disc 2).chd",
+	))
+	if written, _ := GenerateM3Us(files); written != 0 {
+		t.Errorf("wrote %d playlists again", written)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/synrais/SAM-GO/pkg/config"
 	"github.com/synrais/SAM-GO/pkg/games"
@@ -22,6 +23,16 @@ type FileInfo struct {
 	Ext      string
 	Path     string
 	MenuPath string
+	// Discs are the files of a multi-disc game in order, Path is the first.
+	// Empty for everything else.
+	Discs []string
+	// Playlist is the .m3u file a disc set was read from, if any.
+	Playlist string
+	// Title, Region and Checksum are from the ROM header, for systems
+	// which have one.
+	Title    string
+	Region   string
+	Checksum uint32
 }
 
 type IndexStatus struct {
@@ -108,6 +119,8 @@ func NewNamesIndex(cfg *config.UserConfig, systems []games.System, update func(I
 		status.Step++
 		update(status)
 
+		var sysFiles []FileInfo
+
 		sysPaths := games.GetSystemPaths(cfg, []games.System{sys})
 		for _, sp := range sysPaths {
 			pathFiles, err := games.GetFiles(sys.Id, sp.Path)
@@ -161,7 +174,7 @@ func NewNamesIndex(cfg *config.UserConfig, systems []games.System, update func(I
 					menuPath = filepath.ToSlash(filepath.Join(sys.Name, base))
 				}
 
-				allFiles = append(allFiles, FileInfo{
+				sysFiles = append(sysFiles, FileInfo{
 					SystemId: sys.Id,
 					Name:     name,
 					Ext:      ext,
@@ -170,6 +183,11 @@ func NewNamesIndex(cfg *config.UserConfig, systems []games.System, update func(I
 				})
 			}
 		}
+		if DiscSystems[sys.Id] {
+			sysFiles = collapseDiscSets(sysFiles)
+		}
+		readHeaders(sysFiles)
+		allFiles = append(allFiles, sysFiles...)
 		status.Files = len(allFiles)
 	}
 
@@ -266,6 +284,11 @@ func SearchNamesWords(_ []games.System, query string) ([]SearchResult, error) {
 // System Index Helpers
 // -------------------------
 
+// AllFiles returns every file in the games database.
+func AllFiles() ([]FileInfo, error) {
+	return loadAll()
+}
+
 func IndexedSystems() ([]string, error) {
 	files, err := loadAll()
 	if err != nil {
@@ -290,3 +313,12 @@ func SystemIndexed(system games.System) bool {
 	}
 	return false
 }
+
+// IndexTime returns when the games database was last built.
+func IndexTime() (time.Time, error) {
+	info, err := os.Stat(config.MenuDb)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,21 @@
+package gamesdb
+
+import "github.com/synrais/SAM-GO/pkg/romheader"
+
+// readHeaders fills in the ROM header fields of files for systems with
+// headers romheader understands. Files without a readable header are left
+// as they are.
+func readHeaders(files []FileInfo) {
+	for i := range files {
+		if !romheader.Systems[files[i].SystemId] {
+			continue
+		}
+		hdr, err := romheader.Peek(files[i].Path)
+		if err != nil {
+			continue
+		}
+		files[i].Title = hdr.Title
+		files[i].Region = hdr.Region
+		files[i].Checksum = hdr.Checksum
+	}
+}
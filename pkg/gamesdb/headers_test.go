@@ -0,0 +1,43 @@
+package gamesdb
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadHeaders(t *testing.T) {
+	dir := t.TempDir()
+
+	nsf := make([]byte, 0x100)
+	copy(nsf, "NESM\x1a")
+	copy(nsf[0x0E:], "Mega Man 2")
+	nsf[0x7A] = 0x01
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	files := []FileInfo{
+		{SystemId: "NESMusic", Path: write("a.nsf", nsf)},
+		// not a header romheader knows
+		{SystemId: "NES", Path: write("b.nes", []byte("junk"))},
+		// no headers for the system, so not read
+		{SystemId: "PSX", Path: write("c.nsf", nsf)},
+	}
+	readHeaders(files)
+
+	got := []string{files[0].Title, files[0].Region, files[1].Title, files[2].Title}
+	want := []string{"Mega Man 2", "PAL", "", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("headers = %q, want %q", got, want)
+	}
+	if files[0].Checksum == 0 {
+		t.Error("no checksum for a small rom")
+	}
+}
@@ -0,0 +1,115 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
+)
+
+const (
+	KindKeyboard = "keyboard"
+	KindMouse    = "mouse"
+	KindJoystick = "joystick"
+)
+
+// DeviceInfo is the stable identity of a physical input device. It's attached
+// to every event so consumers can tell devices apart, and it's what the
+// [InputDetector.*] device overrides and ignore lists are matched against.
+type DeviceInfo struct {
+	Kind   string
+	Path   string
+	Name   string
+	VidPid string // "vvvv:pppp" in lowercase hex, empty if unknown
+	GUID   string // SDL style GUID, empty if unknown
+}
+
+func newDeviceInfo(kind, path, name string, bus, vid, pid, ver int) DeviceInfo {
+	info := DeviceInfo{
+		Kind: kind,
+		Path: path,
+		Name: name,
+		GUID: makeGUID(bus, vid, pid, ver),
+	}
+	if vid != 0 || pid != 0 {
+		info.VidPid = fmt.Sprintf("%04x:%04x", vid, pid)
+	}
+	return info
+}
+
+// String returns the most human friendly identifier available.
+func (d DeviceInfo) String() string {
+	switch {
+	case d.Name != "" && d.VidPid != "":
+		return fmt.Sprintf("%s [%s]", d.Name, d.VidPid)
+	case d.Name != "":
+		return d.Name
+	default:
+		return filepath.Base(d.Path)
+	}
+}
+
+// IsVirtual reports whether this is one of the uinput devices SAM creates
+// to send keys and buttons, which aren't someone using the MiSTer.
+func (d DeviceInfo) IsVirtual() bool {
+	return d.Name == virtualinput.DeviceName
+}
+
+// Matches reports whether a user supplied pattern refers to this device. A
+// pattern can be a device name (case-insensitive, "*" wildcards allowed), a
+// "vid:pid" pair or an SDL GUID.
+func (d DeviceInfo) Matches(pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return false
+	}
+
+	if d.VidPid != "" && pattern == d.VidPid {
+		return true
+	}
+	if d.GUID != "" && pattern == d.GUID {
+		return true
+	}
+
+	name := strings.ToLower(d.Name)
+	if name == "" {
+		return false
+	}
+	if ok, err := path.Match(pattern, name); err == nil && ok {
+		return true
+	}
+	return pattern == name
+}
+
+// getInputMetadata reads the name and USB ids of an input device node from
+// sysfs, e.g. /dev/input/js0 -> /sys/class/input/js0/device.
+func getInputMetadata(path string) (string, int, int, int, int) {
+	base := filepath.Base(path)
+	sysdir := filepath.Join("/sys/class/input", base, "device")
+	readHex := func(fname string) int {
+		b, err := os.ReadFile(filepath.Join(sysdir, fname))
+		if err != nil {
+			return 0
+		}
+		v, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 16, 32)
+		return int(v)
+	}
+	name := stringMust(os.ReadFile(filepath.Join(sysdir, "name")))
+
+	bus := readHex("id/bustype")
+	vid := readHex("id/vendor")
+	pid := readHex("id/product")
+	ver := readHex("id/version")
+	return name, bus, vid, pid, ver
+}
+
+func stringMust(b []byte, _ error) string {
+	if b == nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
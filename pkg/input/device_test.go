@@ -0,0 +1,41 @@
+package input
+
+import "testing"
+
+func TestDeviceInfoMatches(t *testing.T) {
+	pad := DeviceInfo{
+		Kind:   KindJoystick,
+		Name:   "8BitDo SN30 Pro",
+		VidPid: "2dc8:6101",
+		GUID:   "05000000c82d00000161000000010000",
+	}
+
+	tests := []struct {
+		dev     DeviceInfo
+		pattern string
+		want    bool
+	}{
+		{pad, "8BitDo SN30 Pro", true},
+		{pad, " 8bitdo sn30 pro ", true},
+		{pad, "8bitdo*", true},
+		{pad, "*sn30*", true},
+		{pad, "*SN30", false},
+		{pad, "8bitdo", false},
+		{pad, "2dc8:6101", true},
+		{pad, "2DC8:6101", true},
+		{pad, "2dc8:6102", false},
+		{pad, "05000000C82D00000161000000010000", true},
+		{pad, "", false},
+		{pad, "*", true},
+		// a bad glob is still compared as a plain name
+		{DeviceInfo{Name: "Pad [v2"}, "pad [v2", true},
+		{DeviceInfo{Path: "/dev/input/js0"}, "*", false},
+		{DeviceInfo{Name: "Pad"}, ":", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dev.Matches(tt.pattern); got != tt.want {
+			t.Errorf("%s.Matches(%q) = %v, want %v", tt.dev, tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package input
+
+import (
+	"math"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/utils"
+)
+
+const gestureTickInterval = 50 * time.Millisecond
+
+// GestureConfig holds the thresholds used to turn raw mouse packets into
+// gestures. Times are in milliseconds and distances in mouse counts.
+type GestureConfig struct {
+	SwipeWindow   int64   // motion is accumulated over this long
+	SwipeDistance int     // distance along one axis needed for a swipe
+	SwipeVelocity float64 // minimum average speed in counts per second
+	DoubleClick   int64   // max gap between clicks of a double-click
+	LongPress     int64   // hold time for a long-press
+}
+
+func DefaultGestureConfig() GestureConfig {
+	return GestureConfig{
+		SwipeWindow:   250,
+		SwipeDistance: 60,
+		SwipeVelocity: 200,
+		DoubleClick:   300,
+		LongPress:     800,
+	}
+}
+
+// gestureConfigFrom reads the thresholds from [InputDetector], falling back to
+// the defaults for anything unset.
+func gestureConfigFrom(cfg *config.Config) GestureConfig {
+	gc := DefaultGestureConfig()
+	if cfg == nil {
+		return gc
+	}
+
+	d := cfg.InputDetector
+	if d.SwipeWindow > 0 {
+		gc.SwipeWindow = int64(d.SwipeWindow)
+	}
+	if d.SwipeDistance > 0 {
+		gc.SwipeDistance = d.SwipeDistance
+	}
+	if d.SwipeVelocity > 0 {
+		gc.SwipeVelocity = float64(d.SwipeVelocity)
+	}
+	if d.DoubleClick > 0 {
+		gc.DoubleClick = int64(d.DoubleClick)
+	}
+	if d.LongPress > 0 {
+		gc.LongPress = int64(d.LongPress)
+	}
+	return gc
+}
+
+var mouseButtonNames = map[string]string{
+	"L": "left",
+	"M": "middle",
+	"R": "right",
+}
+
+type buttonState struct {
+	down      bool
+	pressedAt int64
+	long      bool  // long-press already sent for this hold
+	double    bool  // this hold completed a double-click
+	pending   int64 // release time of a click waiting for a possible double
+}
+
+type gestureState struct {
+	device      DeviceInfo
+	motionStart int64
+	sumX, sumY  int
+	buttons     map[string]*buttonState
+}
+
+// GestureRecognizer accumulates mouse packets per device and reports
+// swipes, clicks, double-clicks, long-presses and scroll wheel movement as
+// normalized events. Feed and Tick take timestamps from the caller so the
+// recognizer can be driven without a real clock.
+type GestureRecognizer struct {
+	cfg     GestureConfig
+	devices map[string]*gestureState
+}
+
+func NewGestureRecognizer(cfg GestureConfig) *GestureRecognizer {
+	return &GestureRecognizer{
+		cfg:     cfg,
+		devices: make(map[string]*gestureState),
+	}
+}
+
+func (g *GestureRecognizer) state(dev DeviceInfo) *gestureState {
+	st, ok := g.devices[dev.Path]
+	if !ok {
+		st = &gestureState{
+			device:  dev,
+			buttons: make(map[string]*buttonState),
+		}
+		for _, name := range mouseButtonNames {
+			st.buttons[name] = &buttonState{}
+		}
+		g.devices[dev.Path] = st
+	}
+	return st
+}
+
+// Feed processes one mouse packet and returns any gestures it completed.
+func (g *GestureRecognizer) Feed(ev MouseEvent) []Event {
+	st := g.state(ev.Device)
+	// catch up first, so a click whose double-click window ran out before
+	// this packet is sent before the packet can replace it
+	out := g.tick(st, ev.Timestamp)
+	emit := func(name string) {
+		out = append(out, Event{Device: st.device, Name: name})
+	}
+
+	// scroll wheel is reported as is, it's already deliberate input
+	if ev.DZ < 0 {
+		emit("scrollup")
+	} else if ev.DZ > 0 {
+		emit("scrolldown")
+	}
+
+	// motion
+	if ev.DX != 0 || ev.DY != 0 {
+		if st.motionStart == 0 || ev.Timestamp-st.motionStart > g.cfg.SwipeWindow {
+			st.motionStart = ev.Timestamp
+			st.sumX, st.sumY = 0, 0
+		}
+		st.sumX += int(ev.DX)
+		st.sumY += int(ev.DY)
+
+		if name := g.swipe(st, ev.Timestamp); name != "" {
+			emit(name)
+		}
+	}
+
+	// buttons
+	held := make(map[string]bool)
+	for _, b := range ev.Buttons {
+		if name, ok := mouseButtonNames[b]; ok {
+			held[name] = true
+		}
+	}
+	for _, name := range []string{"left", "middle", "right"} {
+		bs := st.buttons[name]
+		switch {
+		case held[name] && !bs.down:
+			bs.down = true
+			bs.pressedAt = ev.Timestamp
+			bs.long = false
+			bs.double = false
+			if bs.pending != 0 && ev.Timestamp-bs.pending <= g.cfg.DoubleClick {
+				bs.pending = 0
+				bs.double = true
+				emit("double" + name)
+			}
+		case !held[name] && bs.down:
+			bs.down = false
+			if !bs.long && !bs.double {
+				bs.pending = ev.Timestamp
+			}
+		}
+	}
+
+	return out
+}
+
+// swipe checks the accumulated motion against the thresholds and returns the
+// swipe name if one was completed, resetting the accumulator.
+func (g *GestureRecognizer) swipe(st *gestureState, now int64) string {
+	absX, absY := abs(st.sumX), abs(st.sumY)
+	dist := absX
+	if absY > dist {
+		dist = absY
+	}
+	if dist < g.cfg.SwipeDistance {
+		return ""
+	}
+
+	elapsed := math.Max(float64(now-st.motionStart), 1) / 1000
+	if float64(dist)/elapsed < g.cfg.SwipeVelocity {
+		return ""
+	}
+
+	var name string
+	if absX >= absY {
+		if st.sumX < 0 {
+			name = "swipeleft"
+		} else {
+			name = "swiperight"
+		}
+	} else {
+		// PS/2 reports positive y as up
+		if st.sumY < 0 {
+			name = "swipedown"
+		} else {
+			name = "swipeup"
+		}
+	}
+
+	st.motionStart = 0
+	st.sumX, st.sumY = 0, 0
+	return name
+}
+
+// Tick reports gestures which complete by time passing rather than by a new
+// packet: long-presses and single clicks whose double-click window ran out.
+func (g *GestureRecognizer) Tick(now int64) []Event {
+	var out []Event
+	for _, path := range utils.SortedMapKeys(g.devices) {
+		out = append(out, g.tick(g.devices[path], now)...)
+	}
+	return out
+}
+
+func (g *GestureRecognizer) tick(st *gestureState, now int64) []Event {
+	var out []Event
+	for _, name := range []string{"left", "middle", "right"} {
+		bs := st.buttons[name]
+		if bs.down && !bs.long && !bs.double && now-bs.pressedAt >= g.cfg.LongPress {
+			bs.long = true
+			out = append(out, Event{Device: st.device, Name: "long" + name})
+		}
+		if bs.pending != 0 && !bs.down && now-bs.pending > g.cfg.DoubleClick {
+			bs.pending = 0
+			out = append(out, Event{Device: st.device, Name: name})
+		}
+	}
+
+	// drop slow drift that never became a swipe
+	if st.motionStart != 0 && now-st.motionStart > g.cfg.SwipeWindow {
+		st.motionStart = 0
+		st.sumX, st.sumY = 0, 0
+	}
+
+	return out
+}
+
+// RecognizeGestures runs a recognizer over a mouse stream until it closes.
+func RecognizeGestures(cfg GestureConfig, in <-chan MouseEvent, out chan<- Event) {
+	g := NewGestureRecognizer(cfg)
+	ticker := time.NewTicker(gestureTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-in:
+			if !ok {
+				return
+			}
+			for _, e := range g.Feed(ev) {
+				out <- e
+			}
+		case t := <-ticker.C:
+			for _, e := range g.Tick(t.UnixMilli()) {
+				out <- e
+			}
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,174 @@
+package input
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+// gestureStep is a mouse packet fed at At, or just a Tick at At if tick is
+// set. Times are milliseconds from an arbitrary start.
+type gestureStep struct {
+	At      int64
+	tick    bool
+	Buttons []string
+	DX, DY  int8
+	DZ      int8
+}
+
+func move(at int64, dx, dy int8) gestureStep  { return gestureStep{At: at, DX: dx, DY: dy} }
+func press(at int64, b ...string) gestureStep { return gestureStep{At: at, Buttons: b} }
+func tickAt(at int64) gestureStep             { return gestureStep{At: at, tick: true} }
+
+func runGestures(cfg GestureConfig, steps []gestureStep) []string {
+	const start = 100000
+	dev := DeviceInfo{Kind: KindMouse, Path: "/dev/input/mouse0"}
+	g := NewGestureRecognizer(cfg)
+
+	var names []string
+	for _, s := range steps {
+		var events []Event
+		if s.tick {
+			events = g.Tick(start + s.At)
+		} else {
+			events = g.Feed(MouseEvent{
+				Timestamp: start + s.At,
+				Device:    dev,
+				Buttons:   s.Buttons,
+				DX:        s.DX,
+				DY:        s.DY,
+				DZ:        s.DZ,
+			})
+		}
+		for _, ev := range events {
+			names = append(names, ev.Name)
+		}
+	}
+	return names
+}
+
+func TestGestureRecognizer(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []gestureStep
+		want  []string
+	}{
+		{
+			"swipe right",
+			[]gestureStep{move(0, 30, 0), move(50, 40, 0)},
+			[]string{"swiperight"},
+		},
+		{
+			"swipe left",
+			[]gestureStep{move(0, -70, 5)},
+			[]string{"swipeleft"},
+		},
+		{
+			"swipe up and down",
+			[]gestureStep{move(0, 0, 70), move(500, 10, -70)},
+			[]string{"swipeup", "swipedown"},
+		},
+		{
+			"one swipe per stroke",
+			[]gestureStep{move(0, 70, 0), move(10, 20, 0), move(20, 20, 0)},
+			[]string{"swiperight"},
+		},
+		{
+			"short of the distance",
+			[]gestureStep{move(0, 30, 0), move(50, 29, 0)},
+			nil,
+		},
+		{
+			"spread past the window",
+			[]gestureStep{move(0, 20, 0), move(200, 20, 0), move(300, 20, 0)},
+			nil,
+		},
+		{
+			"drift is dropped after the window",
+			[]gestureStep{move(0, 50, 0), tickAt(300), move(310, 20, 0)},
+			nil,
+		},
+		{
+			"motion outside the window starts again",
+			[]gestureStep{move(0, 50, 0), move(260, 50, 0), move(300, 20, 0)},
+			[]string{"swiperight"},
+		},
+		{
+			"wheel",
+			[]gestureStep{{At: 0, DZ: -1}, {At: 10, DZ: 1}, {At: 20, DZ: -2}},
+			[]string{"scrollup", "scrolldown", "scrollup"},
+		},
+		{
+			"click after the double-click window",
+			[]gestureStep{press(0, "L"), press(50), tickAt(300), tickAt(351)},
+			[]string{"left"},
+		},
+		{
+			"double-click",
+			[]gestureStep{press(0, "R"), press(50), press(200, "R"), press(250), tickAt(1000)},
+			[]string{"doubleright"},
+		},
+		{
+			"two slow clicks",
+			[]gestureStep{press(0, "L"), press(50), press(400, "L"), press(450), tickAt(1000)},
+			[]string{"left", "left"},
+		},
+		{
+			"long-press",
+			[]gestureStep{press(0, "M"), tickAt(799), tickAt(800), tickAt(2000), press(2100), tickAt(3000)},
+			[]string{"longmiddle"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runGestures(DefaultGestureConfig(), tt.steps)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gestures = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGestureThresholds(t *testing.T) {
+	cfg := gestureConfigFrom(&config.Config{InputDetector: config.InputDetectorConfig{
+		SwipeDistance: 20,
+		SwipeVelocity: 50,
+		DoubleClick:   100,
+	}})
+	want := GestureConfig{SwipeWindow: 250, SwipeDistance: 20, SwipeVelocity: 50, DoubleClick: 100, LongPress: 800}
+	if cfg != want {
+		t.Errorf("gestureConfigFrom() = %+v, want %+v", cfg, want)
+	}
+	if cfg := gestureConfigFrom(nil); cfg != DefaultGestureConfig() {
+		t.Errorf("gestureConfigFrom(nil) = %+v", cfg)
+	}
+
+	// a short slow stroke is a swipe with lower thresholds
+	steps := []gestureStep{move(0, 10, 0), move(200, 10, 0)}
+	if got := runGestures(DefaultGestureConfig(), steps); got != nil {
+		t.Errorf("default thresholds: %q", got)
+	}
+	if got := runGestures(cfg, steps); !reflect.DeepEqual(got, []string{"swiperight"}) {
+		t.Errorf("lower thresholds: %q, want swiperight", got)
+	}
+
+	// a fast enough stroke for the defaults is too slow for a higher
+	// velocity, 60 counts in 100ms is 600 counts/s
+	fast := DefaultGestureConfig()
+	fast.SwipeVelocity = 1000
+	steps = []gestureStep{move(0, 30, 0), move(100, 30, 0)}
+	if got := runGestures(DefaultGestureConfig(), steps); !reflect.DeepEqual(got, []string{"swiperight"}) {
+		t.Errorf("default velocity: %q, want swiperight", got)
+	}
+	if got := runGestures(fast, steps); got != nil {
+		t.Errorf("higher velocity: %q", got)
+	}
+
+	// and clicks 130ms apart aren't a double-click any more
+	steps = []gestureStep{press(0, "L"), press(20), press(150, "L"), press(170), tickAt(500)}
+	if got := runGestures(cfg, steps); !reflect.DeepEqual(got, []string{"left", "left"}) {
+		t.Errorf("lower double-click time: %q", got)
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/synrais/SAM-GO/pkg/assets"
+	"github.com/synrais/SAM-GO/pkg/utils"
 	"golang.org/x/sys/unix"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,7 +23,7 @@ const (
 // JoystickEvent is a snapshot of a joystick's state.
 type JoystickEvent struct {
 	Timestamp int64
-	Device    string
+	Device    DeviceInfo
 	Buttons   map[string]string // friendly button name -> "P"/"R"
 	Axes      map[string]int16  // friendly axis name -> value
 }
@@ -74,9 +74,10 @@ func parseMappingLine(line string) *mappingEntry {
 	return &mappingEntry{guid: guid, name: name, platform: platform, mapping: mapping}
 }
 
-// Use embedded DB content instead of file
+// Use embedded DB content instead of file. Mappings made with the mapping
+// wizard come first so they win over the embedded ones.
 func loadSDLDB() []*mappingEntry {
-	var entries []*mappingEntry
+	entries := loadUserSDLDB()
 	content := assets.GameControllerDB
 
 	scanner := bufio.NewScanner(strings.NewReader(content))
@@ -105,12 +106,12 @@ func chooseMapping(entries []*mappingEntry, bus, vid, pid, ver int) map[string]s
 		g := strings.ToLower(a.guid)
 		for _, e := range entries {
 			if strings.ToLower(e.guid) == g && e.platform == "Linux" {
-				fmt.Printf("  -> SDL DB: %s to '%s'\n", a.msg, e.name)
+				logger.Debug("SDL DB: %s to '%s'", a.msg, e.name)
 				return e.mapping
 			}
 		}
 	}
-	fmt.Printf("  -> No SDL match for GUID: %s\n", strings.ToLower(makeGUID(bus, vid, pid, ver)))
+	logger.Debug("no SDL match for GUID: %s", strings.ToLower(makeGUID(bus, vid, pid, ver)))
 	return map[string]string{}
 }
 
@@ -123,7 +124,7 @@ func invertMapping(mapping map[string]string) (map[int]string, map[int]string) {
 				btnmap[n] = friendly
 			}
 		} else if strings.HasPrefix(raw, "a") || strings.HasPrefix(raw, "+a") || strings.HasPrefix(raw, "-a") {
-			nstr := strings.TrimLeft(raw, "+a-")
+			nstr := strings.TrimSuffix(strings.TrimLeft(raw, "+a-"), "~")
 			if n, err := strconv.Atoi(nstr); err == nil {
 				axmap[n] = friendly
 			}
@@ -132,48 +133,43 @@ func invertMapping(mapping map[string]string) (map[int]string, map[int]string) {
 	return btnmap, axmap
 }
 
+// String renders the event in the same layout the raw stream used to emit.
+func (e JoystickEvent) String() string {
+	btnParts := []string{}
+	for _, name := range utils.SortedMapKeys(e.Buttons) {
+		btnParts = append(btnParts, fmt.Sprintf("%s=%s", name, e.Buttons[name]))
+	}
+
+	axParts := []string{}
+	for _, name := range utils.SortedMapKeys(e.Axes) {
+		axParts = append(axParts, fmt.Sprintf("%s=%d", name, e.Axes[name]))
+	}
+
+	return fmt.Sprintf("[%d ms] %s: Buttons[%s] Axes[%s]",
+		e.Timestamp,
+		filepath.Base(e.Device.Path),
+		strings.Join(btnParts, ", "),
+		strings.Join(axParts, ", "),
+	)
+}
+
 // -------- Device handling ----------
 
 type JoystickDevice struct {
 	Path    string
 	Name    string
 	GUID    string
+	Info    DeviceInfo
 	FD      int
 	Buttons map[int]int16
 	Axes    map[int]int16
+	rest    map[int]int16 // resting axis positions, only used for mapping
 	btnmap  map[int]string
 	axmap   map[int]string
 }
 
-func getJSMetadata(path string) (string, int, int, int, int) {
-	base := filepath.Base(path)
-	sysdir := filepath.Join("/sys/class/input", base, "device")
-	readHex := func(fname string) int {
-		b, err := os.ReadFile(filepath.Join(sysdir, fname))
-		if err != nil {
-			return 0
-		}
-		v, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 16, 32)
-		return int(v)
-	}
-	name := stringMust(os.ReadFile(filepath.Join(sysdir, "name")))
-
-	bus := readHex("id/bustype")
-	vid := readHex("id/vendor")
-	pid := readHex("id/product")
-	ver := readHex("id/version")
-	return name, bus, vid, pid, ver
-}
-
-func stringMust(b []byte, _ error) string {
-	if b == nil {
-		return ""
-	}
-	return strings.TrimSpace(string(b))
-}
-
 func openJoystickDevice(path string, sdlmap []*mappingEntry) (*JoystickDevice, error) {
-	name, bus, vid, pid, ver := getJSMetadata(path)
+	name, bus, vid, pid, ver := getInputMetadata(path)
 	guid := makeGUID(bus, vid, pid, ver)
 	mapping := map[string]string{}
 	if guid != "" {
@@ -186,12 +182,13 @@ func openJoystickDevice(path string, sdlmap []*mappingEntry) (*JoystickDevice, e
 		return nil, err
 	}
 
-	fmt.Printf("[+] Opened %s (%s, GUID=%s)\n", path, name, guid)
+	logger.Info("opened %s (%s, GUID=%s)", path, name, guid)
 
 	return &JoystickDevice{
 		Path:    path,
 		Name:    name,
 		GUID:    guid,
+		Info:    newDeviceInfo(KindJoystick, path, name, bus, vid, pid, ver),
 		FD:      fd,
 		Buttons: make(map[int]int16),
 		Axes:    make(map[int]int16),
@@ -215,6 +212,36 @@ func (j *JoystickDevice) reopen() {
 	}
 }
 
+// snapshot builds an event from the current state of all mapped controls.
+func (j *JoystickDevice) snapshot() JoystickEvent {
+	ev := JoystickEvent{
+		Timestamp: time.Now().UnixMilli(),
+		Device:    j.Info,
+		Buttons:   make(map[string]string, len(j.btnmap)),
+		Axes:      make(map[string]int16, len(j.axmap)),
+	}
+
+	for k, name := range j.btnmap {
+		if name == "" {
+			name = fmt.Sprintf("Btn%d", k)
+		}
+		state := "R"
+		if v, ok := j.Buttons[k]; ok && v != 0 {
+			state = "P"
+		}
+		ev.Buttons[name] = state
+	}
+
+	for k, name := range j.axmap {
+		if name == "" {
+			name = fmt.Sprintf("Axis%d", k)
+		}
+		ev.Axes[name] = j.Axes[k]
+	}
+
+	return ev
+}
+
 func (j *JoystickDevice) readEvents() bool {
 	if j.FD < 0 {
 		return false
@@ -249,17 +276,29 @@ func (j *JoystickDevice) readEvents() bool {
 // -------- Singleton Streaming monitor ----------
 
 var (
-	joystickOnce sync.Once
-	joystickChan chan string
+	joystickMu   sync.Mutex
+	joystickChan chan JoystickEvent
 )
 
-func StreamJoysticks() <-chan string {
-	joystickOnce.Do(func() {
-		joystickChan = make(chan string, 100)
+// StreamJoysticks returns a single shared channel of JoystickEvent, sent
+// whenever any mapped button or axis of a joystick changes. If the channel
+// has closed because watching the devices failed, the next call starts a
+// new one.
+func StreamJoysticks() <-chan JoystickEvent {
+	joystickMu.Lock()
+	defer joystickMu.Unlock()
+	if joystickChan == nil {
+		ch := make(chan JoystickEvent, 100)
+		joystickChan = ch
 		sdlmap := loadSDLDB()
 
 		go func() {
-			defer close(joystickChan)
+			defer func() {
+				joystickMu.Lock()
+				joystickChan = nil
+				joystickMu.Unlock()
+				close(ch)
+			}()
 			devices := map[string]*JoystickDevice{}
 
 			rescan := func() {
@@ -275,7 +314,7 @@ func StreamJoysticks() <-chan string {
 
 				for path, dev := range devices {
 					if _, err := os.Stat(path); os.IsNotExist(err) {
-						fmt.Printf("[-] Lost %s (%s)\n", dev.Path, dev.Name)
+						logger.Info("lost %s (%s)", dev.Path, dev.Name)
 						dev.close()
 						delete(devices, path)
 					}
@@ -286,7 +325,7 @@ func StreamJoysticks() <-chan string {
 
 			inFd, err := unix.InotifyInit()
 			if err != nil {
-				fmt.Println("inotify init failed:", err)
+				logger.Error("inotify init failed: %s", err)
 				return
 			}
 			defer unix.Close(inFd)
@@ -295,7 +334,7 @@ func StreamJoysticks() <-chan string {
 			fallbackDir := "/dev/input"
 			dirToWatch := watchDir
 			if _, err := os.Stat(watchDir); os.IsNotExist(err) {
-				fmt.Println("[WARN] /dev/input/by-id not found, watching", fallbackDir)
+				logger.Warn("/dev/input/by-id not found, watching %s", fallbackDir)
 				dirToWatch = fallbackDir
 			}
 
@@ -306,7 +345,7 @@ func StreamJoysticks() <-chan string {
 
 			wd, err := addWatch(dirToWatch)
 			if err != nil {
-				fmt.Println("inotify addwatch failed:", err)
+				logger.Error("inotify addwatch failed: %s", err)
 				return
 			}
 
@@ -321,7 +360,7 @@ func StreamJoysticks() <-chan string {
 					rescan()
 					if dirToWatch == fallbackDir {
 						if _, err := os.Stat(watchDir); err == nil {
-							fmt.Println("[INFO] /dev/input/by-id appeared, switching watch")
+							logger.Info("/dev/input/by-id appeared, switching watch")
 							unix.InotifyRmWatch(inFd, uint32(wd))
 							if newWd, err := addWatch(watchDir); err == nil {
 								dirToWatch = watchDir
@@ -342,61 +381,14 @@ func StreamJoysticks() <-chan string {
 						continue
 					}
 					if dev.readEvents() {
-						// Build button list
-						btnKeys := make([]int, 0, len(dev.btnmap))
-						for k := range dev.btnmap {
-							btnKeys = append(btnKeys, k)
-						}
-						sort.Ints(btnKeys)
-
-						btnParts := []string{}
-						for _, k := range btnKeys {
-							name := dev.btnmap[k]
-							if name == "" {
-								name = fmt.Sprintf("Btn%d", k)
-							}
-							state := "R"
-							if v, ok := dev.Buttons[k]; ok && v != 0 {
-								state = "P"
-							}
-							btnParts = append(btnParts, fmt.Sprintf("%s=%s", name, state))
-						}
-
-						// Build axis list
-						axKeys := make([]int, 0, len(dev.axmap))
-						for k := range dev.axmap {
-							axKeys = append(axKeys, k)
-						}
-						sort.Ints(axKeys)
-
-						axParts := []string{}
-						for _, k := range axKeys {
-							name := dev.axmap[k]
-							if name == "" {
-								name = fmt.Sprintf("Axis%d", k)
-							}
-							val := int16(0)
-							if v, ok := dev.Axes[k]; ok {
-								val = v
-							}
-							axParts = append(axParts, fmt.Sprintf("%s=%d", name, val))
-						}
-
-						line := fmt.Sprintf("[%d ms] %s: Buttons[%s] Axes[%s]",
-							time.Now().UnixMilli(),
-							filepath.Base(dev.Path),
-							strings.Join(btnParts, ", "),
-							strings.Join(axParts, ", "),
-						)
-
-						joystickChan <- line
+						ch <- dev.snapshot()
 					}
 					dev.reopen()
 				}
 				time.Sleep(jsReadFrequency)
 			}
 		}()
-	})
+	}
 
 	return joystickChan
 }
@@ -2,7 +2,6 @@ package input
 
 import (
 	"bufio"
-	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -19,9 +18,9 @@ import (
 const hotplugScanInterval = 2 * time.Second
 
 var (
-	scanCodes     map[byte]string
-	keyboardOnce  sync.Once
-	keyboardChan  chan string
+	scanCodes    map[byte]string
+	keyboardMu   sync.Mutex
+	keyboardChan chan KeyboardEvent
 )
 
 // init builds the scanCodes map once.
@@ -89,31 +88,67 @@ func splitKeys(s string) []string {
 	return re.FindAllString(s, -1)
 }
 
+// KeyboardEvent is a single new key press from a keyboard.
+type KeyboardEvent struct {
+	Timestamp int64
+	Device    DeviceInfo
+	Key       string // single character or <TOKEN> such as <ENTER>
+}
+
 type KeyboardDevice struct {
 	Path string
 	Name string
+	Info DeviceInfo
 	FD   int
 }
 
-func openKeyboardDevice(path, name string) (*KeyboardDevice, error) {
-	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK, 0)
+func openKeyboardDevice(info DeviceInfo) (*KeyboardDevice, error) {
+	fd, err := unix.Open(info.Path, unix.O_RDONLY|unix.O_NONBLOCK, 0)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Printf("[+] Opened %s → %s\n", path, name)
-	return &KeyboardDevice{Path: path, Name: name, FD: fd}, nil
+	logger.Info("opened %s → %s", info.Path, info)
+	return &KeyboardDevice{Path: info.Path, Name: info.Name, Info: info, FD: fd}, nil
 }
 
 func (k *KeyboardDevice) Close() {
 	if k.FD >= 0 {
 		_ = unix.Close(k.FD)
-		fmt.Printf("[-] Closed %s → %s\n", k.Path, k.Name)
+		logger.Info("closed %s → %s", k.Path, k.Name)
 		k.FD = -1
 	}
 }
 
-func parseKeyboards() map[string]string {
-	keyboards := map[string]string{}
+// parseIdLine reads the bus and USB ids from an "I:" line of
+// /proc/bus/input/devices.
+func parseIdLine(line string) (bus, vid, pid, ver int) {
+	for _, field := range strings.Fields(strings.TrimPrefix(line, "I:")) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v, err := strconv.ParseInt(kv[1], 16, 32)
+		if err != nil {
+			continue
+		}
+		switch kv[0] {
+		case "Bus":
+			bus = int(v)
+		case "Vendor":
+			vid = int(v)
+		case "Product":
+			pid = int(v)
+		case "Version":
+			ver = int(v)
+		}
+	}
+	return
+}
+
+// parseKeyboards returns the identity of every HID keyboard, keyed by its
+// sysfs id (e.g. 0003:046D:C52B.0001). Paths are filled in by matchHidraws.
+func parseKeyboards() map[string]DeviceInfo {
+	keyboards := map[string]DeviceInfo{}
 	f, err := os.Open("/proc/bus/input/devices")
 	if err != nil {
 		return keyboards
@@ -133,12 +168,14 @@ func parseKeyboards() map[string]string {
 				}
 			}
 			if handlers {
-				var nameLine, sysfsLine string
+				var nameLine, sysfsLine, idLine string
 				for _, l := range block {
 					if strings.HasPrefix(l, "N: ") {
 						nameLine = l
 					} else if strings.HasPrefix(l, "S: Sysfs=") {
 						sysfsLine = l
+					} else if strings.HasPrefix(l, "I: ") {
+						idLine = l
 					}
 				}
 				if nameLine != "" && sysfsLine != "" {
@@ -153,7 +190,8 @@ func parseKeyboards() map[string]string {
 						}
 					}
 					if sysfsID != "" {
-						keyboards[sysfsID] = name
+						bus, vid, pid, ver := parseIdLine(idLine)
+						keyboards[sysfsID] = newDeviceInfo(KindKeyboard, "", name, bus, vid, pid, ver)
 					}
 				}
 			}
@@ -165,8 +203,8 @@ func parseKeyboards() map[string]string {
 	return keyboards
 }
 
-func matchHidraws(kbs map[string]string) [][2]string {
-	matches := [][2]string{}
+func matchHidraws(kbs map[string]DeviceInfo) []DeviceInfo {
+	matches := []DeviceInfo{}
 	paths, _ := filepath.Glob("/sys/class/hidraw/hidraw*/device")
 	for _, p := range paths {
 		target, err := filepath.EvalSymlinks(p)
@@ -174,21 +212,31 @@ func matchHidraws(kbs map[string]string) [][2]string {
 			continue
 		}
 		sysfsID := filepath.Base(target)
-		if name, ok := kbs[sysfsID]; ok {
-			devnode := "/dev/" + filepath.Base(filepath.Dir(p))
-			matches = append(matches, [2]string{devnode, name})
+		if info, ok := kbs[sysfsID]; ok {
+			info.Path = "/dev/" + filepath.Base(filepath.Dir(p))
+			matches = append(matches, info)
 		}
 	}
 	return matches
 }
 
-// StreamKeyboards returns a singleton channel of keypresses.
-func StreamKeyboards() <-chan string {
-	keyboardOnce.Do(func() {
-		keyboardChan = make(chan string, 100)
+// StreamKeyboards returns a singleton channel of keypresses. If the channel
+// has closed because watching the devices failed, the next call starts a
+// new one.
+func StreamKeyboards() <-chan KeyboardEvent {
+	keyboardMu.Lock()
+	defer keyboardMu.Unlock()
+	if keyboardChan == nil {
+		ch := make(chan KeyboardEvent, 100)
+		keyboardChan = ch
 
 		go func() {
-			defer close(keyboardChan)
+			defer func() {
+				keyboardMu.Lock()
+				keyboardChan = nil
+				keyboardMu.Unlock()
+				close(ch)
+			}()
 			devices := map[string]*KeyboardDevice{}
 			prevKeys := make(map[int]map[string]bool) // FD → currently pressed keys
 
@@ -196,12 +244,11 @@ func StreamKeyboards() <-chan string {
 				kbs := parseKeyboards()
 				matches := matchHidraws(kbs)
 				found := map[string]bool{}
-				for _, m := range matches {
-					devnode, name := m[0], m[1]
-					found[devnode] = true
-					if _, ok := devices[devnode]; !ok {
-						if dev, err := openKeyboardDevice(devnode, name); err == nil {
-							devices[devnode] = dev
+				for _, info := range matches {
+					found[info.Path] = true
+					if _, ok := devices[info.Path]; !ok {
+						if dev, err := openKeyboardDevice(info); err == nil {
+							devices[info.Path] = dev
 							prevKeys[dev.FD] = map[string]bool{}
 						}
 					}
@@ -218,14 +265,14 @@ func StreamKeyboards() <-chan string {
 			rescan()
 			inFd, err := unix.InotifyInit()
 			if err != nil {
-				fmt.Println("inotify init failed:", err)
+				logger.Error("inotify init failed: %s", err)
 				return
 			}
 			defer unix.Close(inFd)
 
 			_, err = unix.InotifyAddWatch(inFd, "/dev", unix.IN_CREATE|unix.IN_DELETE)
 			if err != nil {
-				fmt.Println("inotify addwatch failed:", err)
+				logger.Error("inotify addwatch failed: %s", err)
 				return
 			}
 
@@ -269,7 +316,11 @@ func StreamKeyboards() <-chan string {
 									current[k] = true
 									if !prevKeys[int(pfd.Fd)][k] {
 										// new key press
-										keyboardChan <- k
+										ch <- KeyboardEvent{
+											Timestamp: time.Now().UnixMilli(),
+											Device:    fdmap[int(pfd.Fd)].Info,
+											Key:       k,
+										}
 									}
 								}
 								prevKeys[int(pfd.Fd)] = current
@@ -281,7 +332,7 @@ func StreamKeyboards() <-chan string {
 				}
 			}
 		}()
-	})
+	}
 
 	return keyboardChan
 }
@@ -0,0 +1,255 @@
+package input
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"golang.org/x/sys/unix"
+)
+
+// ErrMappingSkipped is returned by Capture when nothing was pressed in time.
+var ErrMappingSkipped = errors.New("no input, skipped")
+
+// userControllerDbFile is where mappings made with the wizard are saved.
+var userControllerDbFile = config.UserControllerDbFile
+
+// captureThreshold is how far an axis has to move from its resting position
+// before it counts as a deliberate push.
+const captureThreshold = 16000
+
+// MappingStep is one control the mapping wizard asks for.
+type MappingStep struct {
+	Name   string // SDL name, e.g. "a", "leftx", "dpup"
+	Prompt string
+	Axis   bool // wants a full axis rather than a button
+}
+
+// MappingSteps is the order the wizard walks through. Axis steps ask for the
+// negative direction so inverted axes can be detected.
+var MappingSteps = []MappingStep{
+	{Name: "a", Prompt: "Press A (bottom face button)"},
+	{Name: "b", Prompt: "Press B (right face button)"},
+	{Name: "x", Prompt: "Press X (left face button)"},
+	{Name: "y", Prompt: "Press Y (top face button)"},
+	{Name: "back", Prompt: "Press Back/Select"},
+	{Name: "start", Prompt: "Press Start"},
+	{Name: "guide", Prompt: "Press Guide/Home"},
+	{Name: "leftshoulder", Prompt: "Press the left shoulder button"},
+	{Name: "rightshoulder", Prompt: "Press the right shoulder button"},
+	{Name: "lefttrigger", Prompt: "Press the left trigger"},
+	{Name: "righttrigger", Prompt: "Press the right trigger"},
+	{Name: "dpup", Prompt: "Press D-pad up"},
+	{Name: "dpdown", Prompt: "Press D-pad down"},
+	{Name: "dpleft", Prompt: "Press D-pad left"},
+	{Name: "dpright", Prompt: "Press D-pad right"},
+	{Name: "leftx", Prompt: "Push the left stick left", Axis: true},
+	{Name: "lefty", Prompt: "Push the left stick up", Axis: true},
+	{Name: "leftstick", Prompt: "Click the left stick"},
+	{Name: "rightx", Prompt: "Push the right stick left", Axis: true},
+	{Name: "righty", Prompt: "Push the right stick up", Axis: true},
+	{Name: "rightstick", Prompt: "Click the right stick"},
+}
+
+type rawJSEvent struct {
+	Type   byte // 0x01 button, 0x02 axis
+	Number int
+	Value  int16
+}
+
+// readRaw drains all pending events from the device, keeping the button and
+// axis state up to date.
+func (j *JoystickDevice) readRaw() []rawJSEvent {
+	var events []rawJSEvent
+	if j.FD < 0 {
+		return events
+	}
+	buf := make([]byte, jsEventSize)
+	for {
+		n, err := unix.Read(j.FD, buf)
+		if err != nil || n < jsEventSize {
+			break
+		}
+		ev := rawJSEvent{
+			Type:   buf[6] & 0x7F,
+			Number: int(buf[7]),
+			Value:  *(*int16)(unsafe.Pointer(&buf[4])),
+		}
+		switch ev.Type {
+		case 0x01:
+			j.Buttons[ev.Number] = ev.Value
+		case 0x02:
+			j.Axes[ev.Number] = ev.Value
+		default:
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// OpenJoystick opens a joystick for the mapping wizard. The current state of
+// every control is read straight away and used as its resting position.
+func OpenJoystick(path string) (*JoystickDevice, error) {
+	dev, err := openJoystickDevice(path, loadSDLDB())
+	if err != nil {
+		return nil, err
+	}
+	// the driver sends the initial state as soon as the device is opened
+	time.Sleep(jsReadFrequency)
+	dev.readRaw()
+	dev.rest = make(map[int]int16, len(dev.Axes))
+	for n, v := range dev.Axes {
+		dev.rest[n] = v
+	}
+	return dev, nil
+}
+
+func (j *JoystickDevice) Close() {
+	j.close()
+}
+
+// Capture waits for a single deliberate input and returns it as an SDL
+// binding: "b3" for a button, "a1" or "a1~" for a full axis, "+a6"/"-a6" for
+// half an axis used as a button. It waits for the control to be released
+// again before returning so one press can't be captured twice, but never
+// past timeout.
+func (j *JoystickDevice) Capture(step MappingStep, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		for _, ev := range j.readRaw() {
+			var bind string
+			switch {
+			case ev.Type == 0x01 && ev.Value != 0 && !step.Axis:
+				bind = fmt.Sprintf("b%d", ev.Number)
+			case ev.Type == 0x02:
+				delta := int(ev.Value) - int(j.rest[ev.Number])
+				if delta > -captureThreshold && delta < captureThreshold {
+					continue
+				}
+				switch {
+				case step.Axis && delta < 0:
+					bind = fmt.Sprintf("a%d", ev.Number)
+				case step.Axis:
+					bind = fmt.Sprintf("a%d~", ev.Number)
+				case strings.HasSuffix(step.Name, "trigger"):
+					// triggers rest at one end, the whole axis is the trigger
+					bind = fmt.Sprintf("a%d", ev.Number)
+				case delta < 0:
+					bind = fmt.Sprintf("-a%d", ev.Number)
+				default:
+					bind = fmt.Sprintf("+a%d", ev.Number)
+				}
+			default:
+				continue
+			}
+
+			j.waitRelease(deadline)
+			return bind, nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "", ErrMappingSkipped
+}
+
+// waitRelease waits until every control is back at rest, or the deadline.
+func (j *JoystickDevice) waitRelease(deadline time.Time) {
+	for time.Now().Before(deadline) {
+		j.readRaw()
+		idle := true
+		for _, v := range j.Buttons {
+			if v != 0 {
+				idle = false
+			}
+		}
+		for n, v := range j.Axes {
+			if d := int(v) - int(j.rest[n]); d <= -captureThreshold || d >= captureThreshold {
+				idle = false
+			}
+		}
+		if idle {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// BuildMappingLine renders a gamecontrollerdb line for the given bindings.
+func BuildMappingLine(guid, name string, binds map[string]string) string {
+	keys := make([]string, 0, len(binds))
+	for k := range binds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// commas separate the fields, so they can't appear in the name
+	parts := []string{strings.ToLower(guid), strings.ReplaceAll(name, ",", " ")}
+	for _, k := range keys {
+		parts = append(parts, k+":"+binds[k])
+	}
+	parts = append(parts, "platform:Linux")
+	return strings.Join(parts, ",") + ","
+}
+
+// loadUserSDLDB reads mappings made with the wizard. A missing file just
+// means nothing has been mapped yet.
+func loadUserSDLDB() []*mappingEntry {
+	var entries []*mappingEntry
+	f, err := os.Open(userControllerDbFile)
+	if err != nil {
+		return entries
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if e := parseMappingLine(line); e != nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// SaveUserMapping stores a mapping line in the user gamecontrollerdb,
+// replacing any earlier mapping for the same GUID.
+func SaveUserMapping(line string) error {
+	e := parseMappingLine(line)
+	if e == nil {
+		return fmt.Errorf("invalid mapping line: %s", line)
+	}
+
+	var lines []string
+	if data, err := os.ReadFile(userControllerDbFile); err == nil {
+		for _, l := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			if old := parseMappingLine(l); old != nil && old.guid == e.guid && old.platform == e.platform {
+				continue
+			}
+			lines = append(lines, l)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read user controller db: %w", err)
+	}
+	lines = append(lines, line)
+
+	if err := os.MkdirAll(filepath.Dir(userControllerDbFile), 0755); err != nil {
+		return fmt.Errorf("failed to create config folder: %w", err)
+	}
+	if err := os.WriteFile(userControllerDbFile, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write user controller db: %w", err)
+	}
+	return nil
+}
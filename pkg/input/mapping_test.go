@@ -0,0 +1,166 @@
+package input
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// pipeJoystick is a joystick reading from a pipe, with every axis resting
+// at 0. Events written to it are read by Capture like a real device's.
+type pipeJoystick struct {
+	*JoystickDevice
+	w int
+}
+
+func newPipeJoystick(t *testing.T) *pipeJoystick {
+	t.Helper()
+	var fds [2]int
+	if err := unix.Pipe2(fds[:], unix.O_NONBLOCK); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		unix.Close(fds[0])
+		unix.Close(fds[1])
+	})
+	return &pipeJoystick{
+		JoystickDevice: &JoystickDevice{
+			FD:      fds[0],
+			Buttons: make(map[int]int16),
+			Axes:    make(map[int]int16),
+			rest:    make(map[int]int16),
+		},
+		w: fds[1],
+	}
+}
+
+func (p *pipeJoystick) send(t *testing.T, typ byte, number int, value int16) {
+	t.Helper()
+	buf := make([]byte, jsEventSize)
+	binary.LittleEndian.PutUint16(buf[4:], uint16(value))
+	buf[6] = typ
+	buf[7] = byte(number)
+	if _, err := unix.Write(p.w, buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	button := MappingStep{Name: "a"}
+	axis := MappingStep{Name: "leftx", Axis: true}
+	trigger := MappingStep{Name: "lefttrigger"}
+
+	tests := []struct {
+		name   string
+		step   MappingStep
+		typ    byte
+		number int
+		value  int16
+		want   string
+	}{
+		{"button", button, 0x01, 3, 1, "b3"},
+		{"axis", axis, 0x02, 1, -32767, "a1"},
+		{"inverted axis", axis, 0x02, 1, 32767, "a1~"},
+		{"half axis up", MappingStep{Name: "dpup"}, 0x02, 6, -32767, "-a6"},
+		{"half axis down", MappingStep{Name: "dpdown"}, 0x02, 6, 32767, "+a6"},
+		{"trigger", trigger, 0x02, 2, 32767, "a2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newPipeJoystick(t)
+			// small movements and releases are ignored
+			j.send(t, 0x02, 0, 1000)
+			j.send(t, 0x01, 5, 0)
+			j.send(t, tt.typ, tt.number, tt.value)
+			j.send(t, tt.typ, tt.number, 0)
+
+			got, err := j.Capture(tt.step, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Capture() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureTimeout(t *testing.T) {
+	j := newPipeJoystick(t)
+
+	// a button press doesn't count for an axis step
+	j.send(t, 0x01, 0, 1)
+	j.send(t, 0x01, 0, 0)
+	if _, err := j.Capture(MappingStep{Name: "leftx", Axis: true}, 50*time.Millisecond); !errors.Is(err, ErrMappingSkipped) {
+		t.Errorf("Capture() error = %v, want ErrMappingSkipped", err)
+	}
+
+	// a control which is never released doesn't hold the capture up past
+	// its timeout
+	j.send(t, 0x01, 1, 1)
+	start := time.Now()
+	got, err := j.Capture(MappingStep{Name: "b"}, 100*time.Millisecond)
+	if err != nil || got != "b1" {
+		t.Errorf("Capture() = %q, %v, want b1", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Capture() waited %s for a release", elapsed)
+	}
+}
+
+func TestBuildMappingLine(t *testing.T) {
+	got := BuildMappingLine("03000000AABB", "Pad, Wireless", map[string]string{
+		"b":     "b1",
+		"a":     "b0",
+		"leftx": "a0",
+	})
+	want := "03000000aabb,Pad  Wireless,a:b0,b:b1,leftx:a0,platform:Linux,"
+	if got != want {
+		t.Errorf("BuildMappingLine() = %q, want %q", got, want)
+	}
+
+	e := parseMappingLine(got)
+	if e == nil || e.guid != "03000000aabb" || e.platform != "Linux" || e.mapping["leftx"] != "a0" {
+		t.Errorf("line doesn't parse back: %+v", e)
+	}
+}
+
+func TestSaveUserMapping(t *testing.T) {
+	old := userControllerDbFile
+	userControllerDbFile = filepath.Join(t.TempDir(), "config", "gamecontrollerdb_user.txt")
+	defer func() { userControllerDbFile = old }()
+
+	first := BuildMappingLine("0300aaaa", "Pad A", map[string]string{"a": "b0"})
+	other := BuildMappingLine("0300bbbb", "Pad B", map[string]string{"a": "b0"})
+	remapped := BuildMappingLine("0300aaaa", "Pad A", map[string]string{"a": "b2"})
+
+	for _, line := range []string{first, other, remapped} {
+		if err := SaveUserMapping(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(userControllerDbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := other + "\n" + remapped + "\n"; string(data) != want {
+		t.Errorf("saved mappings =\n%s\nwant\n%s", data, want)
+	}
+
+	entries := loadUserSDLDB()
+	if len(entries) != 2 || entries[1].mapping["a"] != "b2" {
+		t.Errorf("loaded %+v", entries)
+	}
+
+	if err := SaveUserMapping("not a mapping"); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("SaveUserMapping() of a bad line = %v", err)
+	}
+}
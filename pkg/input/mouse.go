@@ -13,15 +13,22 @@ import (
 )
 
 const (
-	reportSize = 3
+	reportSize      = 3
+	reportSizeWheel = 4
 )
 
+// imps2Init is the sample rate sequence which switches a PS/2 mouse, or the
+// kernel's mousedev emulation of one, into IntelliMouse mode. Reports are then
+// 4 bytes long with the scroll wheel in the last byte.
+var imps2Init = []byte{0xf3, 200, 0xf3, 100, 0xf3, 80}
+
 // MouseEvent is a decoded mouse packet
 type MouseEvent struct {
 	Timestamp int64
-	Device    string
+	Device    DeviceInfo
 	Buttons   []string
 	DX, DY    int8
+	DZ        int8 // scroll wheel, negative is up
 }
 
 // direction converts x and y deltas into a human readable description
@@ -51,54 +58,118 @@ func direction(dx, dy int8) string {
 
 // String renders a human-friendly representation of the mouse event.
 func (e MouseEvent) String() string {
-	return fmt.Sprintf("[%d ms] %s: Buttons[%s] Move[%s]",
+	wheel := "none"
+	if e.DZ < 0 {
+		wheel = "up"
+	} else if e.DZ > 0 {
+		wheel = "down"
+	}
+	return fmt.Sprintf("[%d ms] %s: Buttons[%s] Move[%s] Wheel[%s]",
 		e.Timestamp,
 		e.Device,
 		strings.Join(e.Buttons, ","),
-		direction(e.DX, e.DY))
+		direction(e.DX, e.DY),
+		wheel)
 }
 
 type MouseDevice struct {
-	Path string
-	FD   int
+	Path       string
+	Info       DeviceInfo
+	FD         int
+	ReportSize int
+}
+
+// enableWheel tries to switch the device into IntelliMouse mode and returns
+// the report size to use for it.
+func enableWheel(fd int) int {
+	if _, err := unix.Write(fd, imps2Init); err != nil {
+		return reportSize
+	}
+
+	// drain the acknowledgement bytes so they aren't parsed as a report
+	time.Sleep(10 * time.Millisecond)
+	buf := make([]byte, 64)
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != nil || n <= 0 {
+			break
+		}
+	}
+
+	return reportSizeWheel
 }
 
 func openMouseDevice(path string) (*MouseDevice, error) {
-	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK, 0)
-	if err != nil {
-		return nil, err
+	size := reportSize
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_NONBLOCK, 0)
+	if err == nil {
+		size = enableWheel(fd)
+	} else {
+		fd, err = unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK, 0)
+		if err != nil {
+			return nil, err
+		}
 	}
-	fmt.Printf("[+] Opened %s (fd=%d)\n", path, fd)
-	return &MouseDevice{Path: path, FD: fd}, nil
+
+	// /dev/input/mice is the kernel's merged stream of every mouse, so it
+	// has no identity of its own
+	name, bus, vid, pid, ver := "", 0, 0, 0, 0
+	if filepath.Base(path) != "mice" {
+		name, bus, vid, pid, ver = getInputMetadata(path)
+	}
+	info := newDeviceInfo(KindMouse, path, name, bus, vid, pid, ver)
+
+	logger.Info("opened %s (%s, fd=%d)", path, info, fd)
+	return &MouseDevice{Path: path, Info: info, FD: fd, ReportSize: size}, nil
 }
 
 func (m *MouseDevice) Close() {
 	if m.FD >= 0 {
 		_ = unix.Close(m.FD)
-		fmt.Printf("[-] Closed %s\n", m.Path)
+		logger.Info("closed %s", m.Path)
 		m.FD = -1
 	}
 }
 
 // ---- Singleton Stream ----
 var (
-	mouseOnce sync.Once
+	mouseMu   sync.Mutex
 	mouseChan chan MouseEvent
 )
 
 // StreamMouse returns a single shared channel of MouseEvent.
-// Only one goroutine is spawned, regardless of how many times it is called.
+// Only one goroutine is spawned, regardless of how many times it is called,
+// until the channel closes because watching the devices failed.
 func StreamMouse() <-chan MouseEvent {
-	mouseOnce.Do(func() {
-		mouseChan = make(chan MouseEvent, 100)
+	mouseMu.Lock()
+	defer mouseMu.Unlock()
+	if mouseChan == nil {
+		ch := make(chan MouseEvent, 100)
+		mouseChan = ch
 
 		go func() {
-			defer close(mouseChan)
+			defer func() {
+				mouseMu.Lock()
+				mouseChan = nil
+				mouseMu.Unlock()
+				close(ch)
+			}()
 			devices := map[string]*MouseDevice{}
+			byFd := func(fd int32) *MouseDevice {
+				for _, dev := range devices {
+					if int32(dev.FD) == fd {
+						return dev
+					}
+				}
+				return &MouseDevice{Info: DeviceInfo{Kind: KindMouse}, ReportSize: reportSize}
+			}
 
 			// initial scan
 			paths, _ := filepath.Glob("/dev/input/mouse*")
-			if _, err := os.Stat("/dev/input/mice"); err == nil {
+			// only fall back to the merged stream when there are no
+			// individual devices, otherwise every packet arrives twice and
+			// per-device settings can be bypassed
+			if _, err := os.Stat("/dev/input/mice"); err == nil && len(paths) == 0 {
 				paths = append(paths, "/dev/input/mice")
 			}
 			for _, path := range paths {
@@ -110,14 +181,14 @@ func StreamMouse() <-chan MouseEvent {
 			// inotify watch on /dev/input
 			inFd, err := unix.InotifyInit()
 			if err != nil {
-				fmt.Println("inotify init failed:", err)
+				logger.Error("inotify init failed: %s", err)
 				return
 			}
 			defer unix.Close(inFd)
 
 			_, err = unix.InotifyAddWatch(inFd, "/dev/input", unix.IN_CREATE|unix.IN_DELETE)
 			if err != nil {
-				fmt.Println("inotify addwatch failed:", err)
+				logger.Error("inotify addwatch failed: %s", err)
 				return
 			}
 
@@ -149,7 +220,7 @@ func StreamMouse() <-chan MouseEvent {
 							path := filepath.Join("/dev/input", name)
 
 							if raw.Mask&unix.IN_CREATE != 0 {
-								if filepath.Base(path) == "mice" || strings.HasPrefix(filepath.Base(path), "mouse") {
+								if strings.HasPrefix(filepath.Base(path), "mouse") {
 									if dev, err := openMouseDevice(path); err == nil {
 										devices[path] = dev
 									}
@@ -167,9 +238,10 @@ func StreamMouse() <-chan MouseEvent {
 
 					// Handle mouse data
 					if pfd.Fd != int32(inFd) && pfd.Revents&unix.POLLIN != 0 {
-						buf := make([]byte, reportSize)
+						dev := byFd(pfd.Fd)
+						buf := make([]byte, dev.ReportSize)
 						n, err := unix.Read(int(pfd.Fd), buf)
-						if err != nil || n < reportSize {
+						if err != nil || n < dev.ReportSize {
 							continue
 						}
 
@@ -184,18 +256,22 @@ func StreamMouse() <-chan MouseEvent {
 							buttons = append(buttons, "M")
 						}
 
-						mouseChan <- MouseEvent{
+						ev := MouseEvent{
 							Timestamp: time.Now().UnixMilli(),
-							Device:    fmt.Sprintf("fd=%d", pfd.Fd),
+							Device:    dev.Info,
 							Buttons:   buttons,
 							DX:        int8(buf[1]),
 							DY:        int8(buf[2]),
 						}
+						if dev.ReportSize == reportSizeWheel {
+							ev.DZ = int8(buf[3])
+						}
+						ch <- ev
 					}
 				}
 			}
 		}()
-	})
+	}
 
 	return mouseChan
 }
@@ -0,0 +1,267 @@
+package input
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bendahl/uinput"
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
+	"github.com/synrais/SAM-GO/pkg/utils"
+)
+
+// Recordings are plain text, one event per line in the same "<timestamp> ..."
+// layout as the gamelists:
+//
+//	<0.000> {"Device":{"Kind":"keyboard","Name":"USB Keyboard",...},"Name":"down"}
+//	<1.250> {"Device":{"Kind":"keyboard"},"Name":"enter"}
+//
+// The timestamp is seconds since the recording started. Lines starting with #
+// are comments, so a recording can be written or edited by hand.
+
+// RecordedEvent is an event together with its offset from the start of the
+// recording.
+type RecordedEvent struct {
+	Offset time.Duration
+	Event  Event
+}
+
+// Recorder writes normalized events to a recording file.
+type Recorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	start time.Time
+	now   func() time.Time
+}
+
+// NewRecorder creates (or truncates) a recording file. Offsets are measured
+// from the first recorded event.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	r := &Recorder{
+		file: f,
+		w:    bufio.NewWriter(f),
+		now:  time.Now,
+	}
+	fmt.Fprintf(r.w, "# SAM input recording, %s\n", time.Now().Format(time.RFC3339))
+	return r, nil
+}
+
+// Record appends a single event.
+func (r *Recorder) Record(ev Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if r.start.IsZero() {
+		r.start = now
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(r.w, "<%.3f> %s\n", now.Sub(r.start).Seconds(), data); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	// flush every line so a killed recording is still usable
+	return r.w.Flush()
+}
+
+// Tee records everything from in and passes it on to out, until in is closed.
+// It's meant to sit between RelayInputs and the usual consumer.
+func (r *Recorder) Tee(in <-chan Event, out chan<- Event) {
+	for ev := range in {
+		if err := r.Record(ev); err != nil {
+			logger.Error("recorder: %s", err)
+		}
+		if out != nil {
+			out <- ev
+		}
+	}
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return fmt.Errorf("failed to flush recording: %w", err)
+	}
+	return r.file.Close()
+}
+
+// LoadRecording reads a recording file, sorted by offset.
+func LoadRecording(path string) ([]RecordedEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer f.Close()
+
+	var events []RecordedEvent
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ts, body := utils.ParseLine(line)
+		var ev Event
+		if err := json.Unmarshal([]byte(body), &ev); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if ev.Name == "" {
+			return nil, fmt.Errorf("%s:%d: event has no name", path, lineNo)
+		}
+
+		events = append(events, RecordedEvent{
+			Offset: time.Duration(ts * float64(time.Second)),
+			Event:  ev,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	// hand edited files may be out of order, keep equal offsets stable
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Offset < events[j].Offset
+	})
+
+	return events, nil
+}
+
+// Replay calls inject for each event at its recorded offset. Speed scales the
+// timing, 2 plays twice as fast, and 0 plays everything back to back which is
+// what tests usually want. It stops at the first error.
+func Replay(events []RecordedEvent, speed float64, inject func(Event) error) error {
+	start := time.Now()
+	for _, re := range events {
+		if speed > 0 {
+			due := time.Duration(float64(re.Offset) / speed)
+			if wait := due - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		if err := inject(re.Event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplayToChannel injects a recording into a consumer channel, exactly where
+// RelayInputs would have sent the live events.
+func ReplayToChannel(events []RecordedEvent, speed float64, out chan<- Event) {
+	_ = Replay(events, speed, func(ev Event) error {
+		out <- ev
+		return nil
+	})
+}
+
+// -------- uinput replay ----------
+
+// sdlGamepadButtons maps SDL controller button names, as used for joystick
+// events, to uinput codes.
+var sdlGamepadButtons = map[string]int{
+	"a":             uinput.ButtonSouth,
+	"b":             uinput.ButtonEast,
+	"x":             uinput.ButtonWest,
+	"y":             uinput.ButtonNorth,
+	"back":          uinput.ButtonSelect,
+	"guide":         uinput.ButtonMode,
+	"start":         uinput.ButtonStart,
+	"leftstick":     uinput.ButtonThumbLeft,
+	"rightstick":    uinput.ButtonThumbRight,
+	"leftshoulder":  uinput.ButtonBumperLeft,
+	"rightshoulder": uinput.ButtonBumperRight,
+	"dpup":          uinput.ButtonDpadUp,
+	"dpdown":        uinput.ButtonDpadDown,
+	"dpleft":        uinput.ButtonDpadLeft,
+	"dpright":       uinput.ButtonDpadRight,
+	"lefttrigger+":  uinput.ButtonTriggerLeft,
+	"righttrigger+": uinput.ButtonTriggerRight,
+}
+
+// UinputInjector replays events through virtual devices so they reach
+// anything reading real input, such as the curses menus. Keyboard events go to
+// Keyboard and joystick events to Gamepad; either may be nil to skip that
+// kind. Mouse gestures have no uinput equivalent and are skipped.
+type UinputInjector struct {
+	Keyboard *virtualinput.Keyboard
+	Gamepad  *virtualinput.Gamepad
+}
+
+func (u UinputInjector) Inject(ev Event) error {
+	switch ev.Device.Kind {
+	case KindKeyboard:
+		if u.Keyboard == nil {
+			return nil
+		}
+		name := ev.Name
+		if len([]rune(name)) > 1 {
+			name = "{" + strings.ReplaceAll(strings.ToLower(name), " ", "") + "}"
+		}
+		code, ok := virtualinput.ToKeyboardCode(name)
+		if !ok {
+			logger.Warn("replay: no key for %q, skipping", ev.Name)
+			return nil
+		}
+		return u.Keyboard.Press(code)
+	case KindJoystick:
+		if u.Gamepad == nil {
+			return nil
+		}
+		name := strings.ToLower(ev.Name)
+		if code, ok := sdlGamepadButtons[name]; ok {
+			return u.Gamepad.Press(code)
+		}
+		return u.moveStick(name)
+	default:
+		return nil
+	}
+}
+
+// moveStick pushes a stick fully in the direction of an axis event like
+// "leftx-" and lets it go again.
+func (u UinputInjector) moveStick(name string) error {
+	if len(name) < 2 {
+		return nil
+	}
+	value := float32(1)
+	if strings.HasSuffix(name, "-") {
+		value = -1
+	} else if !strings.HasSuffix(name, "+") {
+		return nil
+	}
+
+	axis := name[:len(name)-1]
+	switch axis {
+	case "leftx", "lefty", "rightx", "righty":
+	default:
+		logger.Warn("replay: no gamepad control for %q, skipping", name)
+		return nil
+	}
+
+	if err := u.Gamepad.Axis(axis, value); err != nil {
+		return err
+	}
+	time.Sleep(u.Gamepad.Delay)
+	return u.Gamepad.Axis(axis, 0)
+}
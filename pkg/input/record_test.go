@@ -0,0 +1,87 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inputs.rec")
+
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec.now = func() time.Time { return clock }
+
+	pad := DeviceInfo{Kind: KindJoystick, Name: "8BitDo Pro 2", VidPid: "2dc8:6003"}
+	kbd := DeviceInfo{Kind: KindKeyboard, Path: "/dev/hidraw0"}
+	want := []RecordedEvent{
+		{0, Event{Device: kbd, Name: "down"}},
+		{250 * time.Millisecond, Event{Device: kbd, Name: "enter"}},
+		{1500 * time.Millisecond, Event{Device: pad, Name: "leftx-"}},
+	}
+	for _, re := range want {
+		clock = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(re.Offset)
+		if err := rec.Record(re.Event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	out := make(chan Event, len(got))
+	ReplayToChannel(got, 0, out)
+	close(out)
+	var names []string
+	for ev := range out {
+		names = append(names, ev.Name)
+	}
+	if len(names) != 3 || names[0] != "down" || names[1] != "enter" || names[2] != "leftx-" {
+		t.Errorf("replayed %v", names)
+	}
+}
+
+func TestLoadRecordingHandWritten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.rec")
+	data := `# open the options menu
+<1> {"Device":{"Kind":"keyboard"},"Name":"enter"}
+<0.5> {"Device":{"Kind":"keyboard"},"Name":"f2"}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Event.Name != "f2" || got[1].Offset != time.Second {
+		t.Errorf("got %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("<0> {\"Device\":{}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRecording(path); err == nil {
+		t.Error("expected error for event without a name")
+	}
+}
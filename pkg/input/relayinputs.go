@@ -1,107 +1,226 @@
 package input
 
 import (
-	"fmt"
 	"regexp"
 	"strings"
-	"strconv"
+	"sync"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/service"
+	"github.com/synrais/SAM-GO/pkg/utils"
 )
 
+var logger = service.Component("input")
+
+// Event is a single normalized input, tagged with the device it came from.
+type Event struct {
+	Device DeviceInfo
+	Name   string // e.g. "left", "a", "enter", "leftx-", "swipeleft"
+}
+
 // RelayInputs starts listeners for keyboard, mouse and joystick input.
 // It forwards all normalized events into the provided callback channel.
 // Other packages (search, attract, etc.) can consume them as they like.
-func RelayInputs(out chan<- string) {
+// Mouse packets go through a GestureRecognizer using the thresholds from
+// cfg, which may be nil to use the defaults. out is closed once every device
+// stream has ended.
+func RelayInputs(cfg *config.Config, out chan<- Event) {
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
 	// ---------------- KEYBOARD ----------------
 	go func() {
+		defer wg.Done()
 		re := regexp.MustCompile(`<([^>]+)>`)
-		for line := range StreamKeyboards() {
-			fmt.Println("[KEY]", line)
+		for ev := range StreamKeyboards() {
+			logger.Debug("key %s %s", ev.Device, ev.Key)
 
 			// Extract <tokens>
-			for _, m := range re.FindAllStringSubmatch(line, -1) {
-				key := strings.ToLower(m[1])
-				out <- key
+			for _, m := range re.FindAllStringSubmatch(ev.Key, -1) {
+				out <- Event{Device: ev.Device, Name: strings.ToLower(m[1])}
 			}
 
 			// Plain characters (letters, numbers…)
-			clean := re.ReplaceAllString(line, "")
+			clean := re.ReplaceAllString(ev.Key, "")
 			for _, r := range clean {
 				if r == '\n' || r == '\r' || r == ' ' {
 					continue
 				}
-				out <- string(r)
+				out <- Event{Device: ev.Device, Name: string(r)}
 			}
 		}
 	}()
 
 	// ---------------- MOUSE ----------------
 	go func() {
-		for ev := range StreamMouse() {
-			if ev.DX < 0 {
-				out <- "swipeleft"
-			} else if ev.DX > 0 {
-				out <- "swiperight"
-			}
-			if ev.DY < 0 {
-				out <- "swipedown"
-			} else if ev.DY > 0 {
-				out <- "swipeup"
+		defer wg.Done()
+		RecognizeGestures(gestureConfigFrom(cfg), StreamMouse(), out)
+	}()
+
+	// ---------------- JOYSTICK ----------------
+	go func() {
+		defer wg.Done()
+		for ev := range StreamJoysticks() {
+			for name, state := range ev.Buttons {
+				if state == "P" {
+					out <- Event{Device: ev.Device, Name: strings.ToLower(name)}
+				}
 			}
-			for _, b := range ev.Buttons {
-				switch b {
-				case "L":
-					out <- "left"
-				case "M":
-					out <- "middle"
-				case "R":
-					out <- "right"
+			for name, v := range ev.Axes {
+				if v < -20000 {
+					out <- Event{Device: ev.Device, Name: strings.ToLower(name) + "-"}
+				} else if v > 20000 {
+					out <- Event{Device: ev.Device, Name: strings.ToLower(name) + "+"}
 				}
 			}
 		}
 	}()
+}
 
-	// ---------------- JOYSTICK ----------------
-	go func() {
-		for line := range StreamJoysticks() {
-			l := strings.ToLower(line)
-			if bi := strings.Index(l, "buttons["); bi != -1 {
-				ei := strings.Index(l[bi:], "]")
-				if ei != -1 {
-					part := l[bi+len("buttons[") : bi+ei]
-					for _, item := range strings.Split(part, ",") {
-						kv := strings.Split(strings.TrimSpace(item), "=")
-						if len(kv) == 2 && kv[1] == "p" {
-							out <- kv[0]
-						}
-					}
+var (
+	subscribersMu sync.Mutex
+	subscribers   []chan Event
+	relaying      bool
+)
+
+// Subscribe returns a channel of every input event, with one set of device
+// listeners shared between all subscribers so a device is only read once.
+// The listeners start on the first call, using cfg for the gesture
+// settings. Events from SAM's own virtual devices aren't sent. A
+// subscriber which falls behind misses events rather than holding up the
+// others.
+//
+// If the listeners stop, every subscriber's channel is closed, and the next
+// call to Subscribe starts them again.
+func Subscribe(cfg *config.Config) <-chan Event {
+	return subscribe(cfg, RelayInputs)
+}
+
+func subscribe(cfg *config.Config, relay func(*config.Config, chan<- Event)) <-chan Event {
+	ch := make(chan Event, 64)
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribers = append(subscribers, ch)
+
+	if !relaying {
+		relaying = true
+		events := make(chan Event, 64)
+		relay(cfg, events)
+		go func() {
+			for ev := range events {
+				if ev.Device.IsVirtual() {
+					continue
 				}
-			}
-			if ai := strings.Index(l, "axes["); ai != -1 {
-				ei := strings.Index(l[ai:], "]")
-				if ei != -1 {
-					part := l[ai+len("axes[") : ai+ei]
-					for _, item := range strings.Split(part, ",") {
-						kv := strings.Split(strings.TrimSpace(item), "=")
-						if len(kv) == 2 {
-							v := parseAxisValue(kv[1])
-							if v < -20000 {
-								out <- kv[0] + "-"
-							} else if v > 20000 {
-								out <- kv[0] + "+"
-							}
-						}
+				subscribersMu.Lock()
+				for _, sub := range subscribers {
+					select {
+					case sub <- ev:
+					default:
 					}
 				}
+				subscribersMu.Unlock()
+			}
+
+			logger.Warn("input listeners stopped")
+			subscribersMu.Lock()
+			for _, sub := range subscribers {
+				close(sub)
 			}
+			subscribers = nil
+			relaying = false
+			subscribersMu.Unlock()
+		}()
+	}
+
+	return ch
+}
+
+// Unsubscribe stops sending events to a channel from Subscribe.
+func Unsubscribe(ch <-chan Event) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	for i, sub := range subscribers {
+		if sub == ch {
+			subscribers = append(subscribers[:i], subscribers[i+1:]...)
+			return
 		}
-	}()
+	}
+}
+
+// Bindings resolves events to actions using the [InputDetector] settings
+// from SAM.ini.
+type Bindings struct {
+	detector config.InputDetectorConfig
+	inputs   map[string]config.InputBindings
+}
+
+func NewBindings(cfg *config.Config) *Bindings {
+	return &Bindings{
+		detector: cfg.InputDetector,
+		inputs:   cfg.Inputs,
+	}
+}
+
+// Enabled reports whether events from this device should be considered at
+// all, taking the per-kind switches and the ignore list into account. SAM's
+// own virtual devices never are.
+func (b *Bindings) Enabled(dev DeviceInfo) bool {
+	if dev.IsVirtual() {
+		return false
+	}
+
+	switch dev.Kind {
+	case KindKeyboard:
+		if !b.detector.Keyboard {
+			return false
+		}
+	case KindMouse:
+		if !b.detector.Mouse {
+			return false
+		}
+	case KindJoystick:
+		if !b.detector.Joystick {
+			return false
+		}
+	}
+
+	for _, pattern := range b.detector.Ignore {
+		if dev.Matches(pattern) {
+			return false
+		}
+	}
+
+	return true
 }
 
-func parseAxisValue(s string) int {
-	end := strings.IndexAny(s, ", ")
-	if end >= 0 {
-		s = s[:end]
+// Action returns the action bound to an event. Device specific overrides take
+// precedence over the bindings for the device kind, and an override with an
+// empty value unbinds the input for that device.
+func (b *Bindings) Action(ev Event) (string, bool) {
+	if !b.Enabled(ev.Device) {
+		return "", false
+	}
+
+	kind, ok := b.inputs[ev.Device.Kind]
+	if !ok {
+		return "", false
 	}
-	v, _ := strconv.Atoi(strings.TrimSpace(s))
-	return v
+
+	name := strings.ToLower(ev.Name)
+
+	for _, pattern := range utils.SortedMapKeys(kind.Devices) {
+		if !ev.Device.Matches(pattern) {
+			continue
+		}
+		if action, ok := kind.Devices[pattern][name]; ok {
+			return action, action != ""
+		}
+	}
+
+	action, ok := kind.Actions[name]
+	return action, ok && action != ""
 }
@@ -0,0 +1,160 @@
+package input
+
+import (
+	"testing"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
+)
+
+func testBindings() *Bindings {
+	return NewBindings(&config.Config{
+		InputDetector: config.InputDetectorConfig{
+			Keyboard: true,
+			Joystick: true,
+			Ignore:   []string{"*light gun*", "0079:0006"},
+		},
+		Inputs: map[string]config.InputBindings{
+			KindKeyboard: {
+				Actions: map[string]string{"left": "back", "right": "next"},
+			},
+			KindJoystick: {
+				Actions: map[string]string{"dpleft": "back", "dpright": "next"},
+				Devices: map[string]map[string]string{
+					"2dc8:6101": {"start": "next", "dpleft": ""},
+					"*sn30*":    {"start": "back", "select": "back"},
+				},
+			},
+		},
+	})
+}
+
+func TestBindingsEnabled(t *testing.T) {
+	b := testBindings()
+
+	tests := []struct {
+		dev  DeviceInfo
+		want bool
+	}{
+		{DeviceInfo{Kind: KindKeyboard, Name: "AT keyboard"}, true},
+		{DeviceInfo{Kind: KindJoystick, Name: "Pad"}, true},
+		// the mouse is switched off
+		{DeviceInfo{Kind: KindMouse, Name: "USB mouse"}, false},
+		{DeviceInfo{Kind: KindJoystick, Name: "Sinden Light Gun"}, false},
+		{DeviceInfo{Kind: KindJoystick, Name: "Pad", VidPid: "0079:0006"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := b.Enabled(tt.dev); got != tt.want {
+			t.Errorf("Enabled(%s %s) = %v, want %v", tt.dev.Kind, tt.dev, got, tt.want)
+		}
+	}
+}
+
+func TestBindingsAction(t *testing.T) {
+	b := testBindings()
+	keyboard := DeviceInfo{Kind: KindKeyboard, Name: "AT keyboard"}
+	pad := DeviceInfo{Kind: KindJoystick, Name: "Generic Pad"}
+	sn30 := DeviceInfo{Kind: KindJoystick, Name: "8BitDo SN30 Pro", VidPid: "2dc8:6101"}
+
+	tests := []struct {
+		dev    DeviceInfo
+		name   string
+		want   string
+		wantOk bool
+	}{
+		{keyboard, "left", "back", true},
+		{keyboard, "RIGHT", "next", true},
+		{keyboard, "a", "", false},
+		{pad, "dpleft", "back", true},
+		{pad, "start", "", false},
+		// overrides beat the kind's bindings, and are tried in pattern
+		// order, so *sn30* comes before 2dc8:6101
+		{sn30, "start", "back", true},
+		{sn30, "select", "back", true},
+		{sn30, "dpright", "next", true},
+		// an empty override unbinds the input
+		{sn30, "dpleft", "", false},
+		{DeviceInfo{Kind: KindMouse, Name: "USB mouse"}, "left", "", false},
+		{DeviceInfo{Kind: KindJoystick, Name: "Light Gun"}, "dpleft", "", false},
+	}
+
+	for _, tt := range tests {
+		action, ok := b.Action(Event{Device: tt.dev, Name: tt.name})
+		if action != tt.want || ok != tt.wantOk {
+			t.Errorf("Action(%s, %s) = %q, %v, want %q, %v", tt.dev, tt.name, action, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestBindingsIgnoreVirtualDevices(t *testing.T) {
+	b := NewBindings(&config.Config{
+		InputDetector: config.InputDetectorConfig{Keyboard: true, Joystick: true},
+		Inputs: map[string]config.InputBindings{
+			KindKeyboard: {Actions: map[string]string{"right": "next"}},
+		},
+	})
+
+	for _, kind := range []string{KindKeyboard, KindJoystick} {
+		dev := DeviceInfo{Kind: kind, Name: virtualinput.DeviceName}
+		if b.Enabled(dev) {
+			t.Errorf("SAM's virtual %s is enabled", kind)
+		}
+	}
+
+	ev := Event{Device: DeviceInfo{Kind: KindKeyboard, Name: virtualinput.DeviceName}, Name: "right"}
+	if action, ok := b.Action(ev); ok {
+		t.Errorf("virtual keyboard bound to %q", action)
+	}
+	ev.Device.Name = "AT Translated Set 2 keyboard"
+	if action, ok := b.Action(ev); !ok || action != "next" {
+		t.Errorf("Action() = %q, %v, want next", action, ok)
+	}
+}
+
+func TestSubscribeRestartsRelay(t *testing.T) {
+	var relays []chan<- Event
+	relay := func(_ *config.Config, out chan<- Event) {
+		relays = append(relays, out)
+	}
+
+	a := subscribe(nil, relay)
+	b := subscribe(nil, relay)
+	if len(relays) != 1 {
+		t.Fatalf("started %d relays, want 1", len(relays))
+	}
+
+	relays[0] <- Event{Device: DeviceInfo{Kind: KindKeyboard, Name: virtualinput.DeviceName}, Name: "a"}
+	relays[0] <- Event{Device: DeviceInfo{Kind: KindKeyboard}, Name: "b"}
+	for _, ch := range []<-chan Event{a, b} {
+		if ev := <-ch; ev.Name != "b" {
+			t.Errorf("got event %q, want b", ev.Name)
+		}
+	}
+
+	// subscribers are told when the relay ends
+	close(relays[0])
+	for _, ch := range []<-chan Event{a, b} {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Error("got an event after the relay ended")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscriber channel wasn't closed")
+		}
+	}
+	Unsubscribe(a)
+
+	c := subscribe(nil, relay)
+	defer Unsubscribe(c)
+	if len(relays) != 2 {
+		t.Fatalf("relay wasn't restarted, %d started", len(relays))
+	}
+	defer close(relays[1])
+	relays[1] <- Event{Device: DeviceInfo{Kind: KindMouse}, Name: "c"}
+	if ev := <-c; ev.Name != "c" {
+		t.Errorf("got event %q, want c", ev.Name)
+	}
+}
@@ -137,3 +137,40 @@ func (k *Gamepad) Combo(keys ...int) error {
 	}
 	return nil
 }
+
+// Hold presses a button down and leaves it down until Release.
+func (k *Gamepad) Hold(key int) error {
+	if err := k.Device.ButtonDown(key); err != nil {
+		return fmt.Errorf("failed to hold gamepad button: %w", err)
+	}
+	return nil
+}
+
+func (k *Gamepad) Release(key int) error {
+	if err := k.Device.ButtonUp(key); err != nil {
+		return fmt.Errorf("failed to release gamepad button: %w", err)
+	}
+	return nil
+}
+
+// Axis moves one stick axis ("leftx", "lefty", "rightx" or "righty") to a
+// position between -1 and 1, where it stays until moved again.
+func (k *Gamepad) Axis(axis string, value float32) error {
+	var err error
+	switch axis {
+	case "leftx":
+		err = k.Device.LeftStickMoveX(value)
+	case "lefty":
+		err = k.Device.LeftStickMoveY(value)
+	case "rightx":
+		err = k.Device.RightStickMoveX(value)
+	case "righty":
+		err = k.Device.RightStickMoveY(value)
+	default:
+		return fmt.Errorf("unknown gamepad axis: %s", axis)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move gamepad axis: %w", err)
+	}
+	return nil
+}
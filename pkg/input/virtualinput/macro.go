@@ -0,0 +1,128 @@
+package virtualinput
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A macro is a short script of gamepad actions separated by semicolons or
+// newlines, for example:
+//
+//	wait 10s; press east; hold start; wait 500ms; release start; axis leftx -1
+//
+// Commands:
+//
+//	press <button>        press and release, using the gamepad delay
+//	hold <button>         press and keep holding
+//	release <button>      let go of a held button
+//	wait <duration>       e.g. 1s, 250ms, or a plain number of milliseconds
+//	axis <axis> <value>   move leftx/lefty/rightx/righty to -1..1
+//
+// Buttons use the same names as GamepadMap, with or without braces, so
+// "east", "{east}" and "start" all work.
+
+type MacroStep struct {
+	Cmd    string
+	Button int
+	Axis   string
+	Value  float32
+	Wait   time.Duration
+}
+
+func macroButton(name string) (int, bool) {
+	if code, ok := ToGamepadCode(name); ok {
+		return code, true
+	}
+	return ToGamepadCode("{" + strings.ToLower(strings.Trim(name, "{}")) + "}")
+}
+
+// ParseMacro checks a macro script and turns it into steps.
+func ParseMacro(script string) ([]MacroStep, error) {
+	var steps []MacroStep
+
+	lines := strings.FieldsFunc(script, func(r rune) bool {
+		return r == ';' || r == '\n'
+	})
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		cmd := strings.ToLower(fields[0])
+		args := fields[1:]
+		step := MacroStep{Cmd: cmd}
+
+		switch cmd {
+		case "press", "hold", "release":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("%s needs one button: %q", cmd, line)
+			}
+			code, ok := macroButton(args[0])
+			if !ok {
+				return nil, fmt.Errorf("unknown button: %s", args[0])
+			}
+			step.Button = code
+		case "wait":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("wait needs a duration: %q", line)
+			}
+			d, err := time.ParseDuration(args[0])
+			if err != nil {
+				ms, msErr := strconv.Atoi(args[0])
+				if msErr != nil {
+					return nil, fmt.Errorf("invalid duration: %s", args[0])
+				}
+				d = time.Duration(ms) * time.Millisecond
+			}
+			step.Wait = d
+		case "axis":
+			if len(args) != 2 {
+				return nil, fmt.Errorf("axis needs an axis and a value: %q", line)
+			}
+			axis := strings.ToLower(args[0])
+			switch axis {
+			case "leftx", "lefty", "rightx", "righty":
+			default:
+				return nil, fmt.Errorf("unknown axis: %s", args[0])
+			}
+			v, err := strconv.ParseFloat(args[1], 32)
+			if err != nil || v < -1 || v > 1 {
+				return nil, fmt.Errorf("axis value must be between -1 and 1: %s", args[1])
+			}
+			step.Axis = axis
+			step.Value = float32(v)
+		default:
+			return nil, fmt.Errorf("unknown macro command: %s", fields[0])
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// RunMacro plays macro steps on the gamepad, stopping at the first error.
+func (k *Gamepad) RunMacro(steps []MacroStep) error {
+	for _, step := range steps {
+		var err error
+		switch step.Cmd {
+		case "press":
+			err = k.Press(step.Button)
+		case "hold":
+			err = k.Hold(step.Button)
+		case "release":
+			err = k.Release(step.Button)
+		case "wait":
+			time.Sleep(step.Wait)
+		case "axis":
+			err = k.Axis(step.Axis, step.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package virtualinput
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bendahl/uinput"
+)
+
+func TestParseMacro(t *testing.T) {
+	steps, err := ParseMacro("wait 10s; press east\nhold {start}; wait 250; release start; axis leftx -1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []MacroStep{
+		{Cmd: "wait", Wait: 10 * time.Second},
+		{Cmd: "press", Button: uinput.ButtonEast},
+		{Cmd: "hold", Button: uinput.ButtonStart},
+		{Cmd: "wait", Wait: 250 * time.Millisecond},
+		{Cmd: "release", Button: uinput.ButtonStart},
+		{Cmd: "axis", Axis: "leftx", Value: -1},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(steps), len(want))
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("step %d: got %+v, want %+v", i, steps[i], want[i])
+		}
+	}
+}
+
+func TestParseMacroErrors(t *testing.T) {
+	bad := []string{
+		"jump",
+		"press",
+		"press turbo",
+		"wait soon",
+		"axis leftz 1",
+		"axis leftx 2",
+	}
+	for _, script := range bad {
+		if _, err := ParseMacro(script); err == nil {
+			t.Errorf("expected error for %q", script)
+		}
+	}
+}
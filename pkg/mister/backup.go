@@ -0,0 +1,158 @@
+package mister
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/utils"
+)
+
+// BackupsFolder is where copies of system files are kept before they're
+// changed. Each backup mirrors the original's path, with the time it was
+// made added to the name:
+//
+//	backups/media/fat/MiSTer.ini.20240102-150405.000
+var BackupsFolder = config.BackupsFolder
+
+// BackupRetention is how many backups are kept of each file.
+var BackupRetention = 10
+
+const backupTimeFormat = "20060102-150405.000"
+
+// Backup is a saved copy of a file.
+type Backup struct {
+	Original string // the file it's a copy of
+	Path     string // the copy
+	Time     time.Time
+}
+
+func backupPath(original string, t time.Time) string {
+	abs, err := filepath.Abs(original)
+	if err != nil {
+		abs = original
+	}
+	return filepath.Join(BackupsFolder, abs) + "." + t.Format(backupTimeFormat)
+}
+
+// BackupFile copies a file into BackupsFolder, then removes its oldest
+// backups over BackupRetention. A file which doesn't exist isn't backed up,
+// and an empty path is returned.
+func BackupFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	// saves can come quicker than the timestamps change
+	now := time.Now()
+	dest := backupPath(path, now)
+	for {
+		if _, err := os.Stat(dest); os.IsNotExist(err) {
+			break
+		}
+		now = now.Add(time.Millisecond)
+		dest = backupPath(path, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	if err := utils.WriteFileAtomic(dest, data, 0644); err != nil {
+		return "", fmt.Errorf("error backing up %s: %w", path, err)
+	}
+
+	backups, err := ListBackups(path)
+	if err != nil {
+		return dest, err
+	}
+	for i := BackupRetention; i < len(backups); i++ {
+		if err := os.Remove(backups[i].Path); err != nil {
+			return dest, err
+		}
+	}
+
+	return dest, nil
+}
+
+// SafeWriteFile backs up a file and then replaces it atomically, so a power
+// cut leaves either the old or the new file and never a broken one.
+func SafeWriteFile(path string, data []byte) error {
+	if _, err := BackupFile(path); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, data, 0644)
+}
+
+// ListBackups lists the backups of a file, newest first. If path is empty,
+// the backups of every file are listed.
+func ListBackups(path string) ([]Backup, error) {
+	root, abs := BackupsFolder, ""
+	if path != "" {
+		var err error
+		abs, err = filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		root = filepath.Join(BackupsFolder, filepath.Dir(abs))
+	}
+
+	var backups []Backup
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if abs != "" && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := filepath.Ext(p)
+		stamp := strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(p, ext)), ".") + ext
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			// not a backup
+			return nil
+		}
+
+		original := strings.TrimSuffix(p, "."+stamp)
+		original = "/" + strings.TrimPrefix(original, filepath.Clean(BackupsFolder)+"/")
+		if abs != "" && original != abs {
+			return nil
+		}
+
+		backups = append(backups, Backup{
+			Original: original,
+			Path:     p,
+			Time:     t,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// RestoreBackup puts a backup back in place of its original. The file being
+// replaced is backed up first, so a restore can be undone.
+func RestoreBackup(backup Backup) error {
+	data, err := os.ReadFile(backup.Path)
+	if err != nil {
+		return err
+	}
+	return SafeWriteFile(backup.Original, data)
+}
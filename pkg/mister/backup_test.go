@@ -0,0 +1,87 @@
+package mister
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setBackupsFolder(t *testing.T) {
+	t.Helper()
+	old := BackupsFolder
+	BackupsFolder = t.TempDir()
+	t.Cleanup(func() { BackupsFolder = old })
+}
+
+func TestSafeWriteFile(t *testing.T) {
+	setBackupsFolder(t)
+	oldRetention := BackupRetention
+	BackupRetention = 3
+	defer func() { BackupRetention = oldRetention }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "u-boot.txt")
+	other := filepath.Join(dir, "sub", "u-boot.txt")
+	if err := os.MkdirAll(filepath.Dir(other), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing to back up the first time
+	if err := SafeWriteFile(path, []byte("v0")); err != nil {
+		t.Fatal(err)
+	}
+	if backups, err := ListBackups(path); err != nil || len(backups) != 0 {
+		t.Fatalf("ListBackups() = %v, %v", backups, err)
+	}
+
+	for _, data := range []string{"v1", "v2", "v3", "v4"} {
+		if err := SafeWriteFile(path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SafeWriteFile(other, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := SafeWriteFile(other, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "v4" {
+		t.Errorf("file = %q, want v4", data)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(tmps) != 0 {
+		t.Errorf("temp files left behind: %v", tmps)
+	}
+
+	backups, err := ListBackups(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("got %d backups, want 3", len(backups))
+	}
+	want := []string{"v3", "v2", "v1"}
+	for i, b := range backups {
+		if b.Original != path {
+			t.Errorf("backup %d original = %q, want %q", i, b.Original, path)
+		}
+		if data, _ := os.ReadFile(b.Path); string(data) != want[i] {
+			t.Errorf("backup %d = %q, want %q", i, data, want[i])
+		}
+	}
+
+	if all, err := ListBackups(""); err != nil || len(all) != 4 {
+		t.Errorf("ListBackups(\"\") got %d backups, %v, want 4", len(all), err)
+	}
+
+	if err := RestoreBackup(backups[2]); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "v1" {
+		t.Errorf("restored file = %q, want v1", data)
+	}
+	backups, _ = ListBackups(path)
+	if data, _ := os.ReadFile(backups[0].Path); string(data) != "v4" {
+		t.Errorf("newest backup after restore = %q, want v4", data)
+	}
+}
@@ -0,0 +1,199 @@
+package mister
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+// Commander sends commands to the MiSTer main binary. Everything that would
+// otherwise write to /dev/MiSTer_cmd goes through the active commander, so it
+// can be swapped for a recording one on a machine without a MiSTer.
+type Commander interface {
+	LoadCore(path string) error
+	SetVideoMode(width, height int) error
+	Screenshot(name string) error
+	Send(cmd string) error
+}
+
+func loadCoreCmd(path string) string {
+	return fmt.Sprintf("load_core %s", path)
+}
+
+// fb_cmd1 $fmt $rb $width $height
+func videoModeCmd(width, height int) string {
+	return fmt.Sprintf(
+		"fb_cmd1 %s %c %d %d",
+		VideoModeFormatRGB32[1:],
+		VideoModeFormatRGB32[0],
+		width,
+		height,
+	)
+}
+
+func screenshotCmd(name string) string {
+	if name == "" {
+		return "screenshot"
+	}
+	return fmt.Sprintf("screenshot %s", name)
+}
+
+// MaxVolume is the highest level accepted by SetVolume.
+const MaxVolume = 7
+
+func volumeCmd(level int) string {
+	return fmt.Sprintf("volume %d", level)
+}
+
+// --------------------------------------------------
+// Device
+// --------------------------------------------------
+
+// DeviceCommander writes commands to the MiSTer command interface.
+type DeviceCommander struct {
+	Path string
+}
+
+func NewDeviceCommander(path string) *DeviceCommander {
+	return &DeviceCommander{Path: path}
+}
+
+func (d *DeviceCommander) Send(command string) error {
+	if _, err := os.Stat(d.Path); err != nil {
+		return fmt.Errorf("command interface not accessible: %s", err)
+	}
+
+	cmd, err := os.OpenFile(d.Path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer cmd.Close()
+
+	if _, err := cmd.WriteString(command + "\n"); err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+	return nil
+}
+
+func (d *DeviceCommander) LoadCore(path string) error {
+	return d.Send(loadCoreCmd(path))
+}
+
+func (d *DeviceCommander) SetVideoMode(width, height int) error {
+	return d.Send(videoModeCmd(width, height))
+}
+
+func (d *DeviceCommander) Screenshot(name string) error {
+	return d.Send(screenshotCmd(name))
+}
+
+// --------------------------------------------------
+// Recording
+// --------------------------------------------------
+
+// RecordingCommander keeps commands in memory instead of running them, for
+// tests and dry runs. If Echo is set each command is also printed to it.
+type RecordingCommander struct {
+	Echo     io.Writer
+	mu       sync.Mutex
+	commands []string
+}
+
+func (r *RecordingCommander) Send(command string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.commands = append(r.commands, command)
+	if r.Echo != nil {
+		fmt.Fprintf(r.Echo, "[DRY-RUN] %s\n", command)
+	}
+	return nil
+}
+
+func (r *RecordingCommander) LoadCore(path string) error {
+	return r.Send(loadCoreCmd(path))
+}
+
+func (r *RecordingCommander) SetVideoMode(width, height int) error {
+	return r.Send(videoModeCmd(width, height))
+}
+
+func (r *RecordingCommander) Screenshot(name string) error {
+	return r.Send(screenshotCmd(name))
+}
+
+// Commands returns a copy of everything sent so far.
+func (r *RecordingCommander) Commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.commands...)
+}
+
+// --------------------------------------------------
+// Active commander
+// --------------------------------------------------
+
+var (
+	commanderMu sync.RWMutex
+	commander   Commander = NewDeviceCommander(config.CmdInterface)
+	dryRun      bool
+)
+
+// SetCommander replaces the commander used by the launchers, ending any dry
+// run.
+func SetCommander(c Commander) {
+	commanderMu.Lock()
+	defer commanderMu.Unlock()
+	commander = c
+	dryRun = false
+}
+
+func GetCommander() Commander {
+	commanderMu.RLock()
+	defer commanderMu.RUnlock()
+	return commander
+}
+
+// EnableDryRun makes every MiSTer command get printed to stdout instead of
+// being run. Launches don't change anything else either: files they would
+// write, mounts and side launchers are skipped and printed instead.
+func EnableDryRun() *RecordingCommander {
+	rc := &RecordingCommander{Echo: os.Stdout}
+	commanderMu.Lock()
+	defer commanderMu.Unlock()
+	commander = rc
+	dryRun = true
+	return rc
+}
+
+// DryRun reports whether EnableDryRun is in effect.
+func DryRun() bool {
+	commanderMu.RLock()
+	defer commanderMu.RUnlock()
+	return dryRun
+}
+
+// skipForDryRun reports whether a change to the device should be skipped
+// because of a dry run, printing what was skipped alongside the commands.
+func skipForDryRun(format string, v ...any) bool {
+	if !DryRun() {
+		return false
+	}
+	if rc, ok := GetCommander().(*RecordingCommander); ok && rc.Echo != nil {
+		fmt.Fprintf(rc.Echo, "[DRY-RUN] skipped: "+format+"\n", v...)
+	}
+	return true
+}
+
+// SetVolume sets the MiSTer's output volume, from 0 to MaxVolume, the same
+// steps as the OSD volume setting.
+func SetVolume(level int) error {
+	if level < 0 || level > MaxVolume {
+		return fmt.Errorf("volume must be 0 to %d: %d", MaxVolume, level)
+	}
+	return GetCommander().Send(volumeCmd(level))
+}
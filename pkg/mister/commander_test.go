@@ -0,0 +1,96 @@
+package mister
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/games"
+)
+
+func TestRecordingCommander(t *testing.T) {
+	rc := &RecordingCommander{}
+	old := GetCommander()
+	SetCommander(rc)
+	defer SetCommander(old)
+
+	if err := launchFile("/media/fat/games/SNES/game.mgl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := launchFile("/media/fat/games/SNES/game.sfc"); err == nil {
+		t.Error("expected error for non launch file")
+	}
+	if err := SetVideoMode(640, 480); err != nil {
+		t.Fatal(err)
+	}
+	if err := LaunchMenu(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetVolume(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetVolume(MaxVolume + 1); err == nil {
+		t.Error("expected error for out of range volume")
+	}
+
+	want := []string{
+		"load_core /media/fat/games/SNES/game.mgl",
+		"fb_cmd1 8888 1 640 480",
+		"load_core /media/fat/menu.rbf",
+		"volume 5",
+	}
+	if got := rc.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commands() = %q, want %q", got, want)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	old := GetCommander()
+	rc := EnableDryRun()
+	defer SetCommander(old)
+	var out bytes.Buffer
+	rc.Echo = &out
+
+	before, _ := os.Stat(config.LastLaunchFile)
+
+	cfg := &config.UserConfig{}
+	snes, err := games.GetSystem("SNES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LaunchGenericFileAs(cfg, *snes, "/media/fat/games/SNES/game.sfc"); err != nil {
+		t.Fatal(err)
+	}
+	// side launchers mount and patch files, they aren't run at all
+	amiga := games.System{Id: "AmigaVision"}
+	if err := LaunchGame(cfg, amiga, "/media/fat/games/Amiga/listings/games/Turrican.ags"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"load_core " + config.LastLaunchFile}
+	if got := rc.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commands() = %q, want %q", got, want)
+	}
+	for _, skipped := range []string{
+		"skipped: write " + config.LastLaunchFile,
+		"game.sfc",
+		"skipped: AmigaVision side launcher",
+	} {
+		if !strings.Contains(out.String(), skipped) {
+			t.Errorf("output doesn't mention %q:\n%s", skipped, out.String())
+		}
+	}
+
+	after, _ := os.Stat(config.LastLaunchFile)
+	if (before == nil) != (after == nil) || (after != nil && !after.ModTime().Equal(before.ModTime())) {
+		t.Errorf("%s was written", config.LastLaunchFile)
+	}
+
+	SetCommander(old)
+	if DryRun() {
+		t.Error("dry run still on after SetCommander")
+	}
+}
@@ -0,0 +1,146 @@
+package mister
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	s "strings"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/games"
+)
+
+var (
+	// ErrLaunchTimeout means the core or game never showed up.
+	ErrLaunchTimeout = errors.New("timed out waiting for launch")
+	// ErrReturnedToMenu means a core started but MiSTer fell back to the
+	// menu before the launch was confirmed, usually a crash or bad file.
+	ErrReturnedToMenu = errors.New("returned to menu")
+)
+
+// LaunchError describes a launch which couldn't be confirmed. It wraps one of
+// the sentinel errors above so callers can use errors.Is.
+type LaunchError struct {
+	Err        error
+	ActiveCore string
+	Path       string
+}
+
+func (e *LaunchError) Error() string {
+	msg := fmt.Sprintf("launch not confirmed: %s (core %q", e.Err, e.ActiveCore)
+	if e.Path != "" {
+		msg += fmt.Sprintf(", game %s", e.Path)
+	}
+	return msg + ")"
+}
+
+func (e *LaunchError) Unwrap() error {
+	return e.Err
+}
+
+// LaunchWatcher confirms launches by watching the files MiSTer updates when a
+// core or game is loaded. The file paths are fields so tests can point them
+// at a fake tree.
+type LaunchWatcher struct {
+	CoreNameFile    string
+	CurrentPathFile string
+	FullPathFile    string
+	Timeout         time.Duration
+	Interval        time.Duration
+}
+
+func NewLaunchWatcher(timeout time.Duration) *LaunchWatcher {
+	return &LaunchWatcher{
+		CoreNameFile:    config.CoreNameFile,
+		CurrentPathFile: config.CurrentPathFile,
+		FullPathFile:    config.FullPathFile,
+		Timeout:         timeout,
+		Interval:        100 * time.Millisecond,
+	}
+}
+
+func readTrimmed(path string) (string, time.Time) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", time.Time{}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", time.Time{}
+	}
+	return s.TrimSpace(string(data)), info.ModTime()
+}
+
+// gameLoaded reports whether CURRENTPATH or FULLPATH were changed after since
+// to refer to the game.
+func (w *LaunchWatcher) gameLoaded(path string, since time.Time) bool {
+	want := s.ToLower(filepath.Base(path))
+	for _, f := range []string{w.CurrentPathFile, w.FullPathFile} {
+		got, modified := readTrimmed(f)
+		if got != "" && !modified.Before(since) && s.HasSuffix(s.ToLower(got), want) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait blocks until a core other than the menu is running and, if path isn't
+// empty, the game is loaded in it. Only changes made after since count, so a
+// core or game which was already running before the launch isn't mistaken
+// for the new one.
+//
+// Cores don't all report their rbf name as CORENAME, TGFX16 among them, so
+// any core starting counts and the game path confirms it's the right one.
+func (w *LaunchWatcher) Wait(path string, since time.Time) error {
+	deadline := time.Now().Add(w.Timeout)
+	started := false
+	core := ""
+
+	for {
+		var modified time.Time
+		core, modified = readTrimmed(w.CoreNameFile)
+		changed := !modified.Before(since)
+
+		if core == config.MenuCore || core == "" {
+			if started {
+				return &LaunchError{Err: ErrReturnedToMenu, ActiveCore: core, Path: path}
+			}
+		} else if changed {
+			started = true
+			if path == "" || w.gameLoaded(path, since) {
+				return nil
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			return &LaunchError{Err: ErrLaunchTimeout, ActiveCore: core, Path: path}
+		}
+		time.Sleep(w.Interval)
+	}
+}
+
+// confirmPath returns the file MiSTer will report as loaded when a game is
+// launched, or "" if the launch can only be confirmed by a core starting.
+func confirmPath(system games.System, path string) string {
+	// MiSTer doesn't update CURRENTPATH for arcade launches
+	if s.EqualFold(filepath.Ext(path), ".mra") {
+		return ""
+	}
+	// side launchers which mount or patch files boot something else
+	if sl, ok := lookupSideLauncher(system.Id); ok && !sl.loadsGame {
+		return ""
+	}
+	return path
+}
+
+// LaunchGameAndWait is LaunchGame followed by a confirmation that the core
+// and game actually loaded. Failures are returned as *LaunchError.
+func LaunchGameAndWait(cfg *config.UserConfig, system games.System, path string, timeout time.Duration) error {
+	since := time.Now()
+	if err := LaunchGame(cfg, system, path); err != nil {
+		return err
+	}
+	return NewLaunchWatcher(timeout).Wait(confirmPath(system, path), since)
+}
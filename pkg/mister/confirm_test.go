@@ -0,0 +1,171 @@
+package mister
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/games"
+)
+
+func fakeTmp(t *testing.T) *LaunchWatcher {
+	dir := t.TempDir()
+	w := &LaunchWatcher{
+		CoreNameFile:    filepath.Join(dir, "CORENAME"),
+		CurrentPathFile: filepath.Join(dir, "CURRENTPATH"),
+		FullPathFile:    filepath.Join(dir, "FULLPATH"),
+		Timeout:         500 * time.Millisecond,
+		Interval:        5 * time.Millisecond,
+	}
+	write(t, w.CoreNameFile, "MENU")
+	return w
+}
+
+// write is also called from goroutines, so it can't use t.Fatal
+func write(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLaunchWatcherConfirmed(t *testing.T) {
+	w := fakeTmp(t)
+	since := time.Now()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		write(t, w.CoreNameFile, "SNES")
+		time.Sleep(20 * time.Millisecond)
+		write(t, w.CurrentPathFile, "Super Mario World (USA).sfc")
+	}()
+
+	if err := w.Wait("/media/fat/games/SNES/Super Mario World (USA).sfc", since); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLaunchWatcherTimeout(t *testing.T) {
+	w := fakeTmp(t)
+	since := time.Now()
+
+	// a core loads and the game never shows up
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		write(t, w.CoreNameFile, "NES")
+	}()
+
+	err := w.Wait("/media/fat/games/SNES/game.sfc", since)
+	var launchErr *LaunchError
+	if !errors.As(err, &launchErr) || !errors.Is(err, ErrLaunchTimeout) {
+		t.Fatalf("got %v, want timeout", err)
+	}
+	if launchErr.ActiveCore != "NES" {
+		t.Errorf("ActiveCore = %q, want NES", launchErr.ActiveCore)
+	}
+}
+
+func TestLaunchWatcherReturnedToMenu(t *testing.T) {
+	w := fakeTmp(t)
+	since := time.Now()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		write(t, w.CoreNameFile, "PSX")
+		time.Sleep(20 * time.Millisecond)
+		write(t, w.CoreNameFile, "MENU")
+	}()
+
+	err := w.Wait("/media/fat/games/PSX/game.chd", since)
+	if !errors.Is(err, ErrReturnedToMenu) {
+		t.Fatalf("got %v, want returned to menu", err)
+	}
+}
+
+func TestLaunchWatcherIgnoresStaleCore(t *testing.T) {
+	w := fakeTmp(t)
+	write(t, w.CoreNameFile, "SNES")
+	write(t, w.FullPathFile, "games/SNES/game.sfc")
+
+	// nothing changed after the launch, so the old state doesn't count
+	since := time.Now().Add(time.Second)
+	if err := w.Wait("/media/fat/games/SNES/game.sfc", since); !errors.Is(err, ErrLaunchTimeout) {
+		t.Fatalf("got %v, want timeout", err)
+	}
+}
+
+func TestLaunchWatcherIgnoresStalePath(t *testing.T) {
+	w := fakeTmp(t)
+	write(t, w.CurrentPathFile, "game.sfc")
+	since := time.Now().Add(time.Second)
+
+	// the core starts again, but the path is left from an earlier launch of
+	// the same game
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		later := since.Add(time.Second)
+		write(t, w.CoreNameFile, "SNES")
+		if err := os.Chtimes(w.CoreNameFile, later, later); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := w.Wait("/media/fat/games/SNES/game.sfc", since); !errors.Is(err, ErrLaunchTimeout) {
+		t.Fatalf("got %v, want timeout", err)
+	}
+}
+
+func TestLaunchWatcherAnyCore(t *testing.T) {
+	w := fakeTmp(t)
+	since := time.Now()
+
+	// the core's CORENAME doesn't match its rbf, the game path confirms it
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		write(t, w.CoreNameFile, "TurboGrafx16")
+		write(t, w.FullPathFile, "games/TGFX16/game.pce")
+	}()
+
+	if err := w.Wait("/media/fat/games/TGFX16/game.pce", since); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLaunchWatcherSideLauncher(t *testing.T) {
+	w := fakeTmp(t)
+	since := time.Now()
+
+	// AmigaVision boots its own disk image, the .ags never shows up as the
+	// current path
+	amiga := games.System{Id: "AmigaVision"}
+	game := "/media/fat/games/Amiga/listings/games/Turrican.ags"
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		write(t, w.CoreNameFile, "Minimig")
+		write(t, w.CurrentPathFile, "AmigaVision.hdf")
+	}()
+
+	if err := w.Wait(confirmPath(amiga, game), since); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfirmPath(t *testing.T) {
+	tests := []struct {
+		system string
+		path   string
+		want   string
+	}{
+		{"SNES", "/media/fat/games/SNES/game.sfc", "/media/fat/games/SNES/game.sfc"},
+		{"Arcade", "/media/fat/_Arcade/game.mra", ""},
+		{"AmigaVision", "/media/fat/games/Amiga/game.ags", ""},
+		{"AmigaCD32", "/media/fat/games/AmigaCD32/game.chd", ""},
+		{"FDS", "/media/fat/games/NES/game.fds", "/media/fat/games/NES/game.fds"},
+	}
+	for _, tt := range tests {
+		if got := confirmPath(games.System{Id: tt.system}, tt.path); got != tt.want {
+			t.Errorf("confirmPath(%s, %q) = %q, want %q", tt.system, tt.path, got, tt.want)
+		}
+	}
+}
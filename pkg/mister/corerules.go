@@ -0,0 +1,307 @@
+package mister
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	s "strings"
+	"sync"
+	"time"
+
+	"gopkg.in/ini.v1"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/games"
+	"github.com/synrais/SAM-GO/pkg/romheader"
+)
+
+// Core rules pick the core, and optionally the MGL file parameters, used to
+// launch a game. They live in config.CoreRulesFile, one section per rule,
+// checked from top to bottom:
+//
+//	[NSF player]
+//	system = NES
+//	match  = *.nsf
+//	rbf    = _Console/NES_NSF
+//
+//	[Jotego]
+//	folder = /media/fat/_Arcade/jotego
+//	rbf    = jtcps1
+//
+//	[Slow loader]
+//	game  = /media/fat/games/PSX/Some Game.chd
+//	delay = 3
+//
+//	[PAL NES]
+//	system = NES
+//	region = PAL
+//	rbf    = _Console/NES_PAL
+//
+// A rule matches when all of its system, folder, match (filename glob), game
+// (full path or name without extension) and region (from the ROM header)
+// conditions match. Each setting
+// is taken from the first matching rule which has it, so a per-game rule
+// above a folder rule can change the delay and still use the folder's core.
+
+type CoreRule struct {
+	Name   string
+	System string
+	Folder string
+	Match  string
+	Game   string
+	Region string
+	Rbf    string
+	Type   string
+	Delay  *int
+	Index  *int
+}
+
+// CoreSelection is the merged result of all rules matching a game.
+type CoreSelection struct {
+	Rbf   string
+	Type  string
+	Delay *int
+	Index *int
+}
+
+type CoreRules []CoreRule
+
+// LoadCoreRules reads a rules file. A missing file is not an error, there
+// are just no rules.
+func LoadCoreRules(path string) (CoreRules, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	file, err := ini.LoadSources(ini.LoadOptions{InsensitiveKeys: true}, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load core rules: %w", err)
+	}
+
+	var rules CoreRules
+	for _, sec := range file.Sections() {
+		if sec.Name() == ini.DefaultSection {
+			continue
+		}
+
+		rule := CoreRule{
+			Name:   sec.Name(),
+			System: sec.Key("system").String(),
+			Folder: sec.Key("folder").String(),
+			Match:  sec.Key("match").String(),
+			Game:   sec.Key("game").String(),
+			Region: sec.Key("region").String(),
+			Rbf:    sec.Key("rbf").String(),
+			Type:   sec.Key("type").String(),
+		}
+		if rule.System == "" && rule.Folder == "" && rule.Match == "" && rule.Game == "" && rule.Region == "" {
+			return nil, fmt.Errorf("core rule [%s] has no conditions", sec.Name())
+		}
+		for key, dest := range map[string]**int{"delay": &rule.Delay, "index": &rule.Index} {
+			if !sec.HasKey(key) {
+				continue
+			}
+			v, err := sec.Key(key).Int()
+			if err != nil {
+				return nil, fmt.Errorf("core rule [%s]: invalid %s: %w", sec.Name(), key, err)
+			}
+			*dest = &v
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// romRegion returns a game's region from its ROM header, or "" if it has no
+// header which says.
+func romRegion(path string) string {
+	hdr, err := romheader.Read(path)
+	if err != nil {
+		return ""
+	}
+	return hdr.Region
+}
+
+// Matches reports whether the rule applies to a game.
+func (r CoreRule) Matches(system games.System, path string) bool {
+	return r.matches(system, path, func() string { return romRegion(path) })
+}
+
+func (r CoreRule) matches(system games.System, path string, region func() string) bool {
+	if r.System != "" && !s.EqualFold(r.System, system.Id) {
+		return false
+	}
+
+	if r.Folder != "" {
+		folder := s.ToLower(filepath.Clean(r.Folder))
+		dir := s.ToLower(filepath.Dir(path))
+		if dir != folder && !s.HasPrefix(dir, folder+"/") {
+			if ok, _ := filepath.Match(folder, dir); !ok {
+				return false
+			}
+		}
+	}
+
+	if r.Match != "" {
+		if ok, _ := filepath.Match(s.ToLower(r.Match), s.ToLower(filepath.Base(path))); !ok {
+			return false
+		}
+	}
+
+	if r.Game != "" {
+		name := s.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if !s.EqualFold(r.Game, path) && !s.EqualFold(r.Game, name) {
+			return false
+		}
+	}
+
+	// headers say e.g. "Japan/USA/Europe", so any part can match
+	if r.Region != "" {
+		found := false
+		for _, part := range s.Split(region(), "/") {
+			if s.EqualFold(s.TrimSpace(part), r.Region) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Resolve merges every rule matching a game.
+func (rules CoreRules) Resolve(system games.System, path string) CoreSelection {
+	// the header is only read once, and only if a rule needs it
+	region, read := "", false
+	regionFn := func() string {
+		if !read {
+			region, read = romRegion(path), true
+		}
+		return region
+	}
+
+	var sel CoreSelection
+	for _, r := range rules {
+		if !r.matches(system, path, regionFn) {
+			continue
+		}
+		if sel.Rbf == "" {
+			sel.Rbf = r.Rbf
+		}
+		if sel.Type == "" {
+			sel.Type = r.Type
+		}
+		if sel.Delay == nil {
+			sel.Delay = r.Delay
+		}
+		if sel.Index == nil {
+			sel.Index = r.Index
+		}
+	}
+	return sel
+}
+
+// Apply returns the MGL file parameters with the selection's overrides.
+func (sel CoreSelection) Apply(params games.MglParams) games.MglParams {
+	if sel.Type != "" {
+		params.Method = sel.Type
+	}
+	if sel.Delay != nil {
+		params.Delay = *sel.Delay
+	}
+	if sel.Index != nil {
+		params.Index = *sel.Index
+	}
+	return params
+}
+
+// coreRulesFile is the user's rules file.
+var coreRulesFile = config.CoreRulesFile
+
+// coreRulesCache keeps the parsed rules file between launches. It's read
+// again when its modification time or size changes, including when it's
+// created or deleted.
+var coreRulesCache struct {
+	mu     sync.Mutex
+	loaded bool
+	path   string
+	mtime  time.Time
+	size   int64
+	rules  CoreRules
+	err    error
+}
+
+// cachedCoreRules returns the rules from path, only parsing the file again
+// if it changed since the last call.
+func cachedCoreRules(path string) (CoreRules, error) {
+	var mtime time.Time
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		mtime, size = info.ModTime(), info.Size()
+	}
+
+	c := &coreRulesCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded && c.path == path && c.mtime.Equal(mtime) && c.size == size {
+		return c.rules, c.err
+	}
+
+	c.rules, c.err = LoadCoreRules(path)
+	c.loaded, c.path, c.mtime, c.size = true, path, mtime, size
+	return c.rules, c.err
+}
+
+// resolveCoreRules resolves the user's rules for a game. A broken rules file
+// is reported but doesn't stop the launch.
+func resolveCoreRules(system games.System, path string) CoreSelection {
+	rules, err := cachedCoreRules(coreRulesFile)
+	if err != nil {
+		logger.Error("core rules: %s", err)
+		return CoreSelection{}
+	}
+	return rules.Resolve(system, path)
+}
+
+var mraRbf = regexp.MustCompile(`(?is)<rbf>.*?</rbf>`)
+
+// overrideMraCore writes a copy of an MRA using a different core. The copy
+// sits in a temp folder with a cores link, the same way arcade launchers are
+// set up, so MiSTer can still find the core.
+func overrideMraCore(path string, rbf string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !mraRbf.Match(data) {
+		return "", fmt.Errorf("no rbf tag in %s", path)
+	}
+
+	var escaped bytes.Buffer
+	if err := xml.EscapeText(&escaped, []byte(rbf)); err != nil {
+		return "", err
+	}
+	data = mraRbf.ReplaceAllLiteral(data, []byte("<rbf>"+escaped.String()+"</rbf>"))
+
+	dir := filepath.Join(config.TempFolder, ".SAM_tmp", "mra")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := TrySetupArcadeCoresLink(dir); err != nil {
+		return "", err
+	}
+
+	tmpMra := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(tmpMra, data, 0644); err != nil {
+		return "", err
+	}
+	return tmpMra, nil
+}
@@ -0,0 +1,138 @@
+package mister
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/games"
+)
+
+func TestCoreRulesResolve(t *testing.T) {
+	rules, err := LoadCoreRules("testdata/core_rules.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("got %d rules, want 4", len(rules))
+	}
+
+	nes := games.System{Id: "NES"}
+	arcade := games.System{Id: "Arcade"}
+	params := games.MglParams{Delay: 1, Method: "f", Index: 0}
+
+	var tests = []struct {
+		system games.System
+		path   string
+		rbf    string
+		want   games.MglParams
+	}{
+		{nes, "/media/fat/games/NES/Super Mario Bros.nes", "", params},
+		{nes, "/media/fat/games/NES/Music/SMB.NSF", "_Console/NES_NSF", params},
+		{nes, "/media/fat/games/NES/Hacks/Sub/SMB Hack.nes", "_Console/NES_fork", games.MglParams{Delay: 1, Method: "f", Index: 1}},
+		{nes, "/media/fat/games/NES/Hacks/Zelda no Densetsu (Japan).nes", "_Console/NES_fork", games.MglParams{Delay: 3, Method: "f", Index: 1}},
+		{arcade, "/media/fat/_Arcade/jotego/Final Fight.mra", "jtcps1", params},
+		{arcade, "/media/fat/_Arcade/jotego2/Final Fight.mra", "", params},
+	}
+	for _, tt := range tests {
+		sel := rules.Resolve(tt.system, tt.path)
+		if sel.Rbf != tt.rbf {
+			t.Errorf("Resolve(%q).Rbf = %q, want %q", tt.path, sel.Rbf, tt.rbf)
+		}
+		if got := sel.Apply(params); got != tt.want {
+			t.Errorf("Resolve(%q).Apply() = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCoreRulesErrors(t *testing.T) {
+	if rules, err := LoadCoreRules("testdata/missing.ini"); err != nil || rules != nil {
+		t.Errorf("missing file: got %v, %v", rules, err)
+	}
+
+	for _, data := range []string{
+		"[No conditions]\nrbf = _Console/NES\n",
+		"[Bad delay]\nsystem = NES\ndelay = soon\n",
+	} {
+		path := filepath.Join(t.TempDir(), "rules.ini")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadCoreRules(path); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
+
+func TestCoreRulesRegion(t *testing.T) {
+	dir := t.TempDir()
+	rulesPath := filepath.Join(dir, "rules.ini")
+	rulesData := "[PAL NES]\nsystem = NES\nregion = pal\nrbf = _Console/NES_PAL\n"
+	if err := os.WriteFile(rulesPath, []byte(rulesData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadCoreRules(rulesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NES 2.0 headers, timing byte 1 is PAL
+	rom := func(name string, timing byte) string {
+		data := make([]byte, 16+0x4000)
+		copy(data, "NES\x1a")
+		data[7], data[12] = 0x08, timing
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	nes := games.System{Id: "NES"}
+	if sel := rules.Resolve(nes, rom("pal.nes", 1)); sel.Rbf != "_Console/NES_PAL" {
+		t.Errorf("PAL rom got rbf %q", sel.Rbf)
+	}
+	if sel := rules.Resolve(nes, rom("ntsc.nes", 0)); sel.Rbf != "" {
+		t.Errorf("NTSC rom got rbf %q", sel.Rbf)
+	}
+}
+
+func TestResolveCoreRulesCache(t *testing.T) {
+	old := coreRulesFile
+	coreRulesFile = filepath.Join(t.TempDir(), "core_rules.ini")
+	defer func() { coreRulesFile = old }()
+
+	nes := games.System{Id: "NES"}
+	game := "/media/fat/games/NES/Super Mario Bros.nes"
+	write := func(rbf string, mtime time.Time) {
+		t.Helper()
+		data := "[NES]\nsystem = NES\nrbf = " + rbf + "\n"
+		if err := os.WriteFile(coreRulesFile, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(coreRulesFile, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolve := func(want string) {
+		t.Helper()
+		if sel := resolveCoreRules(nes, game); sel.Rbf != want {
+			t.Errorf("resolveCoreRules().Rbf = %q, want %q", sel.Rbf, want)
+		}
+	}
+
+	resolve("")
+
+	then := time.Now().Add(-time.Hour)
+	write("_Console/NES_AAA", then)
+	resolve("_Console/NES_AAA")
+
+	write("_Console/NES_BBB", then.Add(time.Minute))
+	resolve("_Console/NES_BBB")
+
+	if err := os.Remove(coreRulesFile); err != nil {
+		t.Fatal(err)
+	}
+	resolve("")
+}
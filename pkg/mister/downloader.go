@@ -1,12 +1,16 @@
 package mister
 
 import (
-	"github.com/synrais/SAM-GO/pkg/config"
-	"gopkg.in/ini.v1"
+	"bytes"
 	"os"
+
+	"gopkg.in/ini.v1"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/gamesdb"
 )
 
-const downloaderIniFile = config.SdFolder + "/downloader.ini"
+var downloaderIniFile = config.SdFolder + "/downloader.ini"
 
 type DownloaderIni struct {
 	IniFile *ini.File
@@ -38,9 +42,14 @@ func LoadDownloaderIni() (*DownloaderIni, error) {
 }
 
 func (d *DownloaderIni) Save() error {
-	return d.IniFile.SaveTo(downloaderIniFile)
+	var buf bytes.Buffer
+	if _, err := d.IniFile.WriteTo(&buf); err != nil {
+		return err
+	}
+	return SafeWriteFile(downloaderIniFile, buf.Bytes())
 }
 
+// AddDb adds a database, or changes the url of one already added.
 func (d *DownloaderIni) AddDb(name, url string) error {
 	section, err := d.IniFile.NewSection(name)
 	if err != nil {
@@ -63,3 +72,23 @@ func (d *DownloaderIni) HasDb(name string) bool {
 	_, ok := d.Dbs[name]
 	return ok
 }
+
+// DownloadedSinceIndex reports whether the downloader has run successfully
+// since the games database was built, so new games may be missing from it.
+// It's false if the downloader has never run, and true if there's no games
+// database yet.
+func DownloadedSinceIndex() (bool, error) {
+	lastRun, err := GetLastUpdateTime()
+	if err != nil || lastRun.IsZero() {
+		return false, err
+	}
+
+	indexed, err := gamesdb.IndexTime()
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return lastRun.After(indexed), nil
+}
@@ -0,0 +1,64 @@
+package mister
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloaderIniDbs(t *testing.T) {
+	setBackupsFolder(t)
+	old := downloaderIniFile
+	downloaderIniFile = filepath.Join(t.TempDir(), "downloader.ini")
+	defer func() { downloaderIniFile = old }()
+
+	err := os.WriteFile(downloaderIniFile, []byte("[mister]\nupdate_linux = false\n\n[distribution_mister]\ndb_url = https://example.com/db.json.zip\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := LoadDownloaderIni()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.HasDb("distribution_mister") || d.HasDb("sam_go") {
+		t.Fatalf("loaded dbs = %v", d.Dbs)
+	}
+
+	id, url := "sam_go", "https://example.com/sam_go.json.zip"
+	for i := 0; i < 2; i++ {
+		if err := d.AddDb(id, url); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = LoadDownloaderIni()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Dbs[id] != url || !d.HasDb("distribution_mister") {
+		t.Errorf("saved dbs = %v", d.Dbs)
+	}
+	if v := d.IniFile.Section("mister").Key("update_linux").String(); v != "false" {
+		t.Errorf("update_linux = %q, other settings lost", v)
+	}
+
+	if err := d.RemoveDb(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(downloaderIniFile)
+	if strings.Contains(string(data), id) {
+		t.Errorf("removed db still in file:\n%s", data)
+	}
+
+	if backups, err := ListBackups(downloaderIniFile); err != nil || len(backups) != 2 {
+		t.Errorf("got %d backups, %v, want 2", len(backups), err)
+	}
+}
@@ -0,0 +1,75 @@
+package mister
+
+import (
+	"sync"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/service"
+)
+
+var logger = service.Component("mister")
+
+// LaunchEvent is a game or core started by SAM. Path is empty when only a
+// core was loaded.
+type LaunchEvent struct {
+	SystemId string
+	Path     string
+	Time     time.Time
+}
+
+type launchListener struct {
+	fn func(LaunchEvent)
+}
+
+var (
+	launchMu        sync.RWMutex
+	launchListeners []*launchListener
+	lastLaunch      *LaunchEvent
+)
+
+// OnLaunch adds a function to call after every successful launch. Listeners
+// are called on the launching goroutine, so shouldn't block. The returned
+// function removes the listener again.
+func OnLaunch(fn func(LaunchEvent)) func() {
+	l := &launchListener{fn: fn}
+	launchMu.Lock()
+	defer launchMu.Unlock()
+	launchListeners = append(launchListeners, l)
+
+	return func() {
+		launchMu.Lock()
+		defer launchMu.Unlock()
+		// a new slice, notifyLaunch may still be going through the old one
+		var kept []*launchListener
+		for _, other := range launchListeners {
+			if other != l {
+				kept = append(kept, other)
+			}
+		}
+		launchListeners = kept
+	}
+}
+
+// NowPlaying returns the last thing launched by this process, or false if
+// nothing has been yet.
+func NowPlaying() (LaunchEvent, bool) {
+	launchMu.RLock()
+	defer launchMu.RUnlock()
+	if lastLaunch == nil {
+		return LaunchEvent{}, false
+	}
+	return *lastLaunch, true
+}
+
+func notifyLaunch(systemId string, path string) {
+	ev := LaunchEvent{SystemId: systemId, Path: path, Time: time.Now()}
+
+	launchMu.Lock()
+	lastLaunch = &ev
+	listeners := launchListeners
+	launchMu.Unlock()
+
+	for _, l := range listeners {
+		l.fn(ev)
+	}
+}
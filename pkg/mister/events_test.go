@@ -0,0 +1,21 @@
+package mister
+
+import "testing"
+
+func TestOnLaunchRemove(t *testing.T) {
+	var first, second int
+	removeFirst := OnLaunch(func(LaunchEvent) { first++ })
+	removeSecond := OnLaunch(func(LaunchEvent) { second++ })
+	defer removeSecond()
+
+	notifyLaunch("SNES", "/media/fat/games/SNES/game.sfc")
+	removeFirst()
+	notifyLaunch("SNES", "/media/fat/games/SNES/game.sfc")
+
+	if first != 1 || second != 2 {
+		t.Errorf("listeners called %d and %d times, want 1 and 2", first, second)
+	}
+	if ev, ok := NowPlaying(); !ok || ev.SystemId != "SNES" {
+		t.Errorf("NowPlaying() = %+v, %v", ev, ok)
+	}
+}
@@ -1,9 +1,11 @@
 package mister
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/synrais/SAM-GO/pkg/utils"
@@ -12,8 +14,6 @@ import (
 	"github.com/synrais/SAM-GO/pkg/config"
 )
 
-// TODO: support getting/setting sections besides main
-
 const ShadowDelimiter = ","
 
 type MisterIni struct {
@@ -191,27 +191,18 @@ func (mi *MisterIni) Load() error {
 	return nil
 }
 
+// Save writes the file atomically, keeping a backup of the old one.
 func (mi *MisterIni) Save() error {
 	if mi.File == nil {
 		return fmt.Errorf("ini file is not loaded")
 	}
 
-	backupPath := fmt.Sprintf("%s.backup", mi.Path)
-
-	backupData, err := os.ReadFile(mi.Path)
-	if os.IsNotExist(err) {
-		// skip backup if file doesn't exist
-		return mi.File.SaveTo(mi.Path)
-	} else if err != nil {
-		return err
-	}
-
-	err = os.WriteFile(backupPath, backupData, 0644)
+	data, err := mi.Preview()
 	if err != nil {
 		return err
 	}
 
-	return mi.File.SaveTo(mi.Path)
+	return SafeWriteFile(mi.Path, []byte(data))
 }
 
 func (mi *MisterIni) IsValidKey(key string) bool {
@@ -223,15 +214,16 @@ func (mi *MisterIni) IsShadowedKey(key string) bool {
 }
 
 func (mi *MisterIni) GetKey(key string) (string, error) {
+	return mi.GetSectionKey(MainIniSection, key)
+}
+
+// GetSectionKey gets a key from one section, or an empty string if the
+// section or key isn't set. Shadowed values are joined with a comma.
+func (mi *MisterIni) GetSectionKey(name string, key string) (string, error) {
 	if mi.File == nil {
 		return "", fmt.Errorf("ini file is not loaded")
 	}
 
-	section := mi.File.Section(MainIniSection)
-	if section == nil {
-		return "", nil
-	}
-
 	if strings.HasPrefix(key, "__") {
 		return "", nil
 	}
@@ -240,7 +232,8 @@ func (mi *MisterIni) GetKey(key string) (string, error) {
 		return "", fmt.Errorf("invalid ini key: %s", key)
 	}
 
-	if !section.HasKey(key) {
+	section := mi.findSection(name)
+	if section == nil || !section.HasKey(key) {
 		return "", nil
 	}
 
@@ -255,15 +248,16 @@ func (mi *MisterIni) GetKey(key string) (string, error) {
 // SetKey a key to an absolute value, or delete it if value is empty. Supports
 // shadowed keys delimited with a comma.
 func (mi *MisterIni) SetKey(key string, value string) error {
+	return mi.SetSectionKey(MainIniSection, key, value)
+}
+
+// SetSectionKey sets a key in one section like SetKey, creating the section
+// if it doesn't exist. The value is checked with ValidateIniValue.
+func (mi *MisterIni) SetSectionKey(name string, key string, value string) error {
 	if mi.File == nil {
 		return fmt.Errorf("ini file is not loaded")
 	}
 
-	section := mi.File.Section(MainIniSection)
-	if section == nil {
-		return fmt.Errorf("ini file does not have a [MiSTer] section")
-	}
-
 	if strings.HasPrefix(key, "__") {
 		return nil
 	}
@@ -272,6 +266,30 @@ func (mi *MisterIni) SetKey(key string, value string) error {
 		return fmt.Errorf("invalid ini key: %s", key)
 	}
 
+	var vals []string
+	if mi.IsShadowedKey(key) {
+		vals = strings.Split(value, ShadowDelimiter)
+	} else {
+		vals = []string{value}
+	}
+	for _, val := range vals {
+		if err := ValidateIniValue(key, val); err != nil {
+			return err
+		}
+	}
+
+	section := mi.findSection(name)
+	if section == nil {
+		if value == "" {
+			return nil
+		}
+		var err error
+		section, err = mi.File.NewSection(name)
+		if err != nil {
+			return err
+		}
+	}
+
 	if section.HasKey(key) && value == "" {
 		section.DeleteKey(key)
 		return nil
@@ -284,12 +302,6 @@ func (mi *MisterIni) SetKey(key string, value string) error {
 			section.DeleteKey(key)
 		}
 
-		vals := strings.Split(value, ShadowDelimiter)
-
-		if len(vals) == 0 {
-			return nil
-		}
-
 		iniKey, err := section.NewKey(key, vals[0])
 		if err != nil {
 			return err
@@ -315,6 +327,199 @@ func (mi *MisterIni) SetKey(key string, value string) error {
 	return nil
 }
 
+// findSection finds a section by name, ignoring case like the MiSTer does.
+func (mi *MisterIni) findSection(name string) *ini.Section {
+	for _, section := range mi.File.Sections() {
+		if strings.EqualFold(section.Name(), name) {
+			return section
+		}
+	}
+	return nil
+}
+
+// Sections lists the sections in the file, in order, starting with [MiSTer].
+func (mi *MisterIni) Sections() []string {
+	if mi.File == nil {
+		return nil
+	}
+
+	names := []string{MainIniSection}
+	for _, section := range mi.File.Sections() {
+		name := section.Name()
+		if name == ini.DefaultSection || strings.EqualFold(name, MainIniSection) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// RemoveSection removes a core section and all its keys. The [MiSTer]
+// section can't be removed.
+func (mi *MisterIni) RemoveSection(name string) error {
+	if mi.File == nil {
+		return fmt.Errorf("ini file is not loaded")
+	}
+	if strings.EqualFold(name, MainIniSection) {
+		return fmt.Errorf("can't remove the [%s] section", MainIniSection)
+	}
+	if section := mi.findSection(name); section != nil {
+		mi.File.DeleteSection(section.Name())
+	}
+	return nil
+}
+
+// videoSectionPrefix starts the name of a section which applies to a video
+// mode instead of a core, e.g. [video=1920x1080@60].
+const videoSectionPrefix = "video="
+
+// SectionMatches reports whether settings in a section apply to a core
+// running in a video mode. Core sections match the core's name ignoring
+// case, and can use * wildcards, e.g. [Arcade*]. Video sections match the
+// start of the mode, so [video=1920x1080] applies to 1920x1080@60. An empty
+// mode matches no video sections.
+func SectionMatches(name string, core string, mode string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == strings.ToLower(MainIniSection) {
+		return true
+	}
+
+	if strings.HasPrefix(name, videoSectionPrefix) {
+		want := strings.TrimPrefix(name, videoSectionPrefix)
+		return mode != "" && strings.HasPrefix(strings.ToLower(mode), want)
+	}
+
+	matched, err := filepath.Match(name, strings.ToLower(core))
+	return err == nil && matched
+}
+
+// ResolveKey finds the value of a key for a core running in a video mode.
+// Sections are applied in file order on top of [MiSTer], so the last
+// matching section to set the key wins.
+func (mi *MisterIni) ResolveKey(core string, mode string, key string) (string, error) {
+	value, err := mi.GetKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range mi.Sections()[1:] {
+		if !SectionMatches(name, core, mode) {
+			continue
+		}
+		if section := mi.findSection(name); section != nil && section.HasKey(key) {
+			value, err = mi.GetSectionKey(name, key)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return value, nil
+}
+
+// IniChange is one key which differs between the saved file and the loaded
+// one. An empty Old means the key was added and an empty New means it was
+// removed.
+type IniChange struct {
+	Section string
+	Key     string
+	Old     string
+	New     string
+}
+
+func (c IniChange) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("[%s] + %s=%s", c.Section, c.Key, c.New)
+	case c.New == "":
+		return fmt.Sprintf("[%s] - %s=%s", c.Section, c.Key, c.Old)
+	default:
+		return fmt.Sprintf("[%s] %s: %s -> %s", c.Section, c.Key, c.Old, c.New)
+	}
+}
+
+// sectionValues reads every key in a file, by lowercase section name.
+func sectionValues(file *ini.File) map[string]map[string]string {
+	values := make(map[string]map[string]string)
+	for _, section := range file.Sections() {
+		name := strings.ToLower(section.Name())
+		if values[name] == nil {
+			values[name] = make(map[string]string)
+		}
+		for _, key := range section.Keys() {
+			values[name][key.Name()] = strings.Join(key.ValueWithShadows(), ShadowDelimiter)
+		}
+	}
+	return values
+}
+
+// Diff lists what Save would change in the file on disk, ordered by section
+// and then key name.
+func (mi *MisterIni) Diff() ([]IniChange, error) {
+	if mi.File == nil {
+		return nil, fmt.Errorf("ini file is not loaded")
+	}
+
+	saved := ini.Empty()
+	if _, err := os.Stat(mi.Path); err == nil {
+		saved, err = ini.ShadowLoad(mi.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// keep the loaded file's spelling of section names
+	names := make(map[string]string)
+	for _, file := range []*ini.File{saved, mi.File} {
+		for _, section := range file.Sections() {
+			names[strings.ToLower(section.Name())] = section.Name()
+		}
+	}
+
+	before, after := sectionValues(saved), sectionValues(mi.File)
+	var changes []IniChange
+	for lower, name := range names {
+		keys := make(map[string]bool)
+		for key := range before[lower] {
+			keys[key] = true
+		}
+		for key := range after[lower] {
+			keys[key] = true
+		}
+		for key := range keys {
+			old, cur := before[lower][key], after[lower][key]
+			if old != cur {
+				changes = append(changes, IniChange{
+					Section: name,
+					Key:     key,
+					Old:     old,
+					New:     cur,
+				})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Section != changes[j].Section {
+			return changes[i].Section < changes[j].Section
+		}
+		return changes[i].Key < changes[j].Key
+	})
+	return changes, nil
+}
+
+// Preview returns the file as Save would write it.
+func (mi *MisterIni) Preview() (string, error) {
+	if mi.File == nil {
+		return "", fmt.Errorf("ini file is not loaded")
+	}
+	var buf bytes.Buffer
+	if _, err := mi.File.WriteTo(&buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 // AddKey sets a key to a value whether it exists or not and appends to any
 // shadowed values.
 func (mi *MisterIni) AddKey(key string, value string) error {
@@ -0,0 +1,202 @@
+package mister
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testIni = `[MiSTer]
+video_mode=8
+vscale_mode=0
+
+[SNES]
+vscale_mode=1
+
+[Arcade*]
+video_mode=0
+
+[video=1920x1080]
+vsync_adjust=2
+`
+
+func loadTestIni(t *testing.T) *MisterIni {
+	t.Helper()
+	setBackupsFolder(t)
+	path := filepath.Join(t.TempDir(), DefaultIniFilename)
+	if err := os.WriteFile(path, []byte(testIni), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mi := &MisterIni{Filename: DefaultIniFilename, Path: path}
+	if err := mi.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return mi
+}
+
+func TestIniSections(t *testing.T) {
+	mi := loadTestIni(t)
+
+	want := []string{"MiSTer", "SNES", "Arcade*", "video=1920x1080"}
+	if got := mi.Sections(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Sections() = %v, want %v", got, want)
+	}
+
+	if v, err := mi.GetSectionKey("snes", KeyVscaleMode); err != nil || v != "1" {
+		t.Errorf("GetSectionKey(snes) = %q, %v", v, err)
+	}
+	if v, err := mi.GetSectionKey("NES", KeyVscaleMode); err != nil || v != "" {
+		t.Errorf("GetSectionKey(NES) = %q, %v", v, err)
+	}
+
+	if err := mi.SetSectionKey("NES", KeyVscaleMode, "3"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := mi.GetSectionKey("NES", KeyVscaleMode); v != "3" {
+		t.Errorf("new section value = %q, want 3", v)
+	}
+
+	if err := mi.RemoveSection("snes"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mi.RemoveSection(MainIniSection); err == nil {
+		t.Error("removed main section")
+	}
+	if got := len(mi.Sections()); got != 4 {
+		t.Errorf("got %d sections, want 4", got)
+	}
+}
+
+func TestIniResolveKey(t *testing.T) {
+	mi := loadTestIni(t)
+
+	var tests = []struct {
+		core string
+		mode string
+		key  string
+		want string
+	}{
+		{"NES", "", KeyVscaleMode, "0"},
+		{"snes", "", KeyVscaleMode, "1"},
+		{"ArcadeCPS1", "", KeyVideoMode, "0"},
+		{"SNES", "", KeyVideoMode, "8"},
+		{"SNES", "1920x1080@60", KeyVsyncAdjust, "2"},
+		{"SNES", "1280x720@60", KeyVsyncAdjust, ""},
+	}
+	for _, tt := range tests {
+		got, err := mi.ResolveKey(tt.core, tt.mode, tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("ResolveKey(%q, %q, %q) = %q, want %q", tt.core, tt.mode, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestValidateIniValue(t *testing.T) {
+	root := t.TempDir()
+	old := IniPathRoot
+	IniPathRoot = root
+	defer func() { IniPathRoot = old }()
+
+	if err := os.MkdirAll(filepath.Join(root, "filters", "Scanlines"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "filters", "Scanlines", "light.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{KeyDirectVideo, "1", true},
+		{KeyDirectVideo, "yes", false},
+		{KeyVgaMode, "YPbPr", true},
+		{KeyVgaMode, "hdmi", false},
+		{KeyVscaleMode, "5", true},
+		{KeyVscaleMode, "6", false},
+		{KeyVscaleMode, "x", false},
+		{KeyVideoMode, "15", true},
+		{KeyVideoMode, "16", false},
+		{KeyVideoMode, "1280,110,40,220,720,5,5,20,74.25", true},
+		{KeyVideoMode, "1280x720", false},
+		{KeyVfilterDefault, "Scanlines/light.txt", true},
+		{KeyVfilterDefault, "Scanlines/dark.txt", false},
+		{KeyVfilterDefault, "../filters/Scanlines/light.txt", true},
+		{KeyVfilterDefault, "../../etc/passwd", false},
+		{KeyMouseThrottle, "", true},
+		{KeyBootcore, "lastcore", true},
+		{KeyBootcore, "a\nvideo_mode=0", false},
+		{"not_a_key", "1", false},
+	}
+	for _, tt := range tests {
+		err := ValidateIniValue(tt.key, tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateIniValue(%q, %q) = %v, want ok %v", tt.key, tt.value, err, tt.ok)
+		}
+	}
+
+	if got := IniValueChoices(KeyVfilterDefault); len(got) != 1 || got[0] != "Scanlines/light.txt" {
+		t.Errorf("path choices = %v", got)
+	}
+	if got := IniValueChoices(KeyOsdTimeout); got[0] != "0" || got[len(got)-1] != "3600" {
+		t.Errorf("int choices = %v", got)
+	}
+}
+
+func TestIniDiff(t *testing.T) {
+	mi := loadTestIni(t)
+
+	if changes, err := mi.Diff(); err != nil || len(changes) != 0 {
+		t.Fatalf("unchanged Diff() = %v, %v", changes, err)
+	}
+
+	if err := mi.SetSectionKey("SNES", KeyVscaleMode, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mi.SetKey(KeyVideoMode, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := mi.SetSectionKey("GBA", KeyVideoMode, "0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mi.SetKey(KeyVscaleMode, "9"); err == nil {
+		t.Error("set invalid value")
+	}
+
+	changes, err := mi.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"[GBA] + video_mode=0",
+		"[MiSTer] - video_mode=8",
+		"[SNES] vscale_mode: 1 -> 2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Diff() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	preview, err := mi.Preview()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(preview, "[GBA]\nvideo_mode=0") {
+		t.Errorf("Preview() missing new section:\n%s", preview)
+	}
+
+	if err := mi.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := mi.Diff(); err != nil || len(changes) != 0 {
+		t.Errorf("Diff() after Save = %v, %v", changes, err)
+	}
+}
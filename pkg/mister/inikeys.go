@@ -0,0 +1,255 @@
+package mister
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	s "strings"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/utils"
+)
+
+// Kinds of MiSTer.ini values, for validating them.
+const (
+	IniString    = iota
+	IniBool      // 0 or 1
+	IniEnum      // one of Values
+	IniInt       // Min to Max
+	IniVideoMode // a mode number, or custom timings as a list of numbers
+	IniPath      // a file in Dir, relative to it
+)
+
+// IniKeySpec describes the values a MiSTer.ini key accepts.
+type IniKeySpec struct {
+	Kind   int
+	Values []string
+	Min    int
+	Max    int
+	Dir    string // relative to IniPathRoot
+}
+
+// IniPathRoot is the folder IniPath values are found in.
+var IniPathRoot = config.SdFolder
+
+// maxVideoMode is the highest of MiSTer's built in video modes.
+const maxVideoMode = 15
+
+var boolSpec = IniKeySpec{Kind: IniBool}
+
+func intSpec(min, max int) IniKeySpec {
+	return IniKeySpec{Kind: IniInt, Min: min, Max: max}
+}
+
+func enumSpec(values ...string) IniKeySpec {
+	return IniKeySpec{Kind: IniEnum, Values: values}
+}
+
+// IniKeySpecs are the known values of MiSTer.ini keys. Valid keys without a
+// spec take any value on one line.
+var IniKeySpecs = map[string]IniKeySpec{
+	KeyYpbpr:                   boolSpec,
+	KeyCompositeSync:           boolSpec,
+	KeyForcedScandoubler:       boolSpec,
+	KeyVgaScaler:               boolSpec,
+	KeyVgaSog:                  boolSpec,
+	KeyKeyMenuAsRgui:           boolSpec,
+	KeyHdmiAudio96k:            boolSpec,
+	KeyDviMode:                 boolSpec,
+	KeyKbdNomouse:              boolSpec,
+	KeyBootscreen:              boolSpec,
+	KeyRbfHideDatecode:         boolSpec,
+	KeyMenuPal:                 boolSpec,
+	KeyFbTerminal:              boolSpec,
+	KeyDirectVideo:             boolSpec,
+	KeyRecents:                 boolSpec,
+	KeySniperMode:              boolSpec,
+	KeyBrowseExpand:            boolSpec,
+	KeyLogo:                    boolSpec,
+	KeyLogFileEntry:            boolSpec,
+	KeyBtResetBeforePair:       boolSpec,
+	KeyDisableAutofire:         boolSpec,
+	KeyHdmiGameMode:            boolSpec,
+	KeyRumble:                  boolSpec,
+	KeyVgaMode:                 enumSpec("rgb", "ypbpr", "svideo", "cvbs"),
+	KeyFbSize:                  enumSpec("0", "1", "2", "4"),
+	KeyVsyncAdjust:             intSpec(0, 2),
+	KeyHdmiLimited:             intSpec(0, 2),
+	KeyOsdRotate:               intSpec(0, 2),
+	KeyNtscMode:                intSpec(0, 2),
+	KeyHdr:                     intSpec(0, 2),
+	KeyResetCombo:              intSpec(0, 3),
+	KeyVrrMode:                 intSpec(0, 3),
+	KeyVscaleMode:              intSpec(0, 5),
+	KeyVideoInfo:               intSpec(0, 10),
+	KeyControllerInfo:          intSpec(0, 10),
+	KeyVscaleBorder:            intSpec(0, 399),
+	KeyMouseThrottle:           intSpec(1, 100),
+	KeyBootcoreTimeout:         intSpec(0, 60),
+	KeyOsdTimeout:              intSpec(0, 3600),
+	KeyVideoOff:                intSpec(0, 3600),
+	KeyBtAutoDisconnect:        intSpec(0, 1440),
+	KeyWheelForce:              intSpec(0, 100),
+	KeyWheelRange:              intSpec(0, 1440),
+	KeyVrrMinFramerate:         intSpec(0, 240),
+	KeyVrrMaxFramerate:         intSpec(0, 240),
+	KeyVrrVesaFramerate:        intSpec(0, 240),
+	KeyVideoBrightness:         intSpec(0, 100),
+	KeyVideoContrast:           intSpec(0, 100),
+	KeyVideoSaturation:         intSpec(0, 100),
+	KeyVideoHue:                intSpec(0, 360),
+	KeyHdrMaxNits:              intSpec(100, 10000),
+	KeyHdrAvgNits:              intSpec(100, 10000),
+	KeyVideoMode:               {Kind: IniVideoMode},
+	KeyVideoModeNtsc:           {Kind: IniVideoMode},
+	KeyVideoModePal:            {Kind: IniVideoMode},
+	KeyFont:                    {Kind: IniPath, Dir: "font"},
+	KeyAfilterDefault:          {Kind: IniPath, Dir: "filters_audio"},
+	KeyVfilterDefault:          {Kind: IniPath, Dir: "filters"},
+	KeyVfilterVerticalDefault:  {Kind: IniPath, Dir: "filters"},
+	KeyVfilterScanlinesDefault: {Kind: IniPath, Dir: "filters"},
+	KeyShmaskDefault:           {Kind: IniPath, Dir: "shadow_masks"},
+	KeyPresetDefault:           {Kind: IniPath, Dir: "presets"},
+}
+
+// VideoIniKeys are the keys the video settings editor offers.
+var VideoIniKeys = []string{
+	KeyVideoMode,
+	KeyVideoModeNtsc,
+	KeyVideoModePal,
+	KeyVsyncAdjust,
+	KeyVscaleMode,
+	KeyVscaleBorder,
+	KeyDirectVideo,
+	KeyHdmiLimited,
+	KeyHdmiGameMode,
+	KeyDviMode,
+	KeyVrrMode,
+	KeyHdr,
+	KeyVideoBrightness,
+	KeyVideoContrast,
+	KeyVideoSaturation,
+	KeyVideoHue,
+	KeyVideoInfo,
+	KeyVgaMode,
+	KeyNtscMode,
+	KeyCompositeSync,
+	KeyForcedScandoubler,
+	KeyVfilterDefault,
+	KeyVfilterScanlinesDefault,
+	KeyShmaskDefault,
+	KeyPresetDefault,
+}
+
+func parseInt(value string) (int, bool) {
+	n, err := strconv.Atoi(s.TrimSpace(value))
+	return n, err == nil
+}
+
+// ValidateIniValue checks a value can be used for key. An empty value is
+// always valid, it removes the key.
+func ValidateIniValue(key string, value string) error {
+	if !utils.Contains(ValidIniKeys, key) {
+		return fmt.Errorf("invalid ini key: %s", key)
+	}
+	if value == "" {
+		return nil
+	}
+	if s.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("%s: value can't span lines", key)
+	}
+
+	spec, ok := IniKeySpecs[key]
+	if !ok {
+		return nil
+	}
+
+	switch spec.Kind {
+	case IniBool:
+		if value != "0" && value != "1" {
+			return fmt.Errorf("%s must be 0 or 1: %s", key, value)
+		}
+	case IniEnum:
+		for _, v := range spec.Values {
+			if s.EqualFold(v, value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %s: %s", key, s.Join(spec.Values, ", "), value)
+	case IniInt:
+		n, ok := parseInt(value)
+		if !ok || n < spec.Min || n > spec.Max {
+			return fmt.Errorf("%s must be a number from %d to %d: %s", key, spec.Min, spec.Max, value)
+		}
+	case IniVideoMode:
+		if n, ok := parseInt(value); ok {
+			if n < 0 || n > maxVideoMode {
+				return fmt.Errorf("%s must be a mode from 0 to %d: %s", key, maxVideoMode, value)
+			}
+			return nil
+		}
+		// custom timings, e.g. 1280,110,40,220,720,5,5,20,74.25
+		for _, part := range s.Split(value, ",") {
+			if _, err := strconv.ParseFloat(s.TrimSpace(part), 64); err != nil {
+				return fmt.Errorf("%s must be a mode number or timings: %s", key, value)
+			}
+		}
+	case IniPath:
+		path := filepath.Join(IniPathRoot, spec.Dir, value)
+		if rel, err := filepath.Rel(filepath.Join(IniPathRoot, spec.Dir), path); err != nil || s.HasPrefix(rel, "..") {
+			return fmt.Errorf("%s must be in %s: %s", key, spec.Dir, value)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s file not found: %s", key, value)
+		}
+	}
+	return nil
+}
+
+// IniValueChoices lists the values a key can be set to, for picking one with
+// a controller. Large number ranges are stepped through and paths are the
+// files found for them. Keys without a spec have no choices.
+func IniValueChoices(key string) []string {
+	spec, ok := IniKeySpecs[key]
+	if !ok {
+		return nil
+	}
+
+	var choices []string
+	switch spec.Kind {
+	case IniBool:
+		choices = []string{"0", "1"}
+	case IniEnum:
+		choices = append(choices, spec.Values...)
+	case IniInt:
+		step := 1
+		if spec.Max-spec.Min > 50 {
+			step = (spec.Max - spec.Min) / 50
+		}
+		for n := spec.Min; n <= spec.Max; n += step {
+			choices = append(choices, strconv.Itoa(n))
+		}
+		if choices[len(choices)-1] != strconv.Itoa(spec.Max) {
+			choices = append(choices, strconv.Itoa(spec.Max))
+		}
+	case IniVideoMode:
+		for n := 0; n <= maxVideoMode; n++ {
+			choices = append(choices, strconv.Itoa(n))
+		}
+	case IniPath:
+		root := filepath.Join(IniPathRoot, spec.Dir)
+		_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if rel, err := filepath.Rel(root, path); err == nil {
+				choices = append(choices, rel)
+			}
+			return nil
+		})
+		sort.Strings(choices)
+	}
+	return choices
+}
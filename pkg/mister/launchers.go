@@ -2,21 +2,20 @@ package mister
 
 import (
 	"fmt"
-	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
 	s "strings"
-	"time"
 
 	"github.com/synrais/SAM-GO/pkg/config"
 	"github.com/synrais/SAM-GO/pkg/games"
 	"github.com/synrais/SAM-GO/pkg/utils"
-	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
 )
 
-func GenerateMgl(cfg *config.UserConfig, system *games.System, path string, override string) (string, error) {
+// BuildMgl returns the MGL used to launch path on a system. The core comes
+// from the system, set_core and the core rules, in increasing priority. An
+// override from a system hook replaces the default file entry. An empty path
+// launches the core alone.
+func BuildMgl(cfg *config.UserConfig, system *games.System, path string, override *games.MglOverride) (MGL, error) {
 	// override the system rbf with the user specified one
 	for _, setCore := range cfg.Systems.SetCore {
 		parts := s.SplitN(setCore, ":", 2)
@@ -30,37 +29,58 @@ func GenerateMgl(cfg *config.UserConfig, system *games.System, path string, over
 		}
 	}
 
-	mgl := fmt.Sprintf("<mistergamedescription>\n\t<rbf>%s</rbf>\n", system.Rbf)
-
-	if system.SetName != "" {
-		sameDir := ""
-		if system.SetNameSameDir {
-			sameDir = " same_dir=\"1\""
-		}
-
-		mgl += fmt.Sprintf("\t<setname%s>%s</setname>\n", sameDir, system.SetName)
+	// core rules are more specific than set_core, so they win
+	sel := resolveCoreRules(*system, path)
+	if sel.Rbf != "" {
+		system.Rbf = sel.Rbf
 	}
 
+	mgl := MGL{Rbf: system.Rbf}
+	mgl.SetSetName(system.SetName, system.SetNameSameDir)
+
 	if path == "" {
-		mgl += "</mistergamedescription>"
 		return mgl, nil
-	} else if override != "" {
-		mgl += override
-		mgl += "</mistergamedescription>"
+	} else if override != nil {
+		if override.SetName != "" {
+			mgl.SetSetName(override.SetName, false)
+		}
+		for _, f := range override.Files {
+			mgl.Files = append(mgl.Files, NewMGLFile(f.MglParams, f.Path))
+		}
+		if override.ResetDelay > 0 {
+			mgl.Reset = &MGLReset{Delay: override.ResetDelay}
+		}
 		return mgl, nil
 	}
 
 	mglDef, err := games.PathToMglDef(*system, path)
 	if err != nil {
-		return "", err
+		return mgl, err
 	}
 
-	mgl += fmt.Sprintf("<file delay=\"%d\" type=\"%s\" index=\"%d\" path=\"../../../../..%s\"/>\n", mglDef.Delay, mglDef.Method, mglDef.Index, path)
-	mgl += "</mistergamedescription>"
+	mgl.Files = []MGLFile{NewMGLFile(sel.Apply(*mglDef), path)}
 	return mgl, nil
 }
 
+// GenerateMgl is BuildMgl rendered as XML.
+func GenerateMgl(cfg *config.UserConfig, system *games.System, path string, override *games.MglOverride) (string, error) {
+	mgl, err := BuildMgl(cfg, system, path, override)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := mgl.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 func writeTempFile(content string) (string, error) {
+	if skipForDryRun("write %s:\n%s", config.LastLaunchFile, content) {
+		return config.LastLaunchFile, nil
+	}
+
 	tmpFile, err := os.Create(config.LastLaunchFile)
 	if err != nil {
 		return "", err
@@ -75,30 +95,36 @@ func writeTempFile(content string) (string, error) {
 }
 
 func launchFile(path string) error {
-	_, err := os.Stat(config.CmdInterface)
-	if err != nil {
-		return fmt.Errorf("command interface not accessible: %s", err)
-	}
-
 	if !(s.HasSuffix(s.ToLower(path), ".mgl") || s.HasSuffix(s.ToLower(path), ".mra") || s.HasSuffix(s.ToLower(path), ".rbf")) {
 		return fmt.Errorf("not a valid launch file: %s", path)
 	}
 
-	cmd, err := os.OpenFile(config.CmdInterface, os.O_RDWR, 0)
+	return GetCommander().LoadCore(path)
+}
+
+// launchMra launches an arcade file, switching to another core first if a
+// core rule asks for one.
+func launchMra(system games.System, path string) error {
+	sel := resolveCoreRules(system, path)
+	if sel.Rbf == "" || skipForDryRun("copy of %s using core %s", path, sel.Rbf) {
+		return launchFile(path)
+	}
+
+	tmpMra, err := overrideMraCore(path, sel.Rbf)
 	if err != nil {
 		return err
 	}
-	defer cmd.Close()
-
-	cmd.WriteString(fmt.Sprintf("load_core %s\n", path))
-
-	return nil
+	return launchFile(tmpMra)
 }
 
 func launchTempMgl(cfg *config.UserConfig, system *games.System, path string) error {
-	override, err := games.RunSystemHook(cfg, *system, path)
-	if err != nil {
-		return err
+	var override *games.MglOverride
+	if !games.HasSystemHook(system.Id) || !skipForDryRun("%s setup for %s", system.Id, path) {
+		var err error
+		override, err = games.RunSystemHook(cfg, *system, path)
+		if err != nil {
+			return err
+		}
 	}
 
 	mgl, err := GenerateMgl(cfg, system, path, override)
@@ -117,12 +143,9 @@ func launchTempMgl(cfg *config.UserConfig, system *games.System, path string) er
 // LaunchShortCore attempts to launch a core with a short path, as per what's
 // allowed in an MGL file.
 func LaunchShortCore(path string) error {
-	mgl := fmt.Sprintf(
-		"<mistergamedescription>\n\t<rbf>%s</rbf>\n</mistergamedescription>\n",
-		path,
-	)
+	mgl := MGL{Rbf: path}
 
-	tmpFile, err := writeTempFile(mgl)
+	tmpFile, err := writeTempFile(mgl.String())
 	if err != nil {
 		return err
 	}
@@ -133,13 +156,16 @@ func LaunchShortCore(path string) error {
 func LaunchGame(cfg *config.UserConfig, system games.System, path string) error {
 	// check if sidelaunchers wants to handle this system specially
 	if handled, err := SideLaunchers(cfg, system, path); handled {
+		if err == nil {
+			notifyLaunch(system.Id, path)
+		}
 		return err
 	}
 
 	switch s.ToLower(filepath.Ext(path)) {
 	case ".mra":
 		// Arcade launchers are already valid files
-		err := launchFile(path)
+		err := launchMra(system, path)
 		if err != nil {
 			return err
 		}
@@ -153,8 +179,9 @@ func LaunchGame(cfg *config.UserConfig, system games.System, path string) error
 			SetActiveGame(path)
 		}
 	default:
-		// Generic game file → build temporary MGL and launch
-		err := launchTempMgl(cfg, &system, path)
+		// Generic game file → build temporary MGL and launch, with the
+		// system's boot macro if one is configured
+		err := launchWithMacro(cfg, system, path)
 		if err != nil {
 			return err
 		}
@@ -163,6 +190,7 @@ func LaunchGame(cfg *config.UserConfig, system games.System, path string) error
 		}
 	}
 
+	notifyLaunch(system.Id, path)
 	return nil
 }
 
@@ -290,10 +318,6 @@ func CreateLauncher(cfg *config.UserConfig, system *games.System, gameFile strin
 
 // LaunchCore Launch a core given a possibly partial path, as per MGL files.
 func LaunchCore(cfg *config.UserConfig, system games.System) error {
-	if _, err := os.Stat(config.CmdInterface); err != nil {
-		return fmt.Errorf("command interface not accessible: %s", err)
-	}
-
 	if system.SetName != "" {
 		return LaunchGame(cfg, system, "")
 	}
@@ -306,79 +330,72 @@ func LaunchCore(cfg *config.UserConfig, system games.System) error {
 		return fmt.Errorf("no core found for system %s", system.Id)
 	}
 
-	cmd, err := os.OpenFile(config.CmdInterface, os.O_RDWR, 0)
-	if err != nil {
+	if err := GetCommander().LoadCore(path); err != nil {
 		return err
 	}
-	defer cmd.Close()
-
-	cmd.WriteString(fmt.Sprintf("load_core %s\n", path))
-
+	notifyLaunch(system.Id, "")
 	return nil
 }
 
 func LaunchMenu() error {
-	if _, err := os.Stat(config.CmdInterface); err != nil {
-		return fmt.Errorf("command interface not accessible: %s", err)
+	// TODO: don't hardcode here
+	return GetCommander().LoadCore(filepath.Join(config.SdFolder, "menu.rbf"))
+}
+
+// LaunchGenericFile Given a generic file path, launch it using the correct method, if possible.
+func LaunchGenericFile(cfg *config.UserConfig, path string) error {
+	system, _ := games.BestSystemMatch(cfg, path)
+	return LaunchGenericFileAs(cfg, system, path)
+}
+
+// LaunchGenericFileAs launches a file like LaunchGenericFile but with a given
+// system, e.g. one picked by the user when detection wasn't sure. An empty
+// system only launches files which don't need one.
+func LaunchGenericFileAs(cfg *config.UserConfig, system games.System, path string) error {
+	// check if sidelaunchers wants to handle this system specially
+	if system.Id != "" {
+		if handled, err := SideLaunchers(cfg, system, path); handled {
+			if err == nil {
+				notifyLaunch(system.Id, path)
+			}
+			return err
+		}
 	}
 
-	cmd, err := os.OpenFile(config.CmdInterface, os.O_RDWR, 0)
+	var err error
+	isGame := false
+	ext := s.ToLower(filepath.Ext(path))
+
+	switch ext {
+	case ".mra":
+		err = launchMra(system, path)
+	case ".mgl":
+		err = launchFile(path)
+		isGame = true
+	case ".rbf":
+		err = launchFile(path)
+	default:
+		if system.Id == "" {
+			return fmt.Errorf("unknown file type: %s", ext)
+		}
+		err = launchWithMacro(cfg, system, path)
+		isGame = true
+	}
 	if err != nil {
 		return err
 	}
-	defer cmd.Close()
 
-	// TODO: don't hardcode here
-	cmd.WriteString(fmt.Sprintf("load_core %s\n", filepath.Join(config.SdFolder, "menu.rbf")))
+	// Track active game if applicable
+	if ActiveGameEnabled() && isGame {
+		if err := SetActiveGame(path); err != nil {
+			return err
+		}
+	}
 
+	notifyLaunch(system.Id, path)
 	return nil
 }
 
-// LaunchGenericFile Given a generic file path, launch it using the correct method, if possible.
-func LaunchGenericFile(cfg *config.UserConfig, path string) error {
-	
-    system, _ := games.BestSystemMatch(cfg, path)
-
-    // check if sidelaunchers wants to handle this system specially
-    if system.Id != "" {
-        if handled, err := SideLaunchers(cfg, system, path); handled {
-            return err
-        }
-    }
-
-    var err error
-    isGame := false
-    ext := s.ToLower(filepath.Ext(path))
-
-    switch ext {
-    case ".mra":
-        err = launchFile(path)
-    case ".mgl":
-        err = launchFile(path)
-        isGame = true
-    case ".rbf":
-        err = launchFile(path)
-    default:
-        if system.Id == "" {
-            return fmt.Errorf("unknown file type: %s", ext)
-        }
-        err = launchTempMgl(cfg, &system, path)
-        isGame = true
-    }
-    if err != nil {
-        return err
-    }
-
-    // Track active game if applicable
-    if ActiveGameEnabled() && isGame {
-        if err := SetActiveGame(path); err != nil {
-            return err
-        }
-    }
-
-    return nil
-}
-
 // TryPickRandomGame recursively searches through given folder for a valid game
 // file for that system.
 func TryPickRandomGame(system *games.System, folder string) (string, error) {
@@ -483,138 +500,6 @@ func LaunchRandomGame(cfg *config.UserConfig, systems []games.System) error {
 	return fmt.Errorf("failed to find a random game")
 }
 
-func LaunchToken(cfg *config.UserConfig, manual bool, kbd *virtualinput.Keyboard, text string) error {
-	// detection can never be perfect, but these characters are illegal in
-	// windows filenames and heavily avoided in linux. use them to mark that
-	// this is a command
-	if s.HasPrefix(text, "**") {
-		text = s.TrimPrefix(text, "**")
-		parts := s.SplitN(text, ":", 2)
-		if len(parts) < 2 {
-			return fmt.Errorf("invalid command: %s", text)
-		}
-
-		cmd, args := s.TrimSpace(parts[0]), s.TrimSpace(parts[1])
-
-		switch cmd {
-		case "system":
-			if s.EqualFold(args, "menu") {
-				return LaunchMenu()
-			}
-
-			system, err := games.LookupSystem(args)
-			if err != nil {
-				return err
-			}
-			return LaunchCore(cfg, *system)
-
-		case "command":
-			if !manual {
-				return fmt.Errorf("commands must be manually run")
-			}
-			command := exec.Command("bash", "-c", args)
-			if err := command.Start(); err != nil {
-				return err
-			}
-			return nil
-
-		case "random":
-			if args == "" {
-				return fmt.Errorf("no system specified")
-			}
-			if args == "all" {
-				return LaunchRandomGame(cfg, games.AllSystems())
-			}
-			system, err := games.LookupSystem(args)
-			if err != nil {
-				return err
-			}
-			return LaunchRandomGame(cfg, []games.System{*system})
-
-		case "ini":
-			inis, err := GetAllMisterIni()
-			if err != nil {
-				return err
-			}
-			if len(inis) == 0 {
-				return fmt.Errorf("no ini files found")
-			}
-			id, err := strconv.Atoi(args)
-			if err != nil {
-				return err
-			}
-			if id < 1 || id > len(inis) {
-				return fmt.Errorf("ini id out of range: %d", id)
-			}
-			return SetActiveIni(id, true)
-
-		case "get":
-			go func() { _, _ = http.Get(args) }()
-			return nil
-
-		case "key":
-			code, err := strconv.Atoi(args)
-			if err != nil {
-				return err
-			}
-			return kbd.Press(code)
-
-		case "coinp1":
-			amount, err := strconv.Atoi(args)
-			if err != nil {
-				return err
-			}
-			for i := 0; i < amount; i++ {
-				_ = kbd.Press(6) // P1 coin
-				time.Sleep(100 * time.Millisecond)
-			}
-			return nil
-
-		case "coinp2":
-			amount, err := strconv.Atoi(args)
-			if err != nil {
-				return err
-			}
-			for i := 0; i < amount; i++ {
-				_ = kbd.Press(7) // P2 coin
-				time.Sleep(100 * time.Millisecond)
-			}
-			return nil
-
-		default:
-			return fmt.Errorf("unknown command: %s", cmd)
-		}
-	}
-
-	// not a command → treat as path
-	if filepath.IsAbs(text) {
-		return LaunchGenericFile(cfg, text)
-	}
-	if filepath.Ext(text) == "" {
-		return LaunchShortCore(text)
-	}
-
-	parts := s.Split(text, "/")
-	for i, part := range parts {
-		if s.HasSuffix(s.ToLower(part), ".zip") {
-			zipPath := filepath.Join(parts[:i+1]...)
-			for _, folder := range games.GetGamesFolders(cfg) {
-				if _, err := os.Stat(filepath.Join(folder, zipPath)); err == nil {
-					return LaunchGenericFile(cfg, filepath.Join(folder, text))
-				}
-			}
-			break
-		}
-	}
-	for _, folder := range games.GetGamesFolders(cfg) {
-		path := filepath.Join(folder, text)
-		if _, err := os.Stat(path); err == nil {
-			return LaunchGenericFile(cfg, path)
-		}
-	}
-	return fmt.Errorf("could not find file: %s", text)
-}
-
 func RelaunchIfInMenu() error {
 	if _, err := os.Stat(config.CoreNameFile); err == nil {
 		name, err := os.ReadFile(config.CoreNameFile)
@@ -0,0 +1,272 @@
+package mister
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	s "strings"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/games"
+	"github.com/synrais/SAM-GO/pkg/gamesdb"
+	"github.com/synrais/SAM-GO/pkg/utils"
+)
+
+// The launcher library is a folder of .mgl (and arcade .mra) launchers, one
+// per game in the games database, laid out like the games menu. MiSTer shows
+// it in the OSD so games can be browsed and launched without SAM running.
+
+// LauncherFilter picks which games get launchers. The zero value picks
+// everything.
+type LauncherFilter struct {
+	// Systems are the system IDs to include, empty for all.
+	Systems []string
+	// Query is words which must all be in a game's name, like the search
+	// token.
+	Query string
+}
+
+func (f LauncherFilter) Match(file gamesdb.FileInfo) bool {
+	if len(f.Systems) > 0 {
+		found := false
+		for _, id := range f.Systems {
+			if s.EqualFold(s.TrimSpace(id), file.SystemId) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	name := s.ToLower(file.Name)
+	for _, w := range s.Fields(s.ToLower(f.Query)) {
+		if !s.Contains(name, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// LauncherSync is the result of syncing a launcher folder.
+type LauncherSync struct {
+	Created  int
+	Existing int
+	Pruned   int
+	Failed   int
+}
+
+// launcherPath returns where a game's launcher goes in folder, following its
+// menu path so the tree matches the games menu.
+func launcherPath(system *games.System, folder string, file gamesdb.FileInfo) string {
+	dir := filepath.Join(folder, filepath.FromSlash(filepath.Dir(file.MenuPath)))
+	return GetLauncherFilename(system, dir, file.Name)
+}
+
+// launcherManifest is the file in a launcher folder listing the launchers
+// SAM wrote there, so sync and remove never touch launchers put there by
+// hand. Each line is a system ID and a launcher path relative to the folder,
+// separated by a tab.
+const launcherManifest = ".sam_launchers"
+
+// readLauncherManifest returns the launchers SAM made in folder, mapped to
+// their system IDs.
+func readLauncherManifest(folder string) (map[string]string, error) {
+	made := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(folder, launcherManifest))
+	if os.IsNotExist(err) {
+		return made, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, line := range s.Split(string(data), "\n") {
+		system, rel, ok := s.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		made[filepath.Join(folder, filepath.FromSlash(rel))] = system
+	}
+	return made, nil
+}
+
+// writeLauncherManifest saves the launchers SAM made in folder, removing the
+// manifest once there are none.
+func writeLauncherManifest(folder string, made map[string]string) error {
+	path := filepath.Join(folder, launcherManifest)
+	if len(made) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var sb s.Builder
+	for _, launcher := range utils.SortedMapKeys(made) {
+		rel, err := filepath.Rel(folder, launcher)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(made[launcher] + "\t" + filepath.ToSlash(rel) + "\n")
+	}
+	return utils.WriteFileAtomic(path, []byte(sb.String()), 0644)
+}
+
+// isLauncherFor reports whether a launcher starts exactly gameFile, the way
+// SAM would have written it.
+func isLauncherFor(path string, gameFile string) bool {
+	if s.EqualFold(filepath.Ext(path), ".mra") {
+		target, err := os.Readlink(path)
+		return err == nil && target == gameFile
+	}
+
+	mgl, err := ReadMgl(path)
+	return err == nil && len(mgl.Files) == 1 && mgl.Files[0].AbsPath() == gameFile
+}
+
+// SyncLaunchers makes folder hold a launcher for every file matching filter.
+// Existing launchers are left alone, so only new games are written. Of the
+// launchers SAM made for the filter's systems, ones whose game has gone from
+// the database or the disk are removed. Launchers for games the query leaves
+// out are kept, so syncs with different filters add up, and launchers SAM
+// didn't make are never touched. status is called with each launcher
+// created and may be nil.
+func SyncLaunchers(cfg *config.UserConfig, files []gamesdb.FileInfo, folder string, filter LauncherFilter, status func(path string)) (LauncherSync, error) {
+	var result LauncherSync
+	made, err := readLauncherManifest(folder)
+	if err != nil {
+		return result, fmt.Errorf("failed to read launchers: %w", err)
+	}
+	known := make(map[string]bool)
+	exists := games.NewFileChecker()
+	systemsOnly := LauncherFilter{Systems: filter.Systems}
+
+	for _, file := range files {
+		if !systemsOnly.Match(file) {
+			continue
+		}
+
+		system, err := games.GetSystem(file.SystemId)
+		if err != nil {
+			continue
+		}
+
+		path := launcherPath(system, folder, file)
+		if known[path] {
+			// same name with another extension, first one wins
+			continue
+		}
+		if !exists.Exists(file.Path) {
+			// database is out of date, leave it to be pruned
+			continue
+		}
+		known[path] = true
+		if !filter.Match(file) {
+			continue
+		}
+
+		if _, err := os.Lstat(path); err == nil {
+			if _, ok := made[path]; !ok && isLauncherFor(path, file.Path) {
+				// made before SAM kept track
+				made[path] = system.Id
+			}
+			result.Existing++
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return result, fmt.Errorf("failed to create launcher folder: %w", err)
+		}
+		if _, err := CreateLauncher(cfg, system, file.Path, filepath.Dir(path), file.Name); err != nil {
+			logger.Error("launcher for %s: %v", file.Path, err)
+			result.Failed++
+			continue
+		}
+		made[path] = system.Id
+		result.Created++
+		if status != nil {
+			status(path)
+		}
+	}
+
+	pruned, err := removeLaunchers(folder, made, func(path, system string) bool {
+		return systemsOnly.Match(gamesdb.FileInfo{SystemId: system}) && !known[path]
+	})
+	result.Pruned = pruned
+	return result, err
+}
+
+// launcherTargetExists checks the game a launcher starts is still there.
+// Arcade launchers are symlinks, so a dangling link means it's gone.
+func launcherTargetExists(path string, exists func(string) bool) bool {
+	if s.EqualFold(filepath.Ext(path), ".mra") {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	mgl, err := ReadMgl(path)
+	if err != nil {
+		return false
+	}
+	for _, f := range mgl.Files {
+		if !exists(f.AbsPath()) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeLaunchers removes the launchers SAM made in folder which match, then
+// any folders left empty, and updates the manifest. It returns how many
+// launchers were removed.
+func removeLaunchers(folder string, made map[string]string, match func(path, system string) bool) (int, error) {
+	removed := 0
+	for _, path := range utils.SortedMapKeys(made) {
+		if !match(path, made[path]) {
+			continue
+		}
+		if err := DeleteLauncher(path); err != nil {
+			_ = writeLauncherManifest(folder, made)
+			return removed, err
+		}
+		delete(made, path)
+		removed++
+	}
+
+	if _, err := os.Stat(folder); os.IsNotExist(err) {
+		return removed, nil
+	}
+	if err := writeLauncherManifest(folder, made); err != nil {
+		return removed, fmt.Errorf("failed to save launchers: %w", err)
+	}
+	if err := utils.RemoveEmptyDirs(folder); err != nil {
+		return removed, fmt.Errorf("failed to remove empty folders: %w", err)
+	}
+	return removed, nil
+}
+
+// PruneLaunchers removes the launchers SAM made in folder whose game no
+// longer exists, then any folders left empty. It returns how many launchers
+// were removed.
+func PruneLaunchers(folder string) (int, error) {
+	made, err := readLauncherManifest(folder)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read launchers: %w", err)
+	}
+
+	checker := games.NewFileChecker()
+	return removeLaunchers(folder, made, func(path, _ string) bool {
+		return !launcherTargetExists(path, checker.Exists)
+	})
+}
+
+// RemoveLaunchers removes every launcher SAM made in folder.
+func RemoveLaunchers(folder string) (int, error) {
+	made, err := readLauncherManifest(folder)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read launchers: %w", err)
+	}
+	return removeLaunchers(folder, made, func(string, string) bool { return true })
+}
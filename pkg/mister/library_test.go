@@ -0,0 +1,129 @@
+package mister
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/gamesdb"
+)
+
+func TestLauncherFilter(t *testing.T) {
+	file := gamesdb.FileInfo{SystemId: "NES", Name: "Super Mario Bros. 3 (USA)"}
+
+	tests := []struct {
+		filter LauncherFilter
+		want   bool
+	}{
+		{LauncherFilter{}, true},
+		{LauncherFilter{Systems: []string{"snes", " nes"}}, true},
+		{LauncherFilter{Systems: []string{"SNES"}}, false},
+		{LauncherFilter{Query: "mario 3"}, true},
+		{LauncherFilter{Query: "mario 2"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Match(file); got != tt.want {
+			t.Errorf("%+v.Match() = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestSyncLaunchers(t *testing.T) {
+	games := t.TempDir()
+	folder := filepath.Join(t.TempDir(), "_Games")
+
+	var files []gamesdb.FileInfo
+	for _, name := range []string{"Alpha", "Beta", "Gamma"} {
+		path := filepath.Join(games, name+".nes")
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, gamesdb.FileInfo{
+			SystemId: "NES",
+			Name:     name,
+			Ext:      "nes",
+			Path:     path,
+			MenuPath: "NES/Sub/" + name + ".nes",
+		})
+	}
+	cfg := &config.UserConfig{}
+
+	result, err := SyncLaunchers(cfg, files, folder, LauncherFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Created != 3 {
+		t.Fatalf("created %d launchers, want 3", result.Created)
+	}
+
+	mgl, err := ReadMgl(filepath.Join(folder, "NES", "Sub", "Alpha.mgl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mgl.Files) != 1 || mgl.Files[0].AbsPath() != files[0].Path {
+		t.Errorf("launcher files = %+v", mgl.Files)
+	}
+
+	// a game disappears and another is filtered out
+	if err := os.Remove(files[1].Path); err != nil {
+		t.Fatal(err)
+	}
+	result, err = SyncLaunchers(cfg, files, folder, LauncherFilter{Query: "a"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LauncherSync{Existing: 2, Pruned: 1}
+	if result != want {
+		t.Errorf("second sync = %+v, want %+v", result, want)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "NES", "Sub", "Beta.mgl")); !os.IsNotExist(err) {
+		t.Errorf("launcher for missing game wasn't removed")
+	}
+
+	// launchers filtered out of a sync, and ones SAM didn't make, are kept
+	user := filepath.Join(folder, "NES", "Sub", "Mine.mgl")
+	if err := os.WriteFile(user, []byte("<mistergamedescription/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = SyncLaunchers(cfg, files, folder, LauncherFilter{Query: "alpha"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (LauncherSync{Existing: 1}); result != want {
+		t.Errorf("filtered sync = %+v, want %+v", result, want)
+	}
+	result, err = SyncLaunchers(cfg, nil, folder, LauncherFilter{Systems: []string{"SNES"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (LauncherSync{}) {
+		t.Errorf("other system sync = %+v", result)
+	}
+	for _, name := range []string{"Gamma.mgl", "Mine.mgl"} {
+		if _, err := os.Stat(filepath.Join(folder, "NES", "Sub", name)); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+
+	removed, err := RemoveLaunchers(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("removed %d launchers, want 2", removed)
+	}
+	if _, err := os.Stat(user); err != nil {
+		t.Errorf("remove deleted a launcher SAM didn't make: %v", err)
+	}
+	if err := os.Remove(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RemoveLaunchers(folder); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(folder); !os.IsNotExist(err) {
+		t.Errorf("empty launcher folder wasn't removed")
+	}
+}
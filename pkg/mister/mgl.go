@@ -0,0 +1,138 @@
+package mister
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/synrais/SAM-GO/pkg/games"
+)
+
+// mglRootPrefix makes an absolute path usable in an MGL. MiSTer resolves file
+// paths relative to the core's games folder, so climbing back up to / first
+// lets any absolute path be loaded.
+const mglRootPrefix = "../../../../.."
+
+type MGLSetName struct {
+	Name    string `xml:",chardata"`
+	SameDir int    `xml:"same_dir,attr,omitempty"`
+}
+
+type MGLFile struct {
+	Delay int    `xml:"delay,attr"`
+	Type  string `xml:"type,attr"`
+	Index int    `xml:"index,attr"`
+	Path  string `xml:"path,attr"`
+}
+
+type MGLReset struct {
+	Delay int `xml:"delay,attr"`
+}
+
+// MGL is a MiSTer game description file: the core to load, an optional set
+// name, any number of files to mount and an optional reset once loaded.
+type MGL struct {
+	XMLName xml.Name    `xml:"mistergamedescription"`
+	Rbf     string      `xml:"rbf"`
+	SetName *MGLSetName `xml:"setname,omitempty"`
+	Files   []MGLFile   `xml:"file"`
+	Reset   *MGLReset   `xml:"reset,omitempty"`
+}
+
+// NewMGLFile builds a file entry for an absolute path.
+func NewMGLFile(params games.MglParams, path string) MGLFile {
+	return MGLFile{
+		Delay: params.Delay,
+		Type:  params.Method,
+		Index: params.Index,
+		Path:  mglRootPrefix + path,
+	}
+}
+
+// AbsPath returns the file's path with the root prefix removed, which is the
+// absolute path for entries made by NewMGLFile.
+func (f MGLFile) AbsPath() string {
+	if strings.HasPrefix(f.Path, mglRootPrefix+"/") {
+		return strings.TrimPrefix(f.Path, mglRootPrefix)
+	}
+	return f.Path
+}
+
+// SetSetName sets the set name, or clears it when name is empty.
+func (m *MGL) SetSetName(name string, sameDir bool) {
+	if name == "" {
+		m.SetName = nil
+		return
+	}
+	m.SetName = &MGLSetName{Name: name}
+	if sameDir {
+		m.SetName.SameDir = 1
+	}
+}
+
+// Marshal renders the MGL as XML, escaping anything in paths and names which
+// would otherwise break the file.
+func (m MGL) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode mgl: %w", err)
+	}
+
+	// encoding/xml escapes quotes numerically, use the named entities which
+	// every XML parser understands
+	data = bytes.ReplaceAll(data, []byte("&#34;"), []byte("&quot;"))
+	data = bytes.ReplaceAll(data, []byte("&#39;"), []byte("&apos;"))
+
+	return append(data, '\n'), nil
+}
+
+func (m MGL) String() string {
+	data, err := m.Marshal()
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// ParseMgl reads an MGL document. Parsing is lenient because MGLs are often
+// written by hand.
+func ParseMgl(data []byte) (MGL, error) {
+	var mgl MGL
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	if err := decoder.Decode(&mgl); err != nil {
+		return mgl, fmt.Errorf("failed to parse mgl: %w", err)
+	}
+
+	mgl.Rbf = strings.TrimSpace(mgl.Rbf)
+	if mgl.SetName != nil {
+		mgl.SetName.Name = strings.TrimSpace(mgl.SetName.Name)
+	}
+
+	return mgl, nil
+}
+
+func ReadMgl(path string) (MGL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MGL{}, err
+	}
+	return ParseMgl(data)
+}
+
+func WriteMgl(path string, mgl MGL) error {
+	data, err := mgl.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write mgl file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package mister
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/synrais/SAM-GO/pkg/games"
+)
+
+func TestReadMgl(t *testing.T) {
+	var tests = []struct {
+		path string
+		want MGL
+	}{
+		{"testdata/mgl/ao486.mgl", MGL{
+			Rbf: "_Computer/ao486",
+			Files: []MGLFile{
+				{Delay: 0, Type: "s", Index: 2, Path: "../../../../../media/fat/games/AO486/IDE 0-0 BOOT-DOS98.vhd"},
+				{Delay: 0, Type: "s", Index: 3, Path: "../../../../../media/fat/games/AO486/IDE 0-1 Top 300 DOS Games.vhd"},
+			},
+			Reset: &MGLReset{Delay: 1},
+		}},
+		{"testdata/mgl/fds.mgl", MGL{
+			Rbf:     "_Console/NES",
+			SetName: &MGLSetName{Name: "FDS", SameDir: 1},
+			Files: []MGLFile{
+				{Delay: 2, Type: "f", Index: 0, Path: "../../../../../media/fat/games/NES/Zelda no Densetsu (Japan).fds"},
+			},
+		}},
+		{"testdata/mgl/handwritten.mgl", MGL{
+			Rbf: "_Console/SNES",
+			Files: []MGLFile{
+				{Delay: 1, Type: "f", Index: 0, Path: "Super Mario World & Friends.sfc"},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := ReadMgl(tt.path)
+		if err != nil {
+			t.Errorf("ReadMgl(%q): %v", tt.path, err)
+			continue
+		}
+		got.XMLName = tt.want.XMLName
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadMgl(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMglRoundTrip(t *testing.T) {
+	for _, path := range []string{
+		"testdata/mgl/ao486.mgl",
+		"testdata/mgl/fds.mgl",
+		"testdata/mgl/handwritten.mgl",
+	} {
+		orig, err := ReadMgl(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := orig.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ParseMgl(data)
+		if err != nil {
+			t.Fatalf("%s: reparse failed: %v\n%s", path, err, data)
+		}
+		if !reflect.DeepEqual(got, orig) {
+			t.Errorf("%s: round trip = %+v, want %+v", path, got, orig)
+		}
+	}
+}
+
+func TestMglEscaping(t *testing.T) {
+	mgl := MGL{Rbf: "_Console/SNES"}
+	mgl.SetSetName(`Tom & "Jerry"`, false)
+	mgl.Files = []MGLFile{NewMGLFile(games.MglParams{Delay: 1, Method: "f", Index: 0}, `/media/fat/games/SNES/Tom & Jerry "Beta" <1993>.sfc`)}
+
+	data, err := mgl.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<mistergamedescription>
+	<rbf>_Console/SNES</rbf>
+	<setname>Tom &amp; &quot;Jerry&quot;</setname>
+	<file delay="1" type="f" index="0" path="../../../../../media/fat/games/SNES/Tom &amp; Jerry &quot;Beta&quot; &lt;1993&gt;.sfc"></file>
+</mistergamedescription>
+`
+	if string(data) != want {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", data, want)
+	}
+
+	got, err := ParseMgl(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Files[0].AbsPath() != `/media/fat/games/SNES/Tom & Jerry "Beta" <1993>.sfc` {
+		t.Errorf("AbsPath() = %q", got.Files[0].AbsPath())
+	}
+	if got.SetName.Name != `Tom & "Jerry"` {
+		t.Errorf("SetName = %q", got.SetName.Name)
+	}
+}
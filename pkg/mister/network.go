@@ -19,7 +19,6 @@ import (
 const (
 	DefaultHostname = "MiSTer"
 	MdnsServiceName = "_mister-remote._tcp"
-	mdnsPort        = 5353
 	mdnsTTL         = 120
 	startRetries    = 30
 	discoveryTime   = 15 * time.Second
@@ -115,7 +114,7 @@ func browseMdns(logger *service.Logger) {
 	<-ctx.Done()
 }
 
-func startMdns(logger *service.Logger, appVersion string) (func() error, error) {
+func startMdns(logger *service.Logger, appVersion string, port int) (func() error, error) {
 	if Mdns.IsActive() {
 		return nil, nil
 	}
@@ -129,7 +128,7 @@ func startMdns(logger *service.Logger, appVersion string) (func() error, error)
 		"MiSTer Remote ("+hostname+")",
 		MdnsServiceName,
 		"local.",
-		mdnsPort,
+		port,
 		[]string{"version=" + appVersion},
 		nil,
 		zeroconf.TTL(mdnsTTL),
@@ -160,12 +159,12 @@ func startMdns(logger *service.Logger, appVersion string) (func() error, error)
 }
 
 // TryStartMdns will attempt to start the mDNS service, retrying multiple times if it fails. This is because a script
-// may be run at boot time before the network is available.
-func TryStartMdns(logger *service.Logger, appVersion string) func() error {
+// may be run at boot time before the network is available. port is the port of the remote API being advertised.
+func TryStartMdns(logger *service.Logger, appVersion string, port int) func() error {
 	// TODO: allow a hook function on successful browse
 	retries := 0
 	for {
-		stop, err := startMdns(logger, appVersion)
+		stop, err := startMdns(logger, appVersion, port)
 		if err == nil {
 			return stop
 		} else {
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/bendahl/uinput"
 	"github.com/synrais/SAM-GO/pkg/assets"
 	"github.com/synrais/SAM-GO/pkg/config"
 	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
@@ -20,27 +19,43 @@ import (
 // Registry
 // --------------------------------------------------
 
-var sideLauncherRegistry = map[string]func(*config.UserConfig, games.System, string) error{}
+type sideLauncher struct {
+	launch func(*config.UserConfig, games.System, string) error
+	// loadsGame is set when the game file itself is loaded by the core, so
+	// CURRENTPATH can confirm the launch. Others mount or patch files and
+	// boot something else.
+	loadsGame bool
+}
+
+var sideLauncherRegistry = map[string]sideLauncher{}
 
-func registerSideLauncher(id string, fn func(*config.UserConfig, games.System, string) error) {
+func registerSideLauncher(id string, fn func(*config.UserConfig, games.System, string) error, loadsGame bool) {
 	id = strings.ToLower(id)
-	sideLauncherRegistry[id] = fn
+	sideLauncherRegistry[id] = sideLauncher{launch: fn, loadsGame: loadsGame}
 }
 
 func init() {
-	registerSideLauncher("AmigaVision", LaunchAmigaVision)
-	registerSideLauncher("AmigaCD32", LaunchCD32)
-	registerSideLauncher("FDS", LaunchFDS)
-	registerSideLauncher("GameNWatch", LaunchGameNWatch)
+	registerSideLauncher("AmigaVision", LaunchAmigaVision, false)
+	registerSideLauncher("AmigaCD32", LaunchCD32, false)
+	registerSideLauncher("FDS", LaunchFDS, true)
+	registerSideLauncher("GameNWatch", LaunchGameNWatch, true)
+}
+
+func lookupSideLauncher(systemId string) (sideLauncher, bool) {
+	sl, ok := sideLauncherRegistry[strings.ToLower(systemId)]
+	return sl, ok
 }
 
 // SideLaunchers checks if system.Id has a sidelauncher
 func SideLaunchers(cfg *config.UserConfig, system games.System, path string) (bool, error) {
-	fn, ok := sideLauncherRegistry[strings.ToLower(system.Id)]
+	sl, ok := lookupSideLauncher(system.Id)
 	if !ok {
 		return false, nil
 	}
-	return true, fn(cfg, system, path)
+	if skipForDryRun("%s side launcher for %s", system.Id, path) {
+		return true, nil
+	}
+	return true, sl.launch(cfg, system, path)
 }
 
 // --------------------------------------------------
@@ -165,12 +180,10 @@ func LaunchAmigaVision(cfg *config.UserConfig, system games.System, path string)
 	_ = exec.Command("umount", sharedDir).Run()
 	_ = exec.Command("mount", "--bind", tmpShared, sharedDir).Run()
 
-	mgl := `<mistergamedescription>
-	<rbf>_computer/minimig</rbf>
-	<setname same_dir="1">AmigaVision</setname>
-</mistergamedescription>`
+	mgl := MGL{Rbf: "_computer/minimig"}
+	mgl.SetSetName("AmigaVision", true)
 	tmpMgl := config.LastLaunchFile
-	_ = os.WriteFile(tmpMgl, []byte(mgl), 0644)
+	_ = WriteMgl(tmpMgl, mgl)
 
 	return launchFile(tmpMgl)
 }
@@ -339,12 +352,10 @@ func LaunchCD32(cfg *config.UserConfig, system games.System, path string) error
 	_ = exec.Command("umount", misterCfg).Run()
 	_ = exec.Command("mount", "--bind", tmpCfg, misterCfg).Run()
 
-	mgl := `<mistergamedescription>
-	<rbf>_computer/minimig</rbf>
-	<setname same_dir="1">AmigaCD32</setname>
-</mistergamedescription>`
+	mgl := MGL{Rbf: "_computer/minimig"}
+	mgl.SetSetName("AmigaCD32", true)
 	tmpMgl := config.LastLaunchFile
-	_ = os.WriteFile(tmpMgl, []byte(mgl), 0644)
+	_ = WriteMgl(tmpMgl, mgl)
 
 	if hdfToUse == "CD32Winboot.hdf" {
 		go func() {
@@ -364,11 +375,65 @@ func LaunchCD32(cfg *config.UserConfig, system games.System, path string) error
 }
 
 // --------------------------------------------------
-// FDS Sidelauncher
+// Boot macros
 // --------------------------------------------------
 
-func LaunchFDS(cfg *config.UserConfig, system games.System, path string) error {
+// defaultBootMacros are gamepad macros run after launching a game, for cores
+// which need a button press to get past a BIOS or menu screen. They can be
+// replaced, or disabled with an empty script, in the [macros] section of the
+// user config:
+//
+//	boot = FDS: wait 10s; press east
+var defaultBootMacros = map[string]string{
+	"fds":        "wait 10s; press east",
+	"gamenwatch": "wait 10s; press east; wait 1s; press south; wait 1s; press west; wait 1s; press north; wait 1s",
+}
+
+// BootMacro returns the boot macro script for a system, if it has one.
+func BootMacro(cfg *config.UserConfig, systemId string) string {
+	for _, entry := range cfg.Macros.Boot {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(parts[0]), systemId) {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return defaultBootMacros[strings.ToLower(systemId)]
+}
+
+// macroGamepad is the virtual gamepad a boot macro is played on.
+type macroGamepad interface {
+	RunMacro(steps []virtualinput.MacroStep) error
+	Close() error
+}
+
+// newMacroGamepad creates the gamepad for a boot macro. Tests replace it so
+// no uinput device is needed.
+var newMacroGamepad = func() (macroGamepad, error) {
 	gpd, err := virtualinput.NewGamepad(40 * time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	return &gpd, nil
+}
+
+// launchWithMacro launches a game and plays the system's boot macro on a
+// virtual gamepad in the background. The gamepad is created before the launch
+// so the core has already picked it up by the time the macro starts.
+func launchWithMacro(cfg *config.UserConfig, system games.System, path string) error {
+	script := BootMacro(cfg, system.Id)
+	if script == "" || skipForDryRun("%s boot macro: %s", system.Id, script) {
+		return launchTempMgl(cfg, &system, path)
+	}
+
+	steps, err := virtualinput.ParseMacro(script)
+	if err != nil {
+		return fmt.Errorf("invalid boot macro for %s: %w", system.Id, err)
+	}
+
+	gpd, err := newMacroGamepad()
 	if err != nil {
 		return err
 	}
@@ -378,9 +443,10 @@ func LaunchFDS(cfg *config.UserConfig, system games.System, path string) error {
 		return err
 	}
 
-	go func(g virtualinput.Gamepad) {
-		time.Sleep(10 * time.Second)
-		_ = g.Press(uinput.ButtonEast)
+	go func(g macroGamepad) {
+		if err := g.RunMacro(steps); err != nil {
+			logger.Error("%s boot macro failed: %v", system.Id, err)
+		}
 		_ = g.Close()
 	}(gpd)
 
@@ -388,32 +454,17 @@ func LaunchFDS(cfg *config.UserConfig, system games.System, path string) error {
 }
 
 // --------------------------------------------------
-// GameNWatch Sidelauncher (non-blocking + logging)
+// FDS Sidelauncher
 // --------------------------------------------------
 
-func LaunchGameNWatch(cfg *config.UserConfig, system games.System, path string) error {
-	gpd, err := virtualinput.NewGamepad(40 * time.Millisecond)
-	if err != nil {
-		return err
-	}
-
-	if err := launchTempMgl(cfg, &system, path); err != nil {
-		_ = gpd.Close()
-		return err
-	}
+func LaunchFDS(cfg *config.UserConfig, system games.System, path string) error {
+	return launchWithMacro(cfg, system, path)
+}
 
-	go func(g virtualinput.Gamepad) {
-		time.Sleep(10 * time.Second)
-		_ = g.Press(uinput.ButtonEast)
-		time.Sleep(1 * time.Second)
-		_ = g.Press(uinput.ButtonSouth)
-		time.Sleep(1 * time.Second)
-		_ = g.Press(uinput.ButtonWest)
-		time.Sleep(1 * time.Second)
-		_ = g.Press(uinput.ButtonNorth)
-		time.Sleep(1 * time.Second)
-		_ = g.Close()
-	}(gpd)
+// --------------------------------------------------
+// GameNWatch Sidelauncher
+// --------------------------------------------------
 
-	return nil
+func LaunchGameNWatch(cfg *config.UserConfig, system games.System, path string) error {
+	return launchWithMacro(cfg, system, path)
 }
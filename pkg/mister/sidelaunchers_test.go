@@ -0,0 +1,105 @@
+package mister
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/assets"
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/games"
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
+)
+
+// TestBootMacroDocumented loads the [macros] examples from the default
+// SAM.ini, uncommented, and checks every step survives.
+func TestBootMacroDocumented(t *testing.T) {
+	var examples []string
+	for _, line := range strings.Split(string(assets.DefaultSAMIni), "\n") {
+		if strings.HasPrefix(line, ";boot = ") {
+			examples = append(examples, strings.TrimPrefix(line, ";"))
+		}
+	}
+	if len(examples) == 0 {
+		t.Fatal("no boot macro examples in SAM.ini")
+	}
+
+	path := filepath.Join(t.TempDir(), "SAM.ini")
+	contents := "[macros]\n" + strings.Join(examples, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(config.UserConfigEnv, path)
+
+	cfg, err := config.LoadUserConfig("SAM", &config.UserConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, example := range examples {
+		system, want, _ := strings.Cut(strings.TrimPrefix(example, "boot = "), ":")
+		want = strings.TrimSpace(want)
+
+		got := BootMacro(cfg, system)
+		if got != want {
+			t.Errorf("BootMacro(%s) = %q, want %q", system, got, want)
+		}
+		steps, err := virtualinput.ParseMacro(got)
+		if err != nil {
+			t.Errorf("%s: %v", system, err)
+		} else if n := strings.Count(want, ";") + 1; len(steps) != n {
+			t.Errorf("%s: parsed %d steps, want %d", system, len(steps), n)
+		}
+	}
+}
+
+// fakeGamepad sends the macro it's asked to play.
+type fakeGamepad struct {
+	played chan []virtualinput.MacroStep
+}
+
+func (f *fakeGamepad) RunMacro(steps []virtualinput.MacroStep) error {
+	f.played <- steps
+	return nil
+}
+
+func (f *fakeGamepad) Close() error {
+	return nil
+}
+
+func TestLaunchGenericFileBootMacro(t *testing.T) {
+	rc := &RecordingCommander{}
+	oldCommander := GetCommander()
+	SetCommander(rc)
+	defer SetCommander(oldCommander)
+
+	gpd := &fakeGamepad{played: make(chan []virtualinput.MacroStep, 1)}
+	oldGamepad := newMacroGamepad
+	newMacroGamepad = func() (macroGamepad, error) { return gpd, nil }
+	defer func() { newMacroGamepad = oldGamepad }()
+
+	system, err := games.GetSystem("SNES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.UserConfig{}
+	cfg.Macros.Boot = []string{"SNES: wait 1s; press east"}
+
+	if err := LaunchGenericFileAs(cfg, *system, "/media/fat/games/SNES/game.sfc"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rc.Commands(); len(got) != 1 || got[0] != "load_core "+config.LastLaunchFile {
+		t.Errorf("Commands() = %q", got)
+	}
+
+	select {
+	case steps := <-gpd.played:
+		if len(steps) != 2 || steps[0].Cmd != "wait" || steps[1].Cmd != "press" {
+			t.Errorf("played %+v", steps)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("boot macro wasn't played")
+	}
+}
@@ -8,9 +8,6 @@ import (
 	"github.com/synrais/SAM-GO/pkg/config"
 )
 
-// TODO: delete entry from startup
-// TODO: enable/disable entry in startup
-
 type Startup struct {
 	Entries []StartupEntry
 }
@@ -22,8 +19,6 @@ type StartupEntry struct {
 }
 
 func (s *Startup) Load() error {
-	var entries []StartupEntry
-
 	contents, err := os.ReadFile(config.StartupFile)
 	if os.IsNotExist(err) {
 		contents = []byte{}
@@ -31,7 +26,17 @@ func (s *Startup) Load() error {
 		return err
 	}
 
-	lines := strings.Split(string(contents), "\n")
+	s.Entries = parseStartup(string(contents))
+
+	return nil
+}
+
+// parseStartup splits a startup script into entries. Entries are separated
+// by blank lines, and named by a comment on their first line.
+func parseStartup(contents string) []StartupEntry {
+	var entries []StartupEntry
+
+	lines := strings.Split(contents, "\n")
 	sections := make([][]string, 0)
 
 	section := make([]string, 0)
@@ -47,6 +52,10 @@ func (s *Startup) Load() error {
 			section = append(section, line)
 		}
 	}
+	if len(section) != 0 {
+		// no newline at the end of the file
+		sections = append(sections, section)
+	}
 
 	for _, section := range sections {
 		name := ""
@@ -76,16 +85,11 @@ func (s *Startup) Load() error {
 		}
 	}
 
-	s.Entries = entries
-
-	return nil
+	return entries
 }
 
-func (s *Startup) Save() error {
-	if len(s.Entries) == 0 {
-		return fmt.Errorf("no startup entries to save")
-	}
-
+// String returns the startup script with the current entries.
+func (s *Startup) String() string {
 	contents := "#!/bin/sh\n\n"
 
 	for _, entry := range s.Entries {
@@ -100,7 +104,19 @@ func (s *Startup) Save() error {
 		contents += "\n"
 	}
 
-	return os.WriteFile(config.StartupFile, []byte(contents), 0644)
+	return contents
+}
+
+// Save writes the startup script. It's left alone if nothing changed.
+func (s *Startup) Save() error {
+	contents := s.String()
+
+	current, err := os.ReadFile(config.StartupFile)
+	if err == nil && string(current) == contents {
+		return nil
+	}
+
+	return SafeWriteFile(config.StartupFile, []byte(contents))
 }
 
 func (s *Startup) Exists(name string) bool {
@@ -113,9 +129,14 @@ func (s *Startup) Exists(name string) bool {
 	return false
 }
 
+// Enable uncomments an entry's commands. Enabling an enabled entry does
+// nothing.
 func (s *Startup) Enable(name string) error {
 	for i, entry := range s.Entries {
-		if entry.Name == name && !entry.Enabled {
+		if entry.Name == name {
+			if entry.Enabled {
+				return nil
+			}
 			s.Entries[i].Enabled = true
 			for j, cmd := range entry.Cmds {
 				if len(cmd) > 0 && cmd[0] == '#' {
@@ -130,6 +151,25 @@ func (s *Startup) Enable(name string) error {
 	return fmt.Errorf("startup entry not found: %s", name)
 }
 
+// Disable comments out an entry's commands, so it stays in the file but
+// doesn't run. Disabling a disabled entry does nothing.
+func (s *Startup) Disable(name string) error {
+	for i, entry := range s.Entries {
+		if entry.Name == name {
+			s.Entries[i].Enabled = false
+			for j, cmd := range entry.Cmds {
+				if len(cmd) > 0 && cmd[0] != '#' {
+					s.Entries[i].Cmds[j] = "#" + cmd
+				}
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("startup entry not found: %s", name)
+}
+
 func (s *Startup) Add(name string, cmd string) error {
 	if s.Exists(name) {
 		return fmt.Errorf("startup entry already exists: %s", name)
@@ -144,17 +184,140 @@ func (s *Startup) Add(name string, cmd string) error {
 	return nil
 }
 
-func (s *Startup) AddService(name string) error {
-	path, err := os.Executable()
+// executable is the program the service entry starts.
+var executable = os.Executable
+
+func serviceCmd() (string, error) {
+	path, err := executable()
 	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("[[ -e %s ]] && %s -service $1", path, path), nil
+}
+
+// AddService adds an enabled entry starting this program as a service, after
+// migrating any old entries with MigrateService. Adding it again only makes
+// sure it's enabled.
+func (s *Startup) AddService(name string) error {
+	if _, err := s.MigrateService(name); err != nil {
 		return err
 	}
 
-	cmd := fmt.Sprintf("[[ -e %s ]] && %s -service $1", path, path)
+	if s.Exists(name) {
+		return s.Enable(name)
+	}
+
+	cmd, err := serviceCmd()
+	if err != nil {
+		return err
+	}
 
 	return s.Add(name, cmd)
 }
 
+// legacySAMMarker is in every startup line added by the bash version of SAM,
+// which ran from /media/fat/Scripts/.MiSTer_SAM.
+const legacySAMMarker = "MiSTer_SAM"
+
+func isLegacySAMLine(line string) bool {
+	return strings.Contains(line, legacySAMMarker)
+}
+
+// IsLegacySAM reports whether the entry starts the bash version of SAM.
+func (e StartupEntry) IsLegacySAM() bool {
+	for _, cmd := range e.Cmds {
+		if isLegacySAMLine(cmd) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isCommented(line string) bool {
+	return strings.HasPrefix(line, "#")
+}
+
+// isServiceLine reports whether a line of an entry starts SAM, so it's
+// replaced by the service entry. Every service command in SAM's own entry
+// counts, in case SAM has moved since it was added.
+func isServiceLine(entry StartupEntry, name string, cmd string, line string) bool {
+	uncommented := strings.TrimSpace(strings.TrimLeft(line, "#"))
+	if isLegacySAMLine(line) || uncommented == cmd {
+		return true
+	}
+	return entry.Name == name && strings.Contains(uncommented, " -service ")
+}
+
+// MigrateService replaces lines starting the bash version of SAM, duplicates
+// of the service entry called name and other lines running the same command
+// with one service entry. Only those lines are removed, anything else in
+// their entries is kept. The service is enabled if any of the lines it
+// replaces were, and put where the first of them was. It reports whether
+// anything changed.
+func (s *Startup) MigrateService(name string) (bool, error) {
+	cmd, err := serviceCmd()
+	if err != nil {
+		return false, err
+	}
+
+	before := s.String()
+
+	var entries []StartupEntry
+	found, enabled, at := false, false, 0
+	for _, entry := range s.Entries {
+		var kept []string
+		removed := false
+		for _, line := range entry.Cmds {
+			if isServiceLine(entry, name, cmd, line) {
+				removed = true
+				enabled = enabled || !isCommented(line)
+				continue
+			}
+			kept = append(kept, line)
+		}
+
+		if (removed || entry.Name == name) && !found {
+			found, at = true, len(entries)
+		}
+		if entry.Name == name {
+			// the name belongs to the service entry now
+			entry.Name = ""
+		}
+		if len(kept) == 0 {
+			continue
+		}
+
+		entry.Cmds = kept
+		entry.Enabled = false
+		for _, line := range kept {
+			if !isCommented(line) {
+				entry.Enabled = true
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	if !found {
+		return false, nil
+	}
+
+	service := StartupEntry{
+		Name:    name,
+		Enabled: enabled,
+		Cmds:    []string{cmd},
+	}
+	if !enabled {
+		service.Cmds[0] = "#" + cmd
+	}
+	entries = append(entries[:at], append([]StartupEntry{service}, entries[at:]...)...)
+	s.Entries = entries
+
+	return s.String() != before, nil
+}
+
+// Remove deletes an entry from the file.
 func (s *Startup) Remove(name string) error {
 	for i, entry := range s.Entries {
 		if entry.Name == name {
@@ -0,0 +1,157 @@
+package mister
+
+import (
+	"strings"
+	"testing"
+)
+
+const samPath = "/media/fat/Scripts/SAM"
+
+const legacyStartup = `#!/bin/sh
+
+# Startup MiSTer SAM - Super Attract Mode
+[[ -e "/media/fat/Scripts/.MiSTer_SAM/MiSTer_SAM_init" ]] && "/media/fat/Scripts/.MiSTer_SAM/MiSTer_SAM_init" $1 &
+
+# Startup tty2oled
+[[ -e /media/fat/tty2oled/S60tty2oled ]] && /media/fat/tty2oled/S60tty2oled $1
+
+[[ -e /media/fat/Scripts/SAM ]] && /media/fat/Scripts/SAM -service $1`
+
+func setExecutable(t *testing.T) {
+	t.Helper()
+	old := executable
+	executable = func() (string, error) { return samPath, nil }
+	t.Cleanup(func() { executable = old })
+}
+
+func TestStartupMigrateService(t *testing.T) {
+	setExecutable(t)
+
+	s := Startup{Entries: parseStartup(legacyStartup)}
+	if len(s.Entries) != 3 {
+		t.Fatalf("parsed %d entries, want 3", len(s.Entries))
+	}
+	if !s.Entries[0].IsLegacySAM() || s.Entries[1].IsLegacySAM() {
+		t.Errorf("legacy detection wrong: %+v", s.Entries)
+	}
+
+	changed, err := s.MigrateService("SAM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("MigrateService() reported no change")
+	}
+
+	want := `#!/bin/sh
+
+# SAM
+[[ -e /media/fat/Scripts/SAM ]] && /media/fat/Scripts/SAM -service $1
+
+# Startup tty2oled
+[[ -e /media/fat/tty2oled/S60tty2oled ]] && /media/fat/tty2oled/S60tty2oled $1
+
+`
+	if got := s.String(); got != want {
+		t.Errorf("migrated script =\n%s\nwant\n%s", got, want)
+	}
+
+	// everything after this is a no-op
+	if changed, err := s.MigrateService("SAM"); err != nil || changed {
+		t.Errorf("second MigrateService() = %v, %v", changed, err)
+	}
+	if err := s.AddService("SAM"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.String(); got != want {
+		t.Errorf("AddService() changed an installed entry:\n%s", got)
+	}
+}
+
+func TestStartupMigrateMixedEntry(t *testing.T) {
+	setExecutable(t)
+
+	s := Startup{Entries: parseStartup(`#!/bin/sh
+
+# Mounts and SAM
+/media/fat/linux/mount_nas.sh &
+[[ -e "/media/fat/Scripts/.MiSTer_SAM/MiSTer_SAM_init" ]] && "/media/fat/Scripts/.MiSTer_SAM/MiSTer_SAM_init" $1 &
+
+# SAM
+[[ -e /media/fat/Scripts/old/SAM ]] && /media/fat/Scripts/old/SAM -service $1
+/media/fat/Scripts/my_service.sh $1
+`)}
+
+	for _, sub := range []string{"disable", "remove"} {
+		s := Startup{Entries: append([]StartupEntry(nil), s.Entries...)}
+		if _, err := s.MigrateService("SAM"); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if sub == "disable" {
+			err = s.Disable("SAM")
+		} else {
+			err = s.Remove("SAM")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := s.String()
+		for _, line := range []string{
+			"# Mounts and SAM\n/media/fat/linux/mount_nas.sh &\n",
+			"\n/media/fat/Scripts/my_service.sh $1\n",
+		} {
+			if !strings.Contains(got, line) {
+				t.Errorf("%s: lost %q:\n%s", sub, line, got)
+			}
+		}
+		if strings.Contains(got, "MiSTer_SAM_init") || strings.Contains(got, "/old/SAM") {
+			t.Errorf("%s: old SAM lines kept:\n%s", sub, got)
+		}
+	}
+}
+
+func TestStartupEnableDisable(t *testing.T) {
+	setExecutable(t)
+
+	var s Startup
+	if err := s.AddService("SAM"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.Disable("SAM"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	disabled := "#!/bin/sh\n\n# SAM\n#[[ -e /media/fat/Scripts/SAM ]] && /media/fat/Scripts/SAM -service $1\n\n"
+	if got := s.String(); got != disabled {
+		t.Errorf("disabled script =\n%s\nwant\n%s", got, disabled)
+	}
+
+	// a disabled entry is read back as disabled, and stays that way
+	s = Startup{Entries: parseStartup(disabled)}
+	if s.Entries[0].Enabled {
+		t.Error("parsed disabled entry as enabled")
+	}
+	if _, err := s.MigrateService("SAM"); err != nil || s.Entries[0].Enabled {
+		t.Errorf("MigrateService() enabled entry: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.Enable("SAM"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !s.Entries[0].Enabled || s.Entries[0].Cmds[0][0] == '#' {
+		t.Errorf("entry not enabled: %+v", s.Entries[0])
+	}
+
+	if err := s.Remove("SAM"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Disable("SAM"); err == nil {
+		t.Error("disabled missing entry")
+	}
+}
@@ -0,0 +1,449 @@
+package mister
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	s "strings"
+	"sync"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/games"
+	"github.com/synrais/SAM-GO/pkg/gamesdb"
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
+	"github.com/synrais/SAM-GO/pkg/utils"
+)
+
+// Tokens are the text stored on NFC cards and passed to LaunchToken. A token
+// is either a path to launch or a command, marked by a leading "**":
+//
+//	**system:SNES
+//	**delay:500 || **input:{enter}
+//	**input:"{up}" "{up}" {enter}
+//
+// Commands can be chained with "||" and run in order, stopping at the first
+// error. Arguments are split on spaces, and double quotes keep spaces (and
+// "||") inside a single argument. Single quotes are left alone, they're
+// common in game names.
+
+// TokenEnv is what a token command runs with.
+type TokenEnv struct {
+	Cfg    *config.UserConfig
+	Manual bool // the token was run by the user rather than automatically
+	Kbd    *virtualinput.Keyboard
+
+	// inPlaylist is set while running a playlist entry, which can't run
+	// another playlist, even in the middle of a chain
+	inPlaylist bool
+}
+
+// TokenArgs is the argument text of a command, both as written and split.
+type TokenArgs struct {
+	Raw  string
+	List []string
+}
+
+// String returns a single argument unquoted, or the raw text otherwise.
+func (a TokenArgs) String() string {
+	if len(a.List) == 1 {
+		return a.List[0]
+	}
+	return a.Raw
+}
+
+// TokenCommand is one "**name:args" command. Commands with Manual set can
+// only run when the token was run manually, never from e.g. a card tap.
+type TokenCommand struct {
+	Name   string
+	Manual bool
+	Run    func(env TokenEnv, args TokenArgs) error
+}
+
+var (
+	tokenCommandsMu sync.RWMutex
+	tokenCommands   = map[string]TokenCommand{}
+)
+
+// RegisterTokenCommand adds a token command. Packages which mister can't
+// import, like attract, register their own commands this way.
+func RegisterTokenCommand(cmd TokenCommand) {
+	tokenCommandsMu.Lock()
+	defer tokenCommandsMu.Unlock()
+	tokenCommands[s.ToLower(cmd.Name)] = cmd
+}
+
+func lookupTokenCommand(name string) (TokenCommand, bool) {
+	tokenCommandsMu.RLock()
+	defer tokenCommandsMu.RUnlock()
+	cmd, ok := tokenCommands[s.ToLower(name)]
+	return cmd, ok
+}
+
+// TokenCommands returns the names of all registered commands.
+func TokenCommands() []string {
+	tokenCommandsMu.RLock()
+	defer tokenCommandsMu.RUnlock()
+	return utils.SortedMapKeys(tokenCommands)
+}
+
+// splitTokens splits a token on "||", ignoring any inside double quotes.
+func splitTokens(text string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '|' && s.HasPrefix(text[i:], "||") && i >= start:
+			parts = append(parts, s.TrimSpace(text[start:i]))
+			start = i + 2
+		}
+	}
+	return append(parts, s.TrimSpace(text[start:]))
+}
+
+// splitArgs splits command arguments on whitespace, keeping double quoted
+// text together and removing the quotes.
+func splitArgs(text string) ([]string, error) {
+	var args []string
+	var cur s.Builder
+	quoted := false
+	inArg := false
+
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inArg = true
+		case quoted:
+			cur.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in: %s", text)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+func LaunchToken(cfg *config.UserConfig, manual bool, kbd *virtualinput.Keyboard, text string) error {
+	return runTokens(TokenEnv{Cfg: cfg, Manual: manual, Kbd: kbd}, text)
+}
+
+func runTokens(env TokenEnv, text string) error {
+	for _, part := range splitTokens(text) {
+		if part == "" {
+			continue
+		}
+		if err := runToken(env, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runToken(env TokenEnv, text string) error {
+	// detection can never be perfect, but these characters are illegal in
+	// windows filenames and heavily avoided in linux. use them to mark that
+	// this is a command
+	if s.HasPrefix(text, "**") {
+		text = s.TrimPrefix(text, "**")
+		parts := s.SplitN(text, ":", 2)
+		if len(parts) < 2 {
+			return fmt.Errorf("invalid command: %s", text)
+		}
+
+		name, raw := s.TrimSpace(parts[0]), s.TrimSpace(parts[1])
+		cmd, ok := lookupTokenCommand(name)
+		if !ok {
+			return fmt.Errorf("unknown command: %s", name)
+		}
+		if cmd.Manual && !env.Manual {
+			return fmt.Errorf("%s commands must be manually run", cmd.Name)
+		}
+
+		list, err := splitArgs(raw)
+		if err != nil {
+			return err
+		}
+		return cmd.Run(env, TokenArgs{Raw: raw, List: list})
+	}
+
+	return launchTokenPath(env.Cfg, text)
+}
+
+// launchTokenPath launches a token which isn't a command, an absolute path or
+// one relative to the games folders.
+func launchTokenPath(cfg *config.UserConfig, text string) error {
+	if filepath.IsAbs(text) {
+		return LaunchGenericFile(cfg, text)
+	}
+	if filepath.Ext(text) == "" {
+		return LaunchShortCore(text)
+	}
+
+	parts := s.Split(text, "/")
+	for i, part := range parts {
+		if s.HasSuffix(s.ToLower(part), ".zip") {
+			zipPath := filepath.Join(parts[:i+1]...)
+			for _, folder := range games.GetGamesFolders(cfg) {
+				if _, err := os.Stat(filepath.Join(folder, zipPath)); err == nil {
+					return LaunchGenericFile(cfg, filepath.Join(folder, text))
+				}
+			}
+			break
+		}
+	}
+	for _, folder := range games.GetGamesFolders(cfg) {
+		path := filepath.Join(folder, text)
+		if _, err := os.Stat(path); err == nil {
+			return LaunchGenericFile(cfg, path)
+		}
+	}
+	return fmt.Errorf("could not find file: %s", text)
+}
+
+// --------------------------------------------------
+// Built-in commands
+// --------------------------------------------------
+
+func init() {
+	RegisterTokenCommand(TokenCommand{Name: "system", Run: tokenSystem})
+	RegisterTokenCommand(TokenCommand{Name: "launch.system", Run: tokenSystem})
+	RegisterTokenCommand(TokenCommand{Name: "command", Manual: true, Run: tokenShell})
+	RegisterTokenCommand(TokenCommand{Name: "random", Run: tokenRandom})
+	RegisterTokenCommand(TokenCommand{Name: "ini", Run: tokenIni})
+	RegisterTokenCommand(TokenCommand{Name: "get", Run: tokenGet})
+	RegisterTokenCommand(TokenCommand{Name: "key", Run: tokenKey})
+	RegisterTokenCommand(TokenCommand{Name: "coinp1", Run: tokenCoin(6)})
+	RegisterTokenCommand(TokenCommand{Name: "coinp2", Run: tokenCoin(7)})
+	RegisterTokenCommand(TokenCommand{Name: "input", Run: tokenInput})
+	RegisterTokenCommand(TokenCommand{Name: "delay", Run: tokenDelay})
+	RegisterTokenCommand(TokenCommand{Name: "search", Run: tokenSearch})
+	RegisterTokenCommand(TokenCommand{Name: "playlist", Run: tokenPlaylist})
+	RegisterTokenCommand(TokenCommand{Name: "mgl", Run: tokenMgl})
+}
+
+func tokenSystem(env TokenEnv, args TokenArgs) error {
+	if s.EqualFold(args.String(), "menu") {
+		return LaunchMenu()
+	}
+
+	system, err := games.LookupSystem(args.String())
+	if err != nil {
+		return err
+	}
+	return LaunchCore(env.Cfg, *system)
+}
+
+func tokenShell(_ TokenEnv, args TokenArgs) error {
+	command := exec.Command("bash", "-c", args.String())
+	if err := command.Start(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func tokenRandom(env TokenEnv, args TokenArgs) error {
+	name := args.String()
+	if name == "" {
+		return fmt.Errorf("no system specified")
+	}
+	if name == "all" {
+		return LaunchRandomGame(env.Cfg, games.AllSystems())
+	}
+	system, err := games.LookupSystem(name)
+	if err != nil {
+		return err
+	}
+	return LaunchRandomGame(env.Cfg, []games.System{*system})
+}
+
+func tokenIni(_ TokenEnv, args TokenArgs) error {
+	inis, err := GetAllMisterIni()
+	if err != nil {
+		return err
+	}
+	if len(inis) == 0 {
+		return fmt.Errorf("no ini files found")
+	}
+	id, err := strconv.Atoi(args.String())
+	if err != nil {
+		return err
+	}
+	if id < 1 || id > len(inis) {
+		return fmt.Errorf("ini id out of range: %d", id)
+	}
+	return SetActiveIni(id, true)
+}
+
+func tokenGet(_ TokenEnv, args TokenArgs) error {
+	url := args.String()
+	go func() { _, _ = http.Get(url) }()
+	return nil
+}
+
+func tokenKey(env TokenEnv, args TokenArgs) error {
+	if env.Kbd == nil {
+		return fmt.Errorf("no keyboard available")
+	}
+	code, err := strconv.Atoi(args.String())
+	if err != nil {
+		return err
+	}
+	return env.Kbd.Press(code)
+}
+
+func tokenCoin(key int) func(TokenEnv, TokenArgs) error {
+	return func(env TokenEnv, args TokenArgs) error {
+		if env.Kbd == nil {
+			return fmt.Errorf("no keyboard available")
+		}
+		amount, err := strconv.Atoi(args.String())
+		if err != nil {
+			return err
+		}
+		for i := 0; i < amount; i++ {
+			_ = env.Kbd.Press(key)
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil
+	}
+}
+
+// tokenInput presses keys by name, e.g. **input:{up} {up} {enter}. Names
+// without braces work too, as do single characters.
+func tokenInput(env TokenEnv, args TokenArgs) error {
+	if env.Kbd == nil {
+		return fmt.Errorf("no keyboard available")
+	}
+	if len(args.List) == 0 {
+		return fmt.Errorf("no keys specified")
+	}
+
+	var codes []int
+	for _, name := range args.List {
+		code, ok := virtualinput.ToKeyboardCode(name)
+		if !ok && len([]rune(name)) > 1 {
+			code, ok = virtualinput.ToKeyboardCode("{" + s.ToLower(s.Trim(name, "{}")) + "}")
+		}
+		if !ok {
+			return fmt.Errorf("unknown key: %s", name)
+		}
+		codes = append(codes, code)
+	}
+
+	for _, code := range codes {
+		if err := env.Kbd.Press(code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokenDelay waits, in milliseconds or as a duration like 2s.
+func tokenDelay(_ TokenEnv, args TokenArgs) error {
+	d, err := time.ParseDuration(args.String())
+	if err != nil {
+		ms, msErr := strconv.Atoi(args.String())
+		if msErr != nil {
+			return fmt.Errorf("invalid delay: %s", args.String())
+		}
+		d = time.Duration(ms) * time.Millisecond
+	}
+	time.Sleep(d)
+	return nil
+}
+
+// tokenSearch launches the closest match from the games database, which is
+// the shortest name containing every word of the query.
+func tokenSearch(env TokenEnv, args TokenArgs) error {
+	query := s.Join(args.List, " ")
+	results, err := gamesdb.SearchNamesWords(nil, query)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no games found for: %s", query)
+	}
+
+	best := results[0]
+	for _, r := range results[1:] {
+		if len(r.Name) < len(best.Name) {
+			best = r
+		}
+	}
+
+	system, err := games.GetSystem(best.SystemId)
+	if err != nil {
+		return err
+	}
+	return LaunchGame(env.Cfg, *system, best.Path)
+}
+
+// tokenPlaylist runs a random entry from a playlist file, one token or path
+// per line in the same format as the gamelists.
+func tokenPlaylist(env TokenEnv, args TokenArgs) error {
+	if env.inPlaylist {
+		return fmt.Errorf("playlists can't include other playlists")
+	}
+
+	lines, err := utils.ReadLines(args.String())
+	if err != nil {
+		return err
+	}
+
+	var entries []string
+	for _, line := range lines {
+		line = s.TrimSpace(utils.StripTimestamp(line))
+		if line != "" && !s.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("playlist is empty: %s", args.String())
+	}
+
+	env.inPlaylist = true
+	return runTokens(env, entries[rand.Intn(len(entries))])
+}
+
+// tokenMgl launches an MGL given inline, or a path to an .mgl file.
+func tokenMgl(_ TokenEnv, args TokenArgs) error {
+	raw := args.String()
+	if !s.HasPrefix(s.TrimSpace(raw), "<") {
+		return launchFile(raw)
+	}
+
+	mgl, err := ParseMgl([]byte(raw))
+	if err != nil {
+		return err
+	}
+	if mgl.Rbf == "" {
+		return fmt.Errorf("mgl has no rbf")
+	}
+
+	tmpFile, err := writeTempFile(mgl.String())
+	if err != nil {
+		return err
+	}
+	return launchFile(tmpFile)
+}
@@ -0,0 +1,129 @@
+package mister
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTokens(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"**system:SNES", []string{"**system:SNES"}},
+		{"**delay:500 || **input:{enter}", []string{"**delay:500", "**input:{enter}"}},
+		{`**command:"echo a || b" || **delay:1`, []string{`**command:"echo a || b"`, "**delay:1"}},
+		{"a|||b", []string{"a", "|b"}},
+		{"**launch.search:Kirby's Adventure || **delay:1", []string{"**launch.search:Kirby's Adventure", "**delay:1"}},
+	}
+	for _, tt := range tests {
+		if got := splitTokens(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTokens(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"{up} {up}  {enter}", []string{"{up}", "{up}", "{enter}"}, false},
+		{`"Super Mario" World`, []string{"Super Mario", "World"}, false},
+		{"Kirby's Adventure", []string{"Kirby's", "Adventure"}, false},
+		{`"Kirby's Adventure"`, []string{"Kirby's Adventure"}, false},
+		{`a"b c"d`, []string{"ab cd"}, false},
+		{`""`, []string{""}, false},
+		{`"open`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitArgs(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLaunchTokenRegistry(t *testing.T) {
+	var calls []string
+	RegisterTokenCommand(TokenCommand{
+		Name: "test.echo",
+		Run: func(_ TokenEnv, args TokenArgs) error {
+			calls = append(calls, args.String())
+			return nil
+		},
+	})
+	RegisterTokenCommand(TokenCommand{
+		Name:   "test.manual",
+		Manual: true,
+		Run: func(_ TokenEnv, args TokenArgs) error {
+			calls = append(calls, "manual:"+args.String())
+			return nil
+		},
+	})
+
+	if err := LaunchToken(nil, false, nil, `**test.echo:"a b" || **TEST.ECHO: c d `); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a b", "c d"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+
+	calls = nil
+	err := LaunchToken(nil, false, nil, "**test.echo:x || **test.manual:y || **test.echo:z")
+	if err == nil || !strings.Contains(err.Error(), "manually") {
+		t.Errorf("expected manual error, got %v", err)
+	}
+	if !reflect.DeepEqual(calls, []string{"x"}) {
+		t.Errorf("chain didn't stop at the error: %q", calls)
+	}
+
+	calls = nil
+	if err := LaunchToken(nil, true, nil, "**test.manual:y"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(calls, []string{"manual:y"}) {
+		t.Errorf("calls = %q", calls)
+	}
+
+	// an apostrophe isn't a quote
+	calls = nil
+	if err := LaunchToken(nil, false, nil, "**test.echo:Kirby's Adventure"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(calls, []string{"Kirby's Adventure"}) {
+		t.Errorf("calls = %q", calls)
+	}
+
+	if err := LaunchToken(nil, true, nil, "**nope:1"); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
+
+func TestTokenPlaylistNesting(t *testing.T) {
+	dir := t.TempDir()
+	self := filepath.Join(dir, "self.txt")
+
+	for _, entry := range []string{
+		"**playlist:" + self,
+		"**delay:1 || **playlist:" + self,
+	} {
+		if err := os.WriteFile(self, []byte(entry+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := LaunchToken(nil, false, nil, "**playlist:"+self)
+		if err == nil || !strings.Contains(err.Error(), "other playlists") {
+			t.Errorf("%q: expected nesting error, got %v", entry, err)
+		}
+	}
+}
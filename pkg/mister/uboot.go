@@ -54,19 +54,7 @@ func WriteUBootParams(params map[string]string) error {
 
 	content := strings.Join(pairs, "\n") + "\n"
 
-	if _, err := os.Stat(config.UBootConfigFile); err == nil {
-		err = os.Rename(config.UBootConfigFile, config.UBootConfigFile+".backup")
-		if err != nil {
-			return err
-		}
-	}
-
-	err := os.WriteFile(config.UBootConfigFile, []byte(content), 0644)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return SafeWriteFile(config.UBootConfigFile, []byte(content))
 }
 
 func parseKernelArgs(input string) map[string]string {
@@ -1,11 +1,5 @@
 package mister
 
-import (
-	"fmt"
-	"github.com/synrais/SAM-GO/pkg/config"
-	"os"
-)
-
 const (
 	VideoModeScaleFull    = "1"
 	VideoModeScaleHalf    = "2"
@@ -28,32 +22,5 @@ const (
 // then polls until it's the same value (up to 5 times)
 
 func SetVideoMode(width int, height int) error {
-	if _, err := os.Stat(config.CmdInterface); err != nil {
-		return fmt.Errorf("command interface not accessible: %s", err)
-	}
-
-	cmd, err := os.OpenFile(config.CmdInterface, os.O_RDWR, 0)
-	if err != nil {
-		return err
-	}
-	defer func(cmd *os.File) {
-		_ = cmd.Close()
-	}(cmd)
-
-	cmdStr := fmt.Sprintf(
-		"%s %d %d %d",
-		VideoModeFormatRGB32[1:],
-		VideoModeFormatRGB32[0],
-		width,
-		height,
-	)
-
-	fmt.Println(cmdStr)
-
-	_, err = cmd.WriteString(cmdStr)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return GetCommander().SetVideoMode(width, height)
 }
@@ -0,0 +1,75 @@
+package nfc
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	s "strings"
+)
+
+// Database maps tag UIDs to tokens, so any tag can be used for a game
+// without writing to it. It's loaded from config.NfcDatabaseFile, a CSV file
+// with a "uid,text" header:
+//
+//	uid,text
+//	04:a1:b2:c3:d4:e5:80,**system:SNES
+//	04a1b2c3d4e581,SNES/Super Metroid.sfc
+//
+// Lines starting with # are ignored.
+type Database map[string]string
+
+// LoadDatabase reads a mappings file. A missing file is an empty database.
+func LoadDatabase(path string) (Database, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return Database{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	db := Database{}
+	header := true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read nfc database: %w", err)
+		}
+
+		if header {
+			header = false
+			if len(record) > 0 && s.EqualFold(s.TrimSpace(record[0]), "uid") {
+				continue
+			}
+		}
+		if len(record) < 2 {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("nfc database line %d: expected uid,text", line)
+		}
+
+		uid := NormalizeUID(s.TrimSpace(record[0]))
+		if uid == "" {
+			continue
+		}
+		db[uid] = s.TrimSpace(record[1])
+	}
+
+	return db, nil
+}
+
+// Resolve returns the token for a tag, the mapping for its UID if there is
+// one, otherwise the text stored on it.
+func (db Database) Resolve(tag Tag) string {
+	if text, ok := db[NormalizeUID(tag.UID)]; ok {
+		return text
+	}
+	return tag.Text
+}
@@ -0,0 +1,89 @@
+//go:build libnfc
+
+package nfc
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/clausecker/nfc/v2"
+)
+
+// NTAG/Ultralight READ, returns 4 pages
+const type2ReadCmd = 0x30
+
+var iso14443a = nfc.Modulation{Type: nfc.ISO14443a, BaudRate: nfc.Nbr106}
+
+// libnfcReader reads type 2 tags through libnfc, which supports the PN532
+// over serial and I2C and the ACR122U over PC/SC.
+type libnfcReader struct {
+	dev nfc.Device
+}
+
+func openLibnfc(conn string, probe bool) (Reader, error) {
+	if conn == "" && probe {
+		devices, err := nfc.ListDevices()
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("no nfc reader found")
+		}
+		conn = devices[0]
+	}
+
+	dev, err := nfc.Open(conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := dev.InitiatorInit(); err != nil {
+		dev.Close()
+		return nil, err
+	}
+	logger.Info("opened reader: %s %s", dev.String(), dev.Connection())
+
+	return &libnfcReader{dev: dev}, nil
+}
+
+func (r *libnfcReader) Read() (*Tag, error) {
+	targets, err := r.dev.InitiatorListPassiveTargets(iso14443a)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	target, ok := targets[0].(*nfc.ISO14443aTarget)
+	if !ok {
+		return nil, nil
+	}
+	uid := target.UID[:target.UIDLen]
+	tag := &Tag{UID: hex.EncodeToString(uid)}
+
+	if _, err := r.dev.InitiatorSelectPassiveTarget(iso14443a, uid); err != nil {
+		return nil, err
+	}
+
+	msg, err := readType2Ndef(func(page int) ([]byte, error) {
+		rx := make([]byte, 16)
+		n, err := r.dev.InitiatorTransceiveBytes([]byte{type2ReadCmd, byte(page)}, rx, 0)
+		if err != nil {
+			return nil, err
+		}
+		return rx[:n], nil
+	})
+	if err != nil {
+		// blank or unsupported tags can still be mapped by UID
+		logger.Warn("no text on tag %s: %v", tag.UID, err)
+		return tag, nil
+	}
+
+	if text, err := ParseNdefText(msg); err == nil {
+		tag.Text = text
+	}
+	return tag, nil
+}
+
+func (r *libnfcReader) Close() error {
+	return r.dev.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !libnfc
+
+package nfc
+
+import "fmt"
+
+// Hardware readers need libnfc, which is only linked in when building with
+// -tags libnfc.
+func openLibnfc(_ string, _ bool) (Reader, error) {
+	return nil, fmt.Errorf("built without libnfc support, rebuild with -tags libnfc")
+}
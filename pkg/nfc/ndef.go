@@ -0,0 +1,207 @@
+package nfc
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Type 2 tags (NTAG and MIFARE Ultralight) keep their user data from page 4,
+// as a list of TLV blocks. The NDEF message is in the block with type 0x03.
+const (
+	type2FirstPage = 4
+	type2MaxBytes  = 888 // NTAG216
+
+	tlvNull       = 0x00
+	tlvNdef       = 0x03
+	tlvTerminator = 0xFE
+)
+
+var ErrNoNdef = errors.New("no ndef message on tag")
+
+// uriPrefixes is the URI record prefix table from the NFC Forum URI RTD.
+var uriPrefixes = []string{
+	"", "http://www.", "https://www.", "http://", "https://", "tel:",
+	"mailto:", "ftp://anonymous:anonymous@", "ftp://ftp.", "ftps://",
+	"sftp://", "smb://", "nfs://", "ftp://", "dav://", "news:",
+	"telnet://", "imap:", "rtsp://", "urn:", "pop:", "sip:", "sips:",
+	"tftp:", "btspp://", "btl2cap://", "btgoep://", "tcpobex://",
+	"irdaobex://", "file://", "urn:epc:id:", "urn:epc:tag:",
+	"urn:epc:pat:", "urn:epc:raw:", "urn:epc:", "urn:nfc:",
+}
+
+// findNdefMessage looks for the NDEF TLV in tag data. complete is false if
+// the data ends before the message does, so more needs to be read.
+func findNdefMessage(data []byte) (msg []byte, complete bool, err error) {
+	i := 0
+	for i < len(data) {
+		t := data[i]
+		i++
+
+		switch t {
+		case tlvNull:
+			continue
+		case tlvTerminator:
+			return nil, true, ErrNoNdef
+		}
+
+		if i >= len(data) {
+			return nil, false, nil
+		}
+		length := int(data[i])
+		i++
+		if length == 0xFF {
+			if i+2 > len(data) {
+				return nil, false, nil
+			}
+			length = int(data[i])<<8 | int(data[i+1])
+			i += 2
+		}
+
+		if i+length > len(data) {
+			return nil, false, nil
+		}
+		if t == tlvNdef {
+			return data[i : i+length], true, nil
+		}
+		i += length
+	}
+	return nil, false, nil
+}
+
+// readType2Ndef reads the NDEF message from a type 2 tag. readPages is given
+// a page number and returns the data from that page on, usually 16 bytes.
+func readType2Ndef(readPages func(page int) ([]byte, error)) ([]byte, error) {
+	var data []byte
+	page := type2FirstPage
+
+	for len(data) < type2MaxBytes {
+		buf, err := readPages(page)
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) < 4 {
+			return nil, fmt.Errorf("short read at page %d", page)
+		}
+		data = append(data, buf...)
+		page += len(buf) / 4
+
+		msg, complete, err := findNdefMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		if complete {
+			return msg, nil
+		}
+	}
+	return nil, ErrNoNdef
+}
+
+// ParseNdefText returns the first text or URI record of an NDEF message.
+func ParseNdefText(msg []byte) (string, error) {
+	i := 0
+	for i < len(msg) {
+		header := msg[i]
+		i++
+		tnf := header & 0x07
+		shortRecord := header&0x10 != 0
+		hasId := header&0x08 != 0
+
+		if i >= len(msg) {
+			break
+		}
+		typeLen := int(msg[i])
+		i++
+
+		var payloadLen int
+		if shortRecord {
+			if i >= len(msg) {
+				break
+			}
+			payloadLen = int(msg[i])
+			i++
+		} else {
+			if i+4 > len(msg) {
+				break
+			}
+			payloadLen = int(msg[i])<<24 | int(msg[i+1])<<16 | int(msg[i+2])<<8 | int(msg[i+3])
+			i += 4
+		}
+
+		idLen := 0
+		if hasId {
+			if i >= len(msg) {
+				break
+			}
+			idLen = int(msg[i])
+			i++
+		}
+
+		if i+typeLen+idLen+payloadLen > len(msg) {
+			break
+		}
+		recordType := string(msg[i : i+typeLen])
+		i += typeLen + idLen
+		payload := msg[i : i+payloadLen]
+		i += payloadLen
+
+		// only well known types
+		if tnf != 0x01 {
+			continue
+		}
+		switch recordType {
+		case "T":
+			return parseTextPayload(payload)
+		case "U":
+			return parseUriPayload(payload)
+		}
+	}
+	return "", ErrNoNdef
+}
+
+func parseTextPayload(payload []byte) (string, error) {
+	if len(payload) == 0 {
+		return "", fmt.Errorf("empty text record")
+	}
+	status := payload[0]
+	langLen := int(status & 0x3F)
+	if 1+langLen > len(payload) {
+		return "", fmt.Errorf("invalid text record")
+	}
+	text := payload[1+langLen:]
+
+	if status&0x80 == 0 {
+		return string(text), nil
+	}
+
+	// UTF-16, big endian unless there's a byte order mark saying otherwise
+	bigEndian := true
+	if len(text) >= 2 {
+		if text[0] == 0xFF && text[1] == 0xFE {
+			bigEndian = false
+			text = text[2:]
+		} else if text[0] == 0xFE && text[1] == 0xFF {
+			text = text[2:]
+		}
+	}
+	units := make([]uint16, len(text)/2)
+	for j := range units {
+		if bigEndian {
+			units[j] = uint16(text[2*j])<<8 | uint16(text[2*j+1])
+		} else {
+			units[j] = uint16(text[2*j+1])<<8 | uint16(text[2*j])
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func parseUriPayload(payload []byte) (string, error) {
+	if len(payload) == 0 {
+		return "", fmt.Errorf("empty uri record")
+	}
+	prefix := ""
+	if int(payload[0]) < len(uriPrefixes) {
+		prefix = uriPrefixes[payload[0]]
+	}
+	return prefix + string(payload[1:]), nil
+}
@@ -0,0 +1,83 @@
+package nfc
+
+import (
+	"errors"
+	"testing"
+)
+
+// textRecord builds a short, single NDEF text record.
+func textRecord(lang, text string) []byte {
+	payload := append([]byte{byte(len(lang))}, lang...)
+	payload = append(payload, text...)
+	return append([]byte{0xD1, 0x01, byte(len(payload)), 'T'}, payload...)
+}
+
+func TestParseNdefText(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    string
+		wantErr bool
+	}{
+		{"text", textRecord("en", "**system:SNES"), "**system:SNES", false},
+		{"uri", []byte{0xD1, 0x01, 0x0B, 'U', 0x04, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o'}, "https://example.co", false},
+		{"utf16", []byte{0xD1, 0x01, 0x06, 'T', 0x80 | 0x01, 'x', 0x00, 'h', 0x00, 'i'}, "hi", false},
+		{"mime only", []byte{0xD2, 0x03, 0x01, 'a', '/', 'b', 'x'}, "", true},
+		{"truncated", []byte{0xD1, 0x01, 0x20, 'T', 0x02}, "", true},
+		{"empty", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNdefText(tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadType2Ndef(t *testing.T) {
+	record := textRecord("en", "SNES/Super Metroid.sfc")
+	// lock control TLV, then the message, then a terminator
+	memory := append([]byte{0x01, 0x03, 0xA0, 0x0C, 0x34, 0x03, byte(len(record))}, record...)
+	memory = append(memory, 0xFE)
+
+	reads := 0
+	readPages := func(page int) ([]byte, error) {
+		reads++
+		start := (page - type2FirstPage) * 4
+		buf := make([]byte, 16)
+		if start < len(memory) {
+			copy(buf, memory[start:])
+		}
+		return buf, nil
+	}
+
+	msg, err := readType2Ndef(readPages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := ParseNdefText(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "SNES/Super Metroid.sfc" {
+		t.Errorf("got %q", text)
+	}
+	if want := (len(memory) + 15) / 16; reads != want {
+		t.Errorf("read %d times, want %d", reads, want)
+	}
+
+	blank := func(int) ([]byte, error) { return []byte{0x03, 0x00, 0xFE, 0, 0, 0, 0, 0}, nil }
+	if msg, err := readType2Ndef(blank); err != nil || len(msg) != 0 {
+		t.Errorf("blank tag = %v, %v", msg, err)
+	}
+
+	empty := func(int) ([]byte, error) { return []byte{0xFE, 0, 0, 0}, nil }
+	if _, err := readType2Ndef(empty); !errors.Is(err, ErrNoNdef) {
+		t.Errorf("expected ErrNoNdef, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package nfc
+
+import (
+	"errors"
+	"fmt"
+	s "strings"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+// Tag is a card read from an NFC reader. Text is the first text or URI
+// record of its NDEF message, empty if it had none.
+type Tag struct {
+	UID  string
+	Text string
+}
+
+// Reader is an NFC reader backend.
+type Reader interface {
+	// Read returns the tag currently on the reader, or nil if there isn't one.
+	Read() (*Tag, error)
+	Close() error
+}
+
+var ErrNoReader = errors.New("no nfc reader configured")
+
+// Configured reports whether the [nfc] config sets up a reader at all.
+func Configured(cfg config.NfcConfig) bool {
+	return s.TrimSpace(cfg.ConnectionString) != "" || cfg.ProbeDevice
+}
+
+// OpenReader opens the reader from the [nfc] config. The connection string
+// is passed to libnfc, e.g.:
+//
+//	pn532_uart:/dev/ttyUSB0
+//	pn532_i2c:/dev/i2c-1
+//	acr122_pcsc
+//
+// "sim:<file>" opens a simulated reader instead, see SimReader. With no
+// connection string a reader is only searched for when probe_device is set.
+func OpenReader(cfg config.NfcConfig) (Reader, error) {
+	conn := s.TrimSpace(cfg.ConnectionString)
+
+	if conn == "sim" || s.HasPrefix(conn, "sim:") {
+		return NewSimReader(s.TrimPrefix(s.TrimPrefix(conn, "sim"), ":")), nil
+	}
+	if !Configured(cfg) {
+		return nil, ErrNoReader
+	}
+
+	reader, err := openLibnfc(conn, cfg.ProbeDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nfc reader: %w", err)
+	}
+	return reader, nil
+}
+
+// NormalizeUID lowercases a UID and removes any separators, so UIDs copied
+// from other tools match the ones read here.
+func NormalizeUID(uid string) string {
+	uid = s.ToLower(uid)
+	return s.NewReplacer(":", "", "-", "", " ", "").Replace(uid)
+}
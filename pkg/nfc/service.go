@@ -0,0 +1,165 @@
+package nfc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/input/virtualinput"
+	"github.com/synrais/SAM-GO/pkg/mister"
+	"github.com/synrais/SAM-GO/pkg/service"
+)
+
+var logger = service.Component("nfc")
+
+// ErrReaderFailed is returned by Poll when the reader couldn't be read, e.g.
+// because it was unplugged.
+var ErrReaderFailed = errors.New("failed to read nfc reader")
+
+// maxRetryDelay is the longest Run waits between attempts to reopen a reader.
+const maxRetryDelay = 30 * time.Second
+
+// Service polls a reader and launches each new tag put on it. A tag is only
+// launched once, it has to be removed and put back to launch it again.
+type Service struct {
+	// Reader is opened with Open when it's nil, or after it fails.
+	Reader       Reader
+	Cfg          *config.UserConfig
+	Kbd          *virtualinput.Keyboard
+	DatabaseFile string
+	LastScanFile string
+	Interval     time.Duration
+	// RetryDelay is the first wait before reopening a reader, doubled after
+	// each failure up to maxRetryDelay.
+	RetryDelay time.Duration
+	// Open opens the reader, OpenReader with the [nfc] config unless
+	// replaced.
+	Open func() (Reader, error)
+	// Launch runs a tag's token, mister.LaunchToken unless replaced.
+	Launch func(text string) error
+
+	lastUID string
+}
+
+func NewService(cfg *config.UserConfig, reader Reader, kbd *virtualinput.Keyboard) *Service {
+	svc := &Service{
+		Reader:       reader,
+		Cfg:          cfg,
+		Kbd:          kbd,
+		DatabaseFile: config.NfcDatabaseFile,
+		LastScanFile: config.NfcLastScanFile,
+		Interval:     250 * time.Millisecond,
+		RetryDelay:   time.Second,
+	}
+	svc.Open = func() (Reader, error) {
+		return OpenReader(svc.Cfg.Nfc)
+	}
+	svc.Launch = func(text string) error {
+		return mister.LaunchToken(svc.Cfg, svc.Cfg.Nfc.AllowCommands, svc.Kbd, text)
+	}
+	return svc
+}
+
+// Poll reads the reader once and launches the tag if it's new.
+func (svc *Service) Poll() error {
+	tag, err := svc.Reader.Read()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrReaderFailed, err)
+	}
+	if tag == nil {
+		svc.lastUID = ""
+		return nil
+	}
+	if tag.UID == svc.lastUID {
+		return nil
+	}
+	svc.lastUID = tag.UID
+
+	db, err := LoadDatabase(svc.DatabaseFile)
+	if err != nil {
+		logger.Error("%s", err)
+		db = Database{}
+	}
+	text := db.Resolve(*tag)
+
+	logger.Info("scanned %s: %s", tag.UID, text)
+	if err := svc.writeLastScan(tag.UID, text); err != nil {
+		logger.Error("failed to write last scan: %s", err)
+	}
+
+	if text == "" {
+		return fmt.Errorf("tag %s has no text or mapping", tag.UID)
+	}
+	if err := svc.Launch(text); err != nil {
+		return fmt.Errorf("failed to launch tag %s: %w", tag.UID, err)
+	}
+	return nil
+}
+
+// writeLastScan records the last tag as a "uid,text" line for other tools,
+// e.g. to find the UID of a new tag to map.
+func (svc *Service) writeLastScan(uid, text string) error {
+	if svc.LastScanFile == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{uid, text}); err != nil {
+		return err
+	}
+	w.Flush()
+	return os.WriteFile(svc.LastScanFile, buf.Bytes(), 0644)
+}
+
+// Run polls the reader until stop is closed. Launch errors are reported but
+// don't stop the service, and a reader which can't be opened or stops
+// working is closed and opened again, waiting longer after each failure.
+func (svc *Service) Run(stop <-chan struct{}) error {
+	retry := svc.RetryDelay
+	for {
+		wait := svc.Interval
+
+		if svc.Reader == nil {
+			reader, err := svc.Open()
+			if err != nil {
+				logger.Warn("%s, trying again in %s", err, retry)
+				wait, retry = retry, nextRetry(retry)
+			} else {
+				logger.Info("nfc reader opened")
+				svc.Reader, svc.lastUID = reader, ""
+				retry = svc.RetryDelay
+			}
+		}
+
+		if svc.Reader != nil {
+			if err := svc.Poll(); errors.Is(err, ErrReaderFailed) {
+				logger.Warn("%s, reopening it in %s", err, retry)
+				_ = svc.Reader.Close()
+				svc.Reader = nil
+				wait, retry = retry, nextRetry(retry)
+			} else if err != nil {
+				logger.Error("%s", err)
+			}
+		}
+
+		select {
+		case <-stop:
+			if svc.Reader == nil {
+				return nil
+			}
+			return svc.Reader.Close()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func nextRetry(d time.Duration) time.Duration {
+	if d *= 2; d > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return d
+}
@@ -0,0 +1,166 @@
+package nfc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+func TestLoadDatabase(t *testing.T) {
+	db, err := LoadDatabase("testdata/nfc.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Database{
+		"04a1b2c3d4e580": "**system:SNES",
+		"04a1b2c3d4e581": "SNES/Super Metroid.sfc",
+		"04a1b2c3d4e582": "**input:{up} {up} || **delay:500",
+	}
+	if !reflect.DeepEqual(db, want) {
+		t.Errorf("got %q, want %q", db, want)
+	}
+
+	db, err = LoadDatabase("testdata/missing.csv")
+	if err != nil || len(db) != 0 {
+		t.Errorf("missing file = %v, %v", db, err)
+	}
+}
+
+func newTestService(t *testing.T) (*Service, *SimReader, *[]string) {
+	reader := NewSimReader("")
+	var launched []string
+	svc := NewService(&config.UserConfig{}, reader, nil)
+	svc.DatabaseFile = "testdata/nfc.csv"
+	svc.LastScanFile = filepath.Join(t.TempDir(), "NFCSCAN")
+	svc.Launch = func(text string) error {
+		launched = append(launched, text)
+		return nil
+	}
+	return svc, reader, &launched
+}
+
+func TestServicePoll(t *testing.T) {
+	svc, reader, launched := newTestService(t)
+
+	poll := func() {
+		t.Helper()
+		if err := svc.Poll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	poll()
+	reader.Place(Tag{UID: "aabbccdd", Text: "NES/Zelda.nes"})
+	poll()
+	poll() // still on the reader, not launched again
+	reader.Remove()
+	poll()
+	reader.Place(Tag{UID: "aabbccdd", Text: "NES/Zelda.nes"})
+	poll()
+	// mapped UIDs win over the tag's text
+	reader.Place(Tag{UID: "04a1b2c3d4e580", Text: "NES/Zelda.nes"})
+	poll()
+
+	want := []string{"NES/Zelda.nes", "NES/Zelda.nes", "**system:SNES"}
+	if !reflect.DeepEqual(*launched, want) {
+		t.Errorf("launched %q, want %q", *launched, want)
+	}
+
+	data, err := os.ReadFile(svc.LastScanFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "04a1b2c3d4e580,**system:SNES\n" {
+		t.Errorf("last scan = %q", got)
+	}
+}
+
+func TestServiceBlankTag(t *testing.T) {
+	svc, reader, launched := newTestService(t)
+
+	reader.Place(Tag{UID: "01020304"})
+	if err := svc.Poll(); err == nil {
+		t.Error("expected error for blank unmapped tag")
+	}
+	if len(*launched) != 0 {
+		t.Errorf("launched %q", *launched)
+	}
+}
+
+func TestSimReaderFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tag")
+	reader, err := OpenReader(config.NfcConfig{ConnectionString: "sim:" + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag, err := reader.Read(); tag != nil || err != nil {
+		t.Fatalf("no file = %v, %v", tag, err)
+	}
+	if err := os.WriteFile(path, []byte("04:AA:BB,\"**input:a,b\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Tag{UID: "04aabb", Text: "**input:a,b"}); tag == nil || *tag != want {
+		t.Errorf("got %+v, want %+v", tag, want)
+	}
+}
+
+// brokenReader is a reader which has been unplugged.
+type brokenReader struct{}
+
+func (brokenReader) Read() (*Tag, error) { return nil, errors.New("device gone") }
+func (brokenReader) Close() error        { return nil }
+
+func TestServiceReopensReader(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	svc.Reader = brokenReader{}
+	svc.Interval = time.Millisecond
+	svc.RetryDelay = time.Millisecond
+
+	// the reader fails, then can't be opened for a while, then comes back
+	// with a tag on it
+	opens := 0
+	svc.Open = func() (Reader, error) {
+		opens++
+		if opens < 3 {
+			return nil, errors.New("no such device")
+		}
+		reader := NewSimReader("")
+		reader.Place(Tag{UID: "aabbccdd", Text: "NES/Zelda.nes"})
+		return reader, nil
+	}
+
+	stop := make(chan struct{})
+	launched := make(chan string, 1)
+	svc.Launch = func(text string) error {
+		launched <- text
+		return nil
+	}
+	done := make(chan error)
+	go func() { done <- svc.Run(stop) }()
+
+	select {
+	case text := <-launched:
+		if text != "NES/Zelda.nes" {
+			t.Errorf("launched %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tag wasn't launched after the reader came back")
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if opens != 3 {
+		t.Errorf("opened the reader %d times, want 3", opens)
+	}
+}
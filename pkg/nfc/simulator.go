@@ -0,0 +1,88 @@
+package nfc
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	s "strings"
+	"sync"
+)
+
+// SimReader is a reader without hardware. Tags are placed and removed with
+// Place and Remove, or if Path is set, by writing a tag to that file as a
+// "uid,text" line and deleting it again:
+//
+//	echo '04a1b2c3,**system:SNES' > /tmp/nfc_sim
+type SimReader struct {
+	Path string
+
+	mu     sync.Mutex
+	tag    *Tag
+	closed bool
+}
+
+func NewSimReader(path string) *SimReader {
+	return &SimReader{Path: path}
+}
+
+// Place puts a tag on the reader, replacing any already there.
+func (r *SimReader) Place(tag Tag) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tag = &tag
+}
+
+// Remove takes the tag off the reader.
+func (r *SimReader) Remove() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tag = nil
+}
+
+func (r *SimReader) Read() (*Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, fmt.Errorf("reader is closed")
+	}
+	if r.Path != "" {
+		return readSimFile(r.Path)
+	}
+	if r.tag == nil {
+		return nil, nil
+	}
+	tag := *r.tag
+	return &tag, nil
+}
+
+func (r *SimReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func readSimFile(path string) (*Tag, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	line := s.TrimSpace(string(data))
+	if line == "" {
+		return nil, nil
+	}
+	fields, err := csv.NewReader(s.NewReader(line)).Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid simulated tag: %w", err)
+	}
+
+	tag := &Tag{UID: NormalizeUID(fields[0])}
+	if len(fields) > 1 {
+		tag.Text = s.Join(fields[1:], ",")
+	}
+	return tag, nil
+}
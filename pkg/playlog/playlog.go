@@ -0,0 +1,289 @@
+// Package playlog keeps a log of what's been played on the MiSTer: how many
+// times and for how long each game has been played, whether it was started
+// by SAM or from the OSD. It follows the files MiSTer writes to /tmp when a
+// core or game is loaded, and can run a command when either changes.
+package playlog
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+	"github.com/synrais/SAM-GO/pkg/service"
+)
+
+var logger = service.Component("playlog")
+
+// defaultSaveEvery is how often, in minutes, the log is saved while a game
+// is running if save_every isn't set. The log is also saved whenever a game
+// stops.
+const defaultSaveEvery = 5
+
+// Entry is the play history of one game.
+type Entry struct {
+	Path       string
+	Core       string
+	Plays      int
+	Playtime   time.Duration
+	LastPlayed time.Time
+}
+
+// Load reads a saved play log. A missing file is an empty log.
+func Load(path string) (map[string]*Entry, error) {
+	entries := make(map[string]*Entry)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []Entry
+	if err := gob.NewDecoder(f).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to read play log: %w", err)
+	}
+	for i := range list {
+		entries[list[i].Path] = &list[i]
+	}
+	return entries, nil
+}
+
+// Tracker follows the running core and game and records them in the log.
+// The file paths are fields so tests can point them at a fake tree.
+type Tracker struct {
+	CoreNameFile    string
+	CurrentPathFile string
+	FullPathFile    string
+	DbFile          string
+	Interval        time.Duration
+
+	cfg      config.PlayLogConfig
+	mu       sync.Mutex
+	entries  map[string]*Entry
+	core     string
+	game     string
+	started  time.Time
+	counted  time.Time // playtime is added up to here
+	lastSave time.Time
+	dirty    bool
+}
+
+func NewTracker(cfg config.PlayLogConfig) *Tracker {
+	return &Tracker{
+		CoreNameFile:    config.CoreNameFile,
+		CurrentPathFile: config.CurrentPathFile,
+		FullPathFile:    config.FullPathFile,
+		DbFile:          config.PlayLogDbFile,
+		Interval:        time.Second,
+		cfg:             cfg,
+	}
+}
+
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// currentGame returns the loaded game as best MiSTer reports it: the folder
+// in FULLPATH joined with the file name in CURRENTPATH.
+func (t *Tracker) currentGame() string {
+	name := readTrimmed(t.CurrentPathFile)
+	if name == "" {
+		return ""
+	}
+	if dir := readTrimmed(t.FullPathFile); dir != "" && !strings.HasPrefix(name, "/") {
+		return filepath.Join(dir, name)
+	}
+	return name
+}
+
+// runHook starts a user command from [playlog], with the core and game in
+// the environment. It isn't waited for.
+func runHook(command string, core string, game string) {
+	if command == "" {
+		return
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "SAM_CORE="+core, "SAM_GAME="+game)
+	if err := cmd.Start(); err != nil {
+		logger.Error("hook failed: %s", err)
+		return
+	}
+	go func() { _ = cmd.Wait() }()
+}
+
+// addPlaytime counts the time since the last count towards the current game.
+func (t *Tracker) addPlaytime(now time.Time) {
+	if t.game == "" {
+		return
+	}
+	if e, ok := t.entries[t.game]; ok && now.After(t.counted) {
+		e.Playtime += now.Sub(t.counted)
+		t.dirty = true
+	}
+	t.counted = now
+}
+
+// stopGame ends the current game, returning false if there wasn't one.
+func (t *Tracker) stopGame(now time.Time) bool {
+	if t.game == "" {
+		return false
+	}
+	t.addPlaytime(now)
+	runHook(t.cfg.OnGameStop, t.core, t.game)
+	t.game = ""
+	return true
+}
+
+// Poll checks the running core and game once, recording any change.
+func (t *Tracker) Poll(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.entries == nil {
+		entries, err := Load(t.DbFile)
+		if err != nil {
+			logger.Warn("starting a new log: %s", err)
+			entries = make(map[string]*Entry)
+		}
+		t.entries = entries
+		t.lastSave = now
+	}
+
+	core := readTrimmed(t.CoreNameFile)
+	game := ""
+	if core != "" && core != config.MenuCore {
+		game = t.currentGame()
+	}
+
+	stopped := false
+	if core != t.core {
+		stopped = t.stopGame(now)
+		if t.core != "" && t.core != config.MenuCore {
+			runHook(t.cfg.OnCoreStop, t.core, "")
+		}
+		t.core = core
+		if core != "" && core != config.MenuCore {
+			runHook(t.cfg.OnCoreStart, core, "")
+		}
+	}
+
+	if game != t.game {
+		stopped = t.stopGame(now) || stopped
+		if game != "" {
+			e, ok := t.entries[game]
+			if !ok {
+				e = &Entry{Path: game}
+				t.entries[game] = e
+			}
+			e.Core = core
+			e.Plays++
+			e.LastPlayed = now
+			t.game, t.started, t.counted = game, now, now
+			t.dirty = true
+			runHook(t.cfg.OnGameStart, core, game)
+		}
+	} else {
+		t.addPlaytime(now)
+	}
+
+	saveEvery := t.cfg.SaveEvery
+	if saveEvery <= 0 {
+		saveEvery = defaultSaveEvery
+	}
+	// save at the end of a game, and every so often during one
+	if t.dirty && (stopped || now.Sub(t.lastSave) >= time.Duration(saveEvery)*time.Minute) {
+		if err := t.save(); err != nil {
+			logger.Error("failed to save: %s", err)
+		}
+		t.lastSave = now
+	}
+}
+
+// Current returns the running core and game as of the last poll, and when
+// the game started.
+func (t *Tracker) Current() (core string, game string, started time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.core, t.game, t.started
+}
+
+// SetConfig replaces the [playlog] settings, for when SAM.ini is reloaded.
+func (t *Tracker) SetConfig(cfg config.PlayLogConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg = cfg
+}
+
+// Entries returns the log, most recently played first.
+func (t *Tracker) Entries() []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]Entry, 0, len(t.entries))
+	for _, e := range t.entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastPlayed.After(list[j].LastPlayed)
+	})
+	return list
+}
+
+func (t *Tracker) save() error {
+	list := make([]Entry, 0, len(t.entries))
+	for _, e := range t.entries {
+		list = append(list, *e)
+	}
+
+	tmp := t.DbFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(list); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.DbFile); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// Run polls until stop is closed, then saves the log.
+func (t *Tracker) Run(stop <-chan struct{}) error {
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.addPlaytime(time.Now())
+			if !t.dirty {
+				return nil
+			}
+			return t.save()
+		case now := <-ticker.C:
+			t.Poll(now)
+		}
+	}
+}
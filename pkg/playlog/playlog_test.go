@@ -0,0 +1,79 @@
+package playlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+type fakeMister struct {
+	t   *testing.T
+	dir string
+}
+
+func (m fakeMister) set(core string, folder string, name string) {
+	m.t.Helper()
+	for file, value := range map[string]string{
+		"CORENAME":    core,
+		"FULLPATH":    folder,
+		"CURRENTPATH": name,
+	} {
+		if err := os.WriteFile(filepath.Join(m.dir, file), []byte(value+"\n"), 0644); err != nil {
+			m.t.Fatal(err)
+		}
+	}
+}
+
+func newTestTracker(t *testing.T) (*Tracker, fakeMister) {
+	dir := t.TempDir()
+	tr := NewTracker(config.PlayLogConfig{})
+	tr.CoreNameFile = filepath.Join(dir, "CORENAME")
+	tr.CurrentPathFile = filepath.Join(dir, "CURRENTPATH")
+	tr.FullPathFile = filepath.Join(dir, "FULLPATH")
+	tr.DbFile = filepath.Join(dir, "playlog.db")
+	return tr, fakeMister{t: t, dir: dir}
+}
+
+func TestTracker(t *testing.T) {
+	tr, m := newTestTracker(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	m.set("MENU", "", "")
+	tr.Poll(start)
+
+	m.set("SNES", "games/SNES", "Mario.sfc")
+	tr.Poll(start.Add(time.Second))
+	tr.Poll(start.Add(61 * time.Second))
+
+	// back to the menu ends the game and saves
+	m.set("MENU", "", "")
+	tr.Poll(start.Add(91 * time.Second))
+
+	m.set("SNES", "games/SNES", "Mario.sfc")
+	tr.Poll(start.Add(100 * time.Second))
+	m.set("SNES", "games/SNES", "Zelda.sfc")
+	tr.Poll(start.Add(110 * time.Second))
+
+	entries := tr.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Path != "games/SNES/Zelda.sfc" {
+		t.Errorf("most recent = %s", entries[0].Path)
+	}
+	mario := entries[1]
+	if mario.Plays != 2 || mario.Playtime != 100*time.Second || mario.Core != "SNES" {
+		t.Errorf("mario = %+v", mario)
+	}
+
+	saved, err := Load(tr.DbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := saved["games/SNES/Mario.sfc"]; e == nil || e.Plays != 2 {
+		t.Errorf("saved mario = %+v", e)
+	}
+}
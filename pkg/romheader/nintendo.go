@@ -0,0 +1,310 @@
+package romheader
+
+// --------------------------------------------------
+// NES
+// --------------------------------------------------
+
+var nesRegions = []string{"NTSC", "PAL", "Multiple", "Dendy"}
+
+func parseNES(data []byte, size int64) (*Header, bool) {
+	if !hasAt(data, 0, []byte("NES\x1a")) || len(data) < 16 {
+		return nil, false
+	}
+
+	flags6, flags7 := data[6], data[7]
+	hdr := &Header{
+		Format:   "iNES",
+		SystemId: "NES",
+		Mapper:   int(flags6>>4) | int(flags7&0xF0),
+		Region:   "NTSC",
+	}
+
+	if flags7&0x0C == 0x08 {
+		hdr.Format = "NES 2.0"
+		hdr.Mapper |= int(data[8]&0x0F) << 8
+		hdr.Region = nesRegions[data[12]&0x03]
+	} else if data[9]&0x01 != 0 {
+		hdr.Region = "PAL"
+	}
+
+	// no checksum in the header, use the CRC32 of everything after it like
+	// ROM databases do
+	skip := 16
+	if flags6&0x04 != 0 {
+		skip += 512 // trainer
+	}
+	hdr.Checksum = crc(data, size, skip)
+
+	return hdr, true
+}
+
+// parseFDS reads Famicom Disk System images, either with the fwNES header
+// or a raw dump starting with the disk info block.
+func parseFDS(data []byte, size int64) (*Header, bool) {
+	skip := 0
+	if hasAt(data, 0, []byte("FDS\x1a")) {
+		skip = 16
+	}
+	if !hasAt(data, skip+1, []byte("*NINTENDO-HVC*")) || len(data) < skip+0x14 {
+		return nil, false
+	}
+
+	return &Header{
+		Format:   "FDS",
+		SystemId: "FDS",
+		// the disk info block only has a 3 letter game code
+		Title:    text(data[skip+0x10 : skip+0x13]),
+		Region:   "Japan",
+		Checksum: crc(data, size, skip),
+	}, true
+}
+
+// parseNSF reads NES Sound Format music files.
+func parseNSF(data []byte, size int64) (*Header, bool) {
+	if !hasAt(data, 0, []byte("NESM\x1a")) || len(data) < 0x80 {
+		return nil, false
+	}
+
+	hdr := &Header{
+		Format:   "NSF",
+		SystemId: "NESMusic",
+		Title:    text(data[0x0E:0x2E]),
+		Region:   "NTSC",
+		Checksum: crc(data, size, 0x80),
+	}
+	switch {
+	case data[0x7A]&0x02 != 0:
+		hdr.Region = "Multiple"
+	case data[0x7A]&0x01 != 0:
+		hdr.Region = "PAL"
+	}
+
+	return hdr, true
+}
+
+// --------------------------------------------------
+// SNES
+// --------------------------------------------------
+
+var snesRegions = map[byte]string{
+	0x00: "Japan", 0x01: "USA", 0x02: "Europe", 0x03: "Sweden",
+	0x04: "Finland", 0x05: "Denmark", 0x06: "France", 0x07: "Netherlands",
+	0x08: "Spain", 0x09: "Germany", 0x0A: "Italy", 0x0B: "China",
+	0x0C: "Indonesia", 0x0D: "Korea", 0x0F: "Canada", 0x10: "Brazil",
+	0x11: "Australia",
+}
+
+// snesScore rates how likely the header at base is the real one. The header
+// can be in one of a few places depending on the memory map, and nothing
+// marks it, so each place is checked for sensible values.
+func snesScore(data []byte, base int, hiRom bool) int {
+	if len(data) < base+0x40 {
+		return -1
+	}
+
+	score := 0
+	complement := le16(data, base+0x1C)
+	checksum := le16(data, base+0x1E)
+	if complement^checksum == 0xFFFF {
+		score += 4
+	}
+
+	mapMode := data[base+0x15] &^ 0x10 // ignore the speed bit
+	switch {
+	case !hiRom && mapMode == 0x20, hiRom && (mapMode == 0x21 || mapMode == 0x25):
+		score += 2
+	case mapMode&0xE0 != 0x20:
+		score -= 2
+	}
+
+	for _, c := range data[base : base+21] {
+		if c < 0x20 || c > 0x7E {
+			score--
+			break
+		}
+	}
+
+	// reset vector has to point into the ROM
+	if le16(data, base+0x3C) < 0x8000 {
+		score -= 2
+	}
+
+	return score
+}
+
+func parseSNES(data []byte, size int64) (*Header, bool) {
+	offset := 0
+	if size%1024 == 512 {
+		offset = 512 // copier header
+	}
+
+	best, bestScore, hiRom := -1, 0, false
+	for _, c := range []struct {
+		base  int
+		hiRom bool
+	}{{0x7FC0, false}, {0xFFC0, true}} {
+		if score := snesScore(data, offset+c.base, c.hiRom); score > bestScore {
+			best, bestScore, hiRom = offset+c.base, score, c.hiRom
+		}
+	}
+	// a matching checksum pair, or a clean header with the right map mode
+	if best == -1 || bestScore < 4 {
+		return nil, false
+	}
+
+	hdr := &Header{
+		Format:   "SNES",
+		SystemId: "SNES",
+		Title:    text(data[best : best+21]),
+		Region:   snesRegions[data[best+0x19]],
+		Checksum: le16(data, best+0x1E),
+		Layout:   "LoROM",
+	}
+	hdr.ChecksumValid = le16(data, best+0x1C)^hdr.Checksum == 0xFFFF
+	if hiRom {
+		hdr.Layout = "HiROM"
+		if data[best+0x15]&0x0F == 0x05 {
+			hdr.Layout = "ExHiROM"
+		}
+	}
+
+	return hdr, true
+}
+
+// --------------------------------------------------
+// Game Boy
+// --------------------------------------------------
+
+var gbLogo = []byte{0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B}
+
+func parseGB(data []byte, _ int64) (*Header, bool) {
+	if !hasAt(data, 0x104, gbLogo) || len(data) < 0x150 {
+		return nil, false
+	}
+
+	hdr := &Header{
+		Format:   "Game Boy",
+		SystemId: "Gameboy",
+		Checksum: be16(data, 0x14E),
+	}
+
+	titleEnd := 0x144
+	switch data[0x143] {
+	case 0xC0: // colour only
+		hdr.Format = "Game Boy Color"
+		hdr.SystemId = "GameboyColor"
+		titleEnd = 0x13F
+	case 0x80: // colour enhanced, still runs on a GB
+		hdr.Format = "Game Boy Color"
+		hdr.AltSystems = append(hdr.AltSystems, "GameboyColor")
+		titleEnd = 0x13F
+	}
+	if data[0x146] == 0x03 {
+		hdr.AltSystems = append(hdr.AltSystems, "SuperGameboy")
+	}
+	hdr.Title = text(data[0x134:titleEnd])
+
+	if data[0x14A] == 0x00 {
+		hdr.Region = "Japan"
+	} else {
+		hdr.Region = "World"
+	}
+
+	// header checksum covers the title to the version byte
+	var x byte
+	for _, c := range data[0x134:0x14D] {
+		x = x - c - 1
+	}
+	hdr.ChecksumValid = x == data[0x14D]
+
+	return hdr, true
+}
+
+// --------------------------------------------------
+// Game Boy Advance
+// --------------------------------------------------
+
+var gbaLogo = []byte{0x24, 0xFF, 0xAE, 0x51, 0x69, 0x9A, 0xA2, 0x21}
+
+// gbaRegions is keyed by the last letter of the game code.
+var gbaRegions = map[byte]string{
+	'J': "Japan", 'E': "USA", 'P': "Europe", 'D': "Germany", 'F': "France",
+	'I': "Italy", 'S': "Spain", 'H': "Netherlands", 'K': "Korea", 'C': "China",
+	'U': "Australia", 'X': "Europe", 'Y': "Europe",
+}
+
+func parseGBA(data []byte, _ int64) (*Header, bool) {
+	if !hasAt(data, 0x04, gbaLogo) || len(data) < 0xC0 || data[0xB2] != 0x96 {
+		return nil, false
+	}
+
+	hdr := &Header{
+		Format:   "GBA",
+		SystemId: "GBA",
+		Title:    text(data[0xA0:0xAC]),
+		Region:   gbaRegions[data[0xAF]],
+		Checksum: uint32(data[0xBD]),
+	}
+
+	var x byte
+	for _, c := range data[0xA0:0xBD] {
+		x -= c
+	}
+	hdr.ChecksumValid = x-0x19 == data[0xBD]
+
+	return hdr, true
+}
+
+// --------------------------------------------------
+// Nintendo 64
+// --------------------------------------------------
+
+var n64Regions = map[byte]string{
+	'7': "Beta", 'A': "Asia", 'B': "Brazil", 'C': "China", 'D': "Germany",
+	'E': "USA", 'F': "France", 'G': "Gateway 64 (NTSC)", 'H': "Netherlands",
+	'I': "Italy", 'J': "Japan", 'K': "Korea", 'L': "Gateway 64 (PAL)",
+	'N': "Canada", 'P': "Europe", 'S': "Spain", 'U': "Australia",
+	'W': "Scandinavia", 'X': "Europe", 'Y': "Europe",
+}
+
+// n64Header returns the first 0x40 bytes in big endian order, whatever
+// order the dump is in.
+func n64Header(data []byte) ([]byte, string, bool) {
+	if len(data) < 0x40 {
+		return nil, "", false
+	}
+
+	hdr := make([]byte, 0x40)
+	switch {
+	case hasAt(data, 0, []byte{0x80, 0x37, 0x12, 0x40}):
+		copy(hdr, data)
+		return hdr, "z64", true
+	case hasAt(data, 0, []byte{0x37, 0x80, 0x40, 0x12}):
+		for i := 0; i < 0x40; i += 2 {
+			hdr[i], hdr[i+1] = data[i+1], data[i]
+		}
+		return hdr, "v64", true
+	case hasAt(data, 0, []byte{0x40, 0x12, 0x37, 0x80}):
+		for i := 0; i < 0x40; i += 4 {
+			hdr[i], hdr[i+1], hdr[i+2], hdr[i+3] = data[i+3], data[i+2], data[i+1], data[i]
+		}
+		return hdr, "n64", true
+	}
+	return nil, "", false
+}
+
+func parseN64(data []byte, _ int64) (*Header, bool) {
+	h, order, ok := n64Header(data)
+	if !ok {
+		return nil, false
+	}
+
+	return &Header{
+		Format:   "N64",
+		SystemId: "Nintendo64",
+		Title:    text(h[0x20:0x34]),
+		Region:   n64Regions[h[0x3E]],
+		Checksum: be32(h, 0x10), // CRC1
+		Layout:   order,
+	}, true
+}
@@ -0,0 +1,37 @@
+package romheader
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// ParsePCE reads a PC Engine HuCard. There's no header to identify one, so
+// this should only be used on files already known to be for the system.
+// TurboGrafx-16 (USA) cards have their data lines reversed, which shows in
+// the reset vector at the end of the first bank.
+func ParsePCE(data []byte, size int64) (*Header, error) {
+	skip := 0
+	if size%8192 == 512 {
+		skip = 512 // copier header
+	}
+	if len(data) < skip+0x2000 {
+		return nil, fmt.Errorf("rom too small for a hucard")
+	}
+
+	hdr := &Header{
+		Format:   "PC Engine",
+		SystemId: "TurboGrafx16",
+		Checksum: crc(data, size, skip),
+	}
+
+	vector := data[skip+0x1FFF]
+	switch {
+	case vector >= 0xE0:
+		hdr.Region = "Japan"
+	case bits.Reverse8(vector) >= 0xE0:
+		hdr.Format = "TurboGrafx-16"
+		hdr.Region = "USA"
+	}
+
+	return hdr, nil
+}
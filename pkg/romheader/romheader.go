@@ -0,0 +1,186 @@
+// Package romheader reads the internal headers of cartridge ROMs, to tell
+// which system a ROM is for and get its title, region and checksum without
+// relying on folders or file extensions.
+package romheader
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/synrais/SAM-GO/pkg/utils"
+)
+
+// ReadSize is how much of a ROM Read looks at, enough for every header
+// including the SNES HiROM header after a copier header.
+const ReadSize = 0x10200
+
+// maxCrcSize is the largest ROM which is read in full to calculate a CRC32
+// for formats without a checksum in their header.
+const maxCrcSize = 8 << 20
+
+var ErrUnknown = errors.New("unknown rom header")
+
+// Header is what was found in a ROM. System IDs are the same as the ones in
+// the games package.
+type Header struct {
+	Format   string // e.g. "iNES", "NES 2.0", "SNES", "Mega Drive"
+	SystemId string
+	// Other systems the ROM also runs on, like a GBC game which still works
+	// on an original Game Boy.
+	AltSystems []string
+	Title      string
+	Region     string
+	// Checksum is the checksum stored in the header, or for formats which
+	// don't have one, the CRC32 of the ROM data when it was fully read.
+	Checksum uint32
+	// ChecksumValid is set when the header checksum was verified, e.g. the
+	// SNES checksum and complement pair matching.
+	ChecksumValid bool
+
+	Mapper int    // NES
+	Layout string // SNES memory map, N64 byte order
+}
+
+type parser func(data []byte, size int64) (*Header, bool)
+
+// parsers are tried in order. Formats with a fixed magic come first, SNES
+// has none and is found by its checksum so is tried last.
+var parsers = []parser{
+	parseNES,
+	parseFDS,
+	parseNSF,
+	parseN64,
+	parseGBA,
+	parseGB,
+	parseMegaDrive,
+	parseSMS,
+	parseSNES,
+}
+
+// Parse identifies a ROM from its data. data can be just the start of the
+// file, at least ReadSize bytes of it, and size is the full file size.
+// PC Engine ROMs have no header to find, use ParsePCE for them.
+func Parse(data []byte, size int64) (*Header, error) {
+	for _, parse := range parsers {
+		if hdr, ok := parse(data, size); ok {
+			return hdr, nil
+		}
+	}
+	return nil, ErrUnknown
+}
+
+// Systems are the systems romheader can identify.
+var Systems = map[string]bool{
+	"NES": true, "FDS": true, "NESMusic": true, "SNES": true,
+	"Gameboy": true, "GameboyColor": true, "GBA": true, "MegaDrive": true,
+	"Sega32X": true, "MasterSystem": true, "GameGear": true,
+	"Nintendo64": true, "TurboGrafx16": true,
+}
+
+// Read reads the header of a ROM file. Files in zips are read with the same
+// paths games.GetFiles uses, e.g. /media/fat/games/NES/roms.zip/game.nes.
+func Read(path string) (*Header, error) {
+	return read(path, maxCrcSize)
+}
+
+// Peek is Read without reading the whole ROM, for going through lots of
+// files. Formats without a checksum in their header only get one for ROMs
+// smaller than ReadSize.
+func Peek(path string) (*Header, error) {
+	return read(path, ReadSize)
+}
+
+func read(path string, crcSize int64) (*Header, error) {
+	r, size, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	limit := int64(ReadSize)
+	if size <= crcSize {
+		limit = size
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rom: %w", err)
+	}
+
+	hdr, err := Parse(data, size)
+	if errors.Is(err, ErrUnknown) {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".pce", ".sgx":
+			return ParsePCE(data, size)
+		}
+	}
+	return hdr, err
+}
+
+var zipPathRe = regexp.MustCompile(`(?i)^(.*\.zip)/(.+)$`)
+
+func open(path string) (io.ReadCloser, int64, error) {
+	if m := zipPathRe.FindStringSubmatch(path); m != nil {
+		return utils.OpenZipFile(m[1], m[2])
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// --------------------------------------------------
+// Helpers
+// --------------------------------------------------
+
+func hasAt(data []byte, offset int, magic []byte) bool {
+	return len(data) >= offset+len(magic) && string(data[offset:offset+len(magic)]) == string(magic)
+}
+
+// text cleans up a fixed width title field, which is padded with spaces or
+// zeros and sometimes has non-ASCII junk.
+func text(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		if c == 0 {
+			break
+		}
+		if c < 0x20 || c > 0x7E {
+			c = ' '
+		}
+		b.WriteByte(c)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func be16(data []byte, offset int) uint32 {
+	return uint32(data[offset])<<8 | uint32(data[offset+1])
+}
+
+func le16(data []byte, offset int) uint32 {
+	return uint32(data[offset]) | uint32(data[offset+1])<<8
+}
+
+func be32(data []byte, offset int) uint32 {
+	return uint32(data[offset])<<24 | uint32(data[offset+1])<<16 | uint32(data[offset+2])<<8 | uint32(data[offset+3])
+}
+
+// crc returns the CRC32 of data if it's the whole file, otherwise 0.
+func crc(data []byte, size int64, skip int) uint32 {
+	if int64(len(data)) != size || skip > len(data) {
+		return 0
+	}
+	return crc32.ChecksumIEEE(data[skip:])
+}
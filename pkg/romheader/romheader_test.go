@@ -0,0 +1,249 @@
+package romheader
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func nesRom(flags6, flags7, byte12 byte) []byte {
+	rom := make([]byte, 16+0x4000)
+	copy(rom, "NES\x1a")
+	rom[4] = 1
+	rom[6], rom[7], rom[12] = flags6, flags7, byte12
+	return rom
+}
+
+func fdsRom(fwnes bool) []byte {
+	disk := make([]byte, 65500)
+	disk[0] = 0x01
+	copy(disk[1:], "*NINTENDO-HVC*")
+	copy(disk[0x10:], "ZEL ")
+	if !fwnes {
+		return disk
+	}
+	return append([]byte("FDS\x1a\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), disk...)
+}
+
+func nsfRom(title string, region byte) []byte {
+	rom := make([]byte, 0x80+0x1000)
+	copy(rom, "NESM\x1a\x01")
+	rom[6] = 12
+	copy(rom[0x0E:], title)
+	rom[0x7A] = region
+	return rom
+}
+
+func snesRom(base int, mapMode byte, title string) []byte {
+	rom := make([]byte, 0x10000)
+	copy(rom[base:], title)
+	for i := len(title); i < 21; i++ {
+		rom[base+i] = ' '
+	}
+	rom[base+0x15] = mapMode
+	rom[base+0x19] = 0x01
+	rom[base+0x1C], rom[base+0x1D] = 0x34, 0x12 // complement
+	rom[base+0x1E], rom[base+0x1F] = 0xCB, 0xED // checksum
+	rom[base+0x3C], rom[base+0x3D] = 0x00, 0x80 // reset vector
+	return rom
+}
+
+func gbRom(title string, cgb byte) []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x104:], gbLogo)
+	copy(rom[0x134:], title)
+	rom[0x143] = cgb
+	rom[0x14A] = 1
+	var x byte
+	for _, c := range rom[0x134:0x14D] {
+		x = x - c - 1
+	}
+	rom[0x14D] = x
+	return rom
+}
+
+func mdRom(system, title, region string) []byte {
+	rom := make([]byte, 0x200)
+	copy(rom[0x100:], system)
+	copy(rom[0x150:], title)
+	rom[0x18E], rom[0x18F] = 0xAB, 0xCD
+	copy(rom[0x1F0:], region)
+	return rom
+}
+
+func n64Rom() []byte {
+	rom := make([]byte, 0x40)
+	copy(rom, []byte{0x80, 0x37, 0x12, 0x40})
+	copy(rom[0x10:], []byte{0xDE, 0xAD, 0xBE, 0xEF})
+	copy(rom[0x20:], "SUPER MARIO 64      ")
+	rom[0x3E] = 'E'
+	return rom
+}
+
+func swap16(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i := 0; i < len(data); i += 2 {
+		out[i], out[i+1] = data[i+1], data[i]
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Header
+	}{
+		{
+			"ines",
+			nesRom(0x10, 0x00, 0),
+			Header{Format: "iNES", SystemId: "NES", Region: "NTSC", Mapper: 1},
+		},
+		{
+			"nes 2.0",
+			nesRom(0x40, 0x08, 1),
+			Header{Format: "NES 2.0", SystemId: "NES", Region: "PAL", Mapper: 4},
+		},
+		{
+			"fds",
+			fdsRom(true),
+			Header{Format: "FDS", SystemId: "FDS", Title: "ZEL", Region: "Japan"},
+		},
+		{
+			"fds raw",
+			fdsRom(false),
+			Header{Format: "FDS", SystemId: "FDS", Title: "ZEL", Region: "Japan"},
+		},
+		{
+			"nsf",
+			nsfRom("Super Mario Bros.", 0x00),
+			Header{Format: "NSF", SystemId: "NESMusic", Title: "Super Mario Bros.", Region: "NTSC"},
+		},
+		{
+			"nsf dual",
+			nsfRom("Mega Man 2", 0x03),
+			Header{Format: "NSF", SystemId: "NESMusic", Title: "Mega Man 2", Region: "Multiple"},
+		},
+		{
+			"snes lorom",
+			snesRom(0x7FC0, 0x20, "SUPER METROID"),
+			Header{Format: "SNES", SystemId: "SNES", Title: "SUPER METROID", Region: "USA", Checksum: 0xEDCB, ChecksumValid: true, Layout: "LoROM"},
+		},
+		{
+			"snes hirom",
+			snesRom(0xFFC0, 0x31, "DONKEY KONG COUNTRY"),
+			Header{Format: "SNES", SystemId: "SNES", Title: "DONKEY KONG COUNTRY", Region: "USA", Checksum: 0xEDCB, ChecksumValid: true, Layout: "HiROM"},
+		},
+		{
+			"gb",
+			gbRom("TETRIS", 0x00),
+			Header{Format: "Game Boy", SystemId: "Gameboy", Title: "TETRIS", Region: "World", ChecksumValid: true},
+		},
+		{
+			"gbc only",
+			gbRom("POKEMON", 0xC0),
+			Header{Format: "Game Boy Color", SystemId: "GameboyColor", Title: "POKEMON", Region: "World", ChecksumValid: true},
+		},
+		{
+			"mega drive",
+			mdRom("SEGA GENESIS", "SONIC THE       HEDGEHOG", "JUE"),
+			Header{Format: "Mega Drive", SystemId: "MegaDrive", Title: "SONIC THE HEDGEHOG", Region: "Japan/USA/Europe", Checksum: 0xABCD},
+		},
+		{
+			"32x",
+			mdRom("SEGA 32X", "DOOM", "4"),
+			Header{Format: "32X", SystemId: "Sega32X", Title: "DOOM", Region: "USA", Checksum: 0xABCD},
+		},
+		{
+			"n64 big endian",
+			n64Rom(),
+			Header{Format: "N64", SystemId: "Nintendo64", Title: "SUPER MARIO 64", Region: "USA", Checksum: 0xDEADBEEF, Layout: "z64"},
+		},
+		{
+			"n64 byte swapped",
+			swap16(n64Rom()),
+			Header{Format: "N64", SystemId: "Nintendo64", Title: "SUPER MARIO 64", Region: "USA", Checksum: 0xDEADBEEF, Layout: "v64"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.data, int64(len(tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// NES, FDS and NSF checksums are a CRC of the whole file, only
+			// check it's set
+			switch got.SystemId {
+			case "NES", "FDS", "NESMusic":
+				if got.Checksum == 0 {
+					t.Error("no checksum")
+				}
+				got.Checksum = 0
+			}
+			got.AltSystems = nil
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", *got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Parse(make([]byte, 0x10000), 0x10000); err != ErrUnknown {
+		t.Errorf("expected ErrUnknown for blank data, got %v", err)
+	}
+}
+
+func TestParseGBAlt(t *testing.T) {
+	rom := gbRom("ZELDA", 0x80)
+	rom[0x146] = 0x03
+	hdr, err := Parse(rom, int64(len(rom)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.SystemId != "Gameboy" || len(hdr.AltSystems) != 2 {
+		t.Errorf("got %s %v", hdr.SystemId, hdr.AltSystems)
+	}
+}
+
+func TestParsePCE(t *testing.T) {
+	rom := make([]byte, 0x2000)
+	rom[0x1FFF] = 0xE0
+	hdr, err := ParsePCE(rom, int64(len(rom)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Region != "Japan" || hdr.Checksum == 0 {
+		t.Errorf("got %+v", hdr)
+	}
+
+	rom[0x1FFF] = 0x07 // 0xE0 reversed
+	if hdr, _ := ParsePCE(rom, int64(len(rom))); hdr.Region != "USA" {
+		t.Errorf("got region %q, want USA", hdr.Region)
+	}
+}
+
+func TestReadZip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roms.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("Tetris.gb")
+	w.Write(gbRom("TETRIS", 0x00))
+	zw.Close()
+	f.Close()
+
+	hdr, err := Read(path + "/Tetris.gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Title != "TETRIS" {
+		t.Errorf("got title %q", hdr.Title)
+	}
+	if _, err := Read(path + "/Missing.gb"); err == nil {
+		t.Error("expected error for missing zip member")
+	}
+}
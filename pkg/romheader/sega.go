@@ -0,0 +1,106 @@
+package romheader
+
+import "strings"
+
+// --------------------------------------------------
+// Mega Drive and 32X
+// --------------------------------------------------
+
+func mdRegion(field string) string {
+	field = strings.Trim(field, " \x00")
+	if field == "" {
+		return ""
+	}
+
+	// newer games use a single hex digit of region bits
+	if len(field) == 1 && strings.ContainsAny(field, "0123456789ABCDEF") && !strings.ContainsAny(field, "JUE") {
+		var bits byte
+		c := field[0]
+		if c <= '9' {
+			bits = c - '0'
+		} else {
+			bits = c - 'A' + 10
+		}
+		var regions []string
+		if bits&0x01 != 0 {
+			regions = append(regions, "Japan")
+		}
+		if bits&0x04 != 0 {
+			regions = append(regions, "USA")
+		}
+		if bits&0x08 != 0 {
+			regions = append(regions, "Europe")
+		}
+		return strings.Join(regions, "/")
+	}
+
+	var regions []string
+	for _, r := range []struct {
+		code byte
+		name string
+	}{{'J', "Japan"}, {'U', "USA"}, {'E', "Europe"}} {
+		if strings.IndexByte(field, r.code) != -1 {
+			regions = append(regions, r.name)
+		}
+	}
+	return strings.Join(regions, "/")
+}
+
+func parseMegaDrive(data []byte, _ int64) (*Header, bool) {
+	if len(data) < 0x200 {
+		return nil, false
+	}
+	system := string(data[0x100:0x110])
+	if !strings.HasPrefix(strings.TrimSpace(system), "SEGA") {
+		return nil, false
+	}
+
+	hdr := &Header{
+		Format:   "Mega Drive",
+		SystemId: "MegaDrive",
+		Title:    text(data[0x150:0x180]), // overseas
+		Region:   mdRegion(string(data[0x1F0:0x1F3])),
+		Checksum: be16(data, 0x18E),
+	}
+	if hdr.Title == "" {
+		hdr.Title = text(data[0x120:0x150]) // domestic
+	}
+	if strings.Contains(system, "32X") {
+		hdr.Format = "32X"
+		hdr.SystemId = "Sega32X"
+	}
+
+	return hdr, true
+}
+
+// --------------------------------------------------
+// Master System and Game Gear
+// --------------------------------------------------
+
+func parseSMS(data []byte, _ int64) (*Header, bool) {
+	for _, offset := range []int{0x7FF0, 0x3FF0, 0x1FF0} {
+		if !hasAt(data, offset, []byte("TMR SEGA")) || len(data) < offset+0x10 {
+			continue
+		}
+
+		hdr := &Header{
+			Format:   "SMS",
+			SystemId: "MasterSystem",
+			Checksum: le16(data, offset+0x0A),
+		}
+		switch data[offset+0x0F] >> 4 {
+		case 3:
+			hdr.Region = "Japan"
+		case 4:
+			hdr.Region = "Export"
+		case 5:
+			hdr.Format, hdr.SystemId, hdr.Region = "Game Gear", "GameGear", "Japan"
+		case 6:
+			hdr.Format, hdr.SystemId, hdr.Region = "Game Gear", "GameGear", "Export"
+		case 7:
+			hdr.Format, hdr.SystemId, hdr.Region = "Game Gear", "GameGear", "International"
+		}
+		return hdr, true
+	}
+	return nil, false
+}
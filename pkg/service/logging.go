@@ -2,45 +2,289 @@ package service
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/synrais/SAM-GO/pkg/config"
 )
 
+// Level is how important a log message is. Messages below a logger's level
+// are dropped.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "WARNING" {
+		return LevelWarn, nil
+	}
+	for level, name := range levelNames {
+		if name == s {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", s)
+}
+
+const (
+	defaultLogSize    = 1 // MB
+	defaultLogBackups = 1
+)
+
+// output is where a logger and all of its components write, and the levels
+// they write at.
+type output struct {
+	mu      sync.Mutex
+	file    *lumberjack.Logger
+	console io.Writer
+	level   Level
+	levels  map[string]Level
+}
+
+func (o *output) enabled(component string, level Level) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	min, ok := o.levels[component]
+	if !ok {
+		min = o.level
+	}
+	return level >= min
+}
+
+func (o *output) write(now time.Time, component string, level Level, msg string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	tag := ""
+	if component != "" {
+		tag = "[" + component + "] "
+	}
+	if o.file != nil {
+		fmt.Fprintf(o.file, "%s %s %s%s\n", now.Format("2006/01/02 15:04:05"), level, tag, msg)
+	}
+	if o.console != nil {
+		if level >= LevelWarn {
+			fmt.Fprintf(o.console, "%s%s: %s\n", tag, level, msg)
+		} else {
+			fmt.Fprintf(o.console, "%s%s\n", tag, msg)
+		}
+	}
+}
+
+// Logger writes levelled messages tagged with the component they came from,
+// plus any fields added with With:
+//
+//	2024/01/02 15:04:05 INFO [attract] launching Sonic system=Genesis
+//
+// Packages get their logger from Component, which writes wherever the
+// default logger does, so a program chooses where all logging goes with
+// SetDefault.
 type Logger struct {
-	log         *log.Logger
-	EnableDebug bool
+	out       *output // nil for the default logger's output
+	component string
+	fields    string
 }
 
+// NewLogger creates a logger writing to a size capped file in /tmp, which is
+// rotated so it can't fill up RAM.
 func NewLogger(name string) *Logger {
-	logFile := fmt.Sprintf(config.LogFileTemplate, name)
+	return &Logger{out: &output{
+		file: &lumberjack.Logger{
+			Filename:   fmt.Sprintf(config.LogFileTemplate, name),
+			MaxSize:    defaultLogSize,
+			MaxBackups: defaultLogBackups,
+		},
+		level:  LevelInfo,
+		levels: make(map[string]Level),
+	}}
+}
+
+// NewConsoleLogger creates a logger writing only to w, for programs running
+// in a terminal.
+func NewConsoleLogger(w io.Writer) *Logger {
+	return &Logger{out: &output{
+		console: w,
+		level:   LevelInfo,
+		levels:  make(map[string]Level),
+	}}
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = NewConsoleLogger(os.Stdout)
+)
+
+// SetDefault makes l the logger every Component logger writes to.
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = l
+}
+
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// Component returns a logger for one package or part of a program, writing
+// to the default logger. It's safe to create before SetDefault is called.
+func Component(name string) *Logger {
+	return &Logger{component: name}
+}
 
+func (l *Logger) output() *output {
+	if l.out != nil {
+		return l.out
+	}
+	return Default().output()
+}
+
+// Component returns a logger tagged with name, writing where l does.
+func (l *Logger) Component(name string) *Logger {
+	return &Logger{out: l.out, component: name, fields: l.fields}
+}
+
+// With returns a logger which adds key=value to every message.
+func (l *Logger) With(key string, value any) *Logger {
+	v := fmt.Sprint(value)
+	if strings.ContainsAny(v, " \t\"=") {
+		v = fmt.Sprintf("%q", v)
+	}
 	return &Logger{
-		log: log.New(&lumberjack.Logger{
-			Filename:   logFile,
-			MaxSize:    1,
-			MaxBackups: 2,
-		}, "", log.LstdFlags),
+		out:       l.out,
+		component: l.component,
+		fields:    fmt.Sprintf("%s %s=%s", l.fields, key, v),
 	}
 }
 
-func (l *Logger) Info(format string, v ...any) {
-	l.log.Println("INFO", fmt.Sprintf(format, v...))
+// SetConsole also writes messages to w, or stops writing them to a console
+// if w is nil.
+func (l *Logger) SetConsole(w io.Writer) {
+	out := l.output()
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.console = w
 }
 
-func (l *Logger) Warn(format string, v ...any) {
-	l.log.Println("WARN", fmt.Sprintf(format, v...))
+// SetLevel sets the level for components without their own level.
+func (l *Logger) SetLevel(level Level) {
+	out := l.output()
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.level = level
 }
 
-func (l *Logger) Error(format string, v ...any) {
-	l.log.Println("ERROR", fmt.Sprintf(format, v...))
+// SetComponentLevel sets the level for one component.
+func (l *Logger) SetComponentLevel(component string, level Level) {
+	out := l.output()
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if out.levels == nil {
+		out.levels = make(map[string]Level)
+	}
+	out.levels[strings.ToLower(component)] = level
 }
 
-func (l *Logger) Debug(format string, v ...any) {
-	if !l.EnableDebug {
+// Configure applies the [logging] settings from SAM.ini. Bad levels are
+// reported, and the rest of the settings still applied.
+func (l *Logger) Configure(cfg config.LoggingConfig) error {
+	var errs []string
+
+	if cfg.Level != "" {
+		level, err := ParseLevel(cfg.Level)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			l.SetLevel(level)
+		}
+	}
+
+	for _, entry := range cfg.Components {
+		component, name, ok := strings.Cut(entry, ":")
+		if !ok {
+			errs = append(errs, fmt.Sprintf("component level should be component:level: %s", entry))
+			continue
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		l.SetComponentLevel(strings.TrimSpace(component), level)
+	}
+
+	out := l.output()
+	out.mu.Lock()
+	if out.file != nil {
+		if cfg.MaxSize > 0 {
+			out.file.MaxSize = cfg.MaxSize
+		}
+		if cfg.Backups > 0 {
+			out.file.MaxBackups = cfg.Backups
+		}
+	}
+	out.mu.Unlock()
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("invalid logging settings: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Enabled reports whether messages at level would be written, for skipping
+// work only needed for them.
+func (l *Logger) Enabled(level Level) bool {
+	return l.output().enabled(strings.ToLower(l.component), level)
+}
+
+func (l *Logger) logf(level Level, format string, v ...any) {
+	out := l.output()
+	if !out.enabled(strings.ToLower(l.component), level) {
 		return
 	}
-	l.log.Println("DEBUG", fmt.Sprintf(format, v...))
+	out.write(time.Now(), l.component, level, fmt.Sprintf(format, v...)+l.fields)
+}
+
+func (l *Logger) Debug(format string, v ...any) {
+	l.logf(LevelDebug, format, v...)
+}
+
+func (l *Logger) Info(format string, v ...any) {
+	l.logf(LevelInfo, format, v...)
+}
+
+func (l *Logger) Warn(format string, v ...any) {
+	l.logf(LevelWarn, format, v...)
+}
+
+func (l *Logger) Error(format string, v ...any) {
+	l.logf(LevelError, format, v...)
 }
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	root := NewConsoleLogger(&buf)
+	if err := root.Configure(config.LoggingConfig{
+		Level:      "warn",
+		Components: []string{"attract:debug", " Input : error"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	attract := root.Component("attract")
+	input := root.Component("input")
+	other := root.Component("other")
+
+	attract.Debug("launching %s", "Sonic")
+	input.Warn("dropped")
+	input.Error("no devices")
+	other.Info("dropped")
+	other.Warn("careful")
+	attract.With("system", "Genesis").With("name", "Sonic 2").Info("launched")
+
+	want := "[attract] launching Sonic\n" +
+		"[input] ERROR: no devices\n" +
+		"[other] WARN: careful\n" +
+		"[attract] launched system=Genesis name=\"Sonic 2\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if !attract.Enabled(LevelDebug) || other.Enabled(LevelInfo) {
+		t.Error("Enabled doesn't match the configured levels")
+	}
+}
+
+func TestLoggerConfigureErrors(t *testing.T) {
+	var buf bytes.Buffer
+	root := NewConsoleLogger(&buf)
+	err := root.Configure(config.LoggingConfig{
+		Level:      "loud",
+		Components: []string{"attract", "input:debug"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for bad settings")
+	}
+	// the good setting still applies
+	if !root.Component("input").Enabled(LevelDebug) {
+		t.Error("input level not set")
+	}
+	if root.Component("attract").Enabled(LevelDebug) {
+		t.Error("default level changed")
+	}
+}
+
+func TestComponentUsesDefault(t *testing.T) {
+	logger := Component("late")
+
+	var buf bytes.Buffer
+	old := Default()
+	SetDefault(NewConsoleLogger(&buf))
+	defer SetDefault(old)
+
+	logger.Info("hello")
+	if got := buf.String(); got != "[late] hello\n" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -342,6 +342,7 @@ func (s *Service) ServiceHandler(cmd *string) {
 	} else if *cmd == "status" {
 		if s.Running() {
 			fmt.Printf("%s service running\n", s.Name)
+			printTaskStatus(s.Name)
 		} else {
 			fmt.Printf("%s service not running\n", s.Name)
 		}
@@ -352,3 +353,23 @@ func (s *Service) ServiceHandler(cmd *string) {
 		os.Exit(1)
 	}
 }
+
+// printTaskStatus shows the health of a running service's supervised tasks,
+// if it has any.
+func printTaskStatus(name string) {
+	tasks, err := ReadTaskStatus(name)
+	if err != nil {
+		return
+	}
+	for _, task := range tasks {
+		line := fmt.Sprintf("  %-10s %s for %s", task.Name, task.State,
+			time.Since(task.Since).Round(time.Second))
+		if task.Restarts > 0 {
+			line += fmt.Sprintf(", %d restarts", task.Restarts)
+		}
+		fmt.Println(line)
+		if task.LastError != "" {
+			fmt.Printf("    last error at %s: %s\n", task.ErrorTime.Format("15:04:05"), task.LastError)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/synrais/SAM-GO/pkg/config"
+)
+
+// Task is a long running part of a service. It runs until stop is closed
+// and then returns nil. Returning an error or panicking before that is a
+// crash, and the task is restarted. Returning nil early means the task is
+// done and it isn't restarted.
+type Task func(stop <-chan struct{}) error
+
+// EntryTask runs a ServiceEntry as a task. Only failures to start can be
+// seen, they're retried like any other crash.
+func EntryTask(entry ServiceEntry) Task {
+	return func(stop <-chan struct{}) error {
+		stopEntry, err := entry()
+		if err != nil {
+			return err
+		}
+		<-stop
+		if stopEntry == nil {
+			return nil
+		}
+		return stopEntry()
+	}
+}
+
+const (
+	TaskRunning    = "running"
+	TaskRestarting = "restarting"
+	TaskStopped    = "stopped"
+)
+
+// TaskStatus is the health of one supervised task.
+type TaskStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	ErrorTime time.Time `json:"error_time,omitempty"`
+}
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+	defaultResetAfter = time.Minute
+)
+
+// Supervisor runs named tasks, restarting them when they crash. Restarts
+// back off exponentially from MinBackoff up to MaxBackoff, and a task which
+// has run for ResetAfter without crashing starts again from MinBackoff.
+//
+// The status of every task is kept in StatusFile, so the service's status
+// command can show it from another process.
+type Supervisor struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	ResetAfter time.Duration
+	StatusFile string
+
+	logger  *Logger
+	mu      sync.Mutex
+	tasks   map[string]*TaskStatus
+	running map[string]chan struct{} // closed to stop the task
+	done    map[string]chan struct{} // closed when the task has returned
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// NewSupervisor creates a supervisor for the service called name.
+func NewSupervisor(name string, logger *Logger) *Supervisor {
+	return &Supervisor{
+		MinBackoff: defaultMinBackoff,
+		MaxBackoff: defaultMaxBackoff,
+		ResetAfter: defaultResetAfter,
+		StatusFile: fmt.Sprintf(config.StatusFileTemplate, name),
+		logger:     logger,
+		tasks:      make(map[string]*TaskStatus),
+		running:    make(map[string]chan struct{}),
+		done:       make(map[string]chan struct{}),
+	}
+}
+
+// Go starts a task. A task can be started again once it's done, but not
+// while it's still running.
+func (s *Supervisor) Go(name string, task Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return fmt.Errorf("supervisor stopped")
+	}
+	if _, ok := s.running[name]; ok {
+		return fmt.Errorf("task already running: %s", name)
+	}
+
+	status, ok := s.tasks[name]
+	if !ok {
+		status = &TaskStatus{Name: name}
+		s.tasks[name] = status
+	}
+	status.State, status.Since = TaskRunning, time.Now()
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.running[name], s.done[name] = stop, done
+	s.saveLocked()
+
+	s.wg.Add(1)
+	go func() {
+		defer close(done)
+		s.supervise(name, task, stop)
+	}()
+	return nil
+}
+
+// Restart stops a task if it's running, waits for it to return and starts
+// task in its place, e.g. to run it with new settings.
+func (s *Supervisor) Restart(name string, task Task) error {
+	s.mu.Lock()
+	stopTask(s.running[name])
+	done := s.done[name]
+	s.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+	return s.Go(name, task)
+}
+
+// Running reports whether a task is running or waiting to restart.
+func (s *Supervisor) Running(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.running[name]
+	return ok
+}
+
+// StopTask stops one task, including one waiting to restart. It doesn't
+// wait for the task to return.
+func (s *Supervisor) StopTask(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stopTask(s.running[name])
+}
+
+func stopTask(stop chan struct{}) {
+	if stop == nil {
+		return
+	}
+	select {
+	case <-stop:
+	default:
+		close(stop)
+	}
+}
+
+// runOnce runs a task, turning a panic into an error.
+func runOnce(task Task, stop <-chan struct{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return task(stop)
+}
+
+func (s *Supervisor) supervise(name string, task Task, stop chan struct{}) {
+	defer s.wg.Done()
+
+	backoff := s.MinBackoff
+	for {
+		started := time.Now()
+		err := runOnce(task, stop)
+
+		select {
+		case <-stop:
+			s.setState(name, TaskStopped, err)
+			return
+		default:
+		}
+
+		if err == nil {
+			s.logger.Info("%s finished", name)
+			s.setState(name, TaskStopped, nil)
+			return
+		}
+
+		if time.Since(started) >= s.ResetAfter {
+			backoff = s.MinBackoff
+		}
+		s.logger.Error("%s crashed, restarting in %s: %s", name, backoff, err)
+		s.setState(name, TaskRestarting, err)
+
+		select {
+		case <-stop:
+			s.setState(name, TaskStopped, nil)
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+		s.setState(name, TaskRunning, nil)
+	}
+}
+
+func (s *Supervisor) setState(name string, state string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.tasks[name]
+	if status.State == TaskRestarting && state == TaskRunning {
+		status.Restarts++
+	}
+	status.State, status.Since = state, time.Now()
+	if err != nil {
+		status.LastError, status.ErrorTime = err.Error(), status.Since
+	}
+	if state == TaskStopped {
+		delete(s.running, name)
+		delete(s.done, name)
+	}
+	s.saveLocked()
+}
+
+// Status returns every task started so far, sorted by name.
+func (s *Supervisor) Status() []TaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked()
+}
+
+func (s *Supervisor) statusLocked() []TaskStatus {
+	list := make([]TaskStatus, 0, len(s.tasks))
+	for _, status := range s.tasks {
+		list = append(list, *status)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func (s *Supervisor) saveLocked() {
+	if s.StatusFile == "" {
+		return
+	}
+	data, err := json.Marshal(s.statusLocked())
+	if err != nil {
+		return
+	}
+	tmp := s.StatusFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		s.logger.Warn("failed to write status: %s", err)
+		return
+	}
+	_ = os.Rename(tmp, s.StatusFile)
+}
+
+// Stop stops every task and waits for them to return. The status file is
+// removed.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	for _, stop := range s.running {
+		stopTask(stop)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	if s.StatusFile != "" {
+		_ = os.Remove(s.StatusFile)
+	}
+}
+
+// ReadTaskStatus reads the task status written by the supervisor of the
+// service called name.
+func ReadTaskStatus(name string) ([]TaskStatus, error) {
+	return readStatusFile(fmt.Sprintf(config.StatusFileTemplate, name))
+}
+
+func readStatusFile(path string) ([]TaskStatus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []TaskStatus
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid status file: %w", err)
+	}
+	return list, nil
+}
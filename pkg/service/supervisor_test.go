@@ -0,0 +1,216 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testSupervisor(t *testing.T) *Supervisor {
+	var logs nullWriter
+	s := NewSupervisor("test", NewConsoleLogger(logs))
+	s.MinBackoff = time.Millisecond
+	s.MaxBackoff = 4 * time.Millisecond
+	s.StatusFile = filepath.Join(t.TempDir(), "test.status")
+	t.Cleanup(s.Stop)
+	return s
+}
+
+type nullWriter struct{}
+
+func (nullWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func taskStatus(s *Supervisor, name string) TaskStatus {
+	for _, status := range s.Status() {
+		if status.Name == name {
+			return status
+		}
+	}
+	return TaskStatus{}
+}
+
+func TestSupervisorRestartsFailingTask(t *testing.T) {
+	s := testSupervisor(t)
+
+	// fails three times, then runs until stopped
+	var runs int32
+	err := s.Go("flaky", func(stop <-chan struct{}) error {
+		if n := atomic.AddInt32(&runs, 1); n <= 3 {
+			return errors.New("broken")
+		}
+		<-stop
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "fourth run", func() bool { return atomic.LoadInt32(&runs) == 4 })
+	waitFor(t, "running state", func() bool { return taskStatus(s, "flaky").State == TaskRunning })
+
+	status := taskStatus(s, "flaky")
+	if status.Restarts != 3 {
+		t.Errorf("restarts = %d, want 3", status.Restarts)
+	}
+	if status.LastError != "broken" || status.ErrorTime.IsZero() {
+		t.Errorf("last error = %q at %s", status.LastError, status.ErrorTime)
+	}
+
+	if err := s.Go("flaky", func(<-chan struct{}) error { return nil }); err == nil {
+		t.Error("started a task which was already running")
+	}
+
+	list, err := readStatusFile(s.StatusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Restarts != 3 {
+		t.Errorf("status file = %+v", list)
+	}
+
+	s.Stop()
+	if got := taskStatus(s, "flaky").State; got != TaskStopped {
+		t.Errorf("state after stop = %s", got)
+	}
+}
+
+func TestSupervisorRecoversPanics(t *testing.T) {
+	s := testSupervisor(t)
+
+	var runs int32
+	_ = s.Go("panicky", func(stop <-chan struct{}) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			panic("oh no")
+		}
+		<-stop
+		return nil
+	})
+
+	waitFor(t, "restart", func() bool { return taskStatus(s, "panicky").Restarts == 1 })
+	if got := taskStatus(s, "panicky").LastError; got != "panic: oh no" {
+		t.Errorf("last error = %q", got)
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	s := testSupervisor(t)
+	s.MinBackoff = 10 * time.Millisecond
+	s.MaxBackoff = 40 * time.Millisecond
+	s.ResetAfter = time.Hour
+
+	times := make(chan time.Time, 10)
+	_ = s.Go("failing", func(<-chan struct{}) error {
+		times <- time.Now()
+		return errors.New("always")
+	})
+
+	var starts []time.Time
+	for len(starts) < 5 {
+		select {
+		case at := <-times:
+			starts = append(starts, at)
+		case <-time.After(2 * time.Second):
+			t.Fatal("task not restarted")
+		}
+	}
+	s.StopTask("failing")
+
+	// waits of 10, 20, 40 and 40ms
+	want := []time.Duration{10, 20, 40, 40}
+	for i, w := range want {
+		gap := starts[i+1].Sub(starts[i])
+		if gap < w*time.Millisecond {
+			t.Errorf("restart %d after %s, want at least %dms", i+1, gap, w)
+		}
+	}
+
+	waitFor(t, "stop", func() bool { return !s.Running("failing") })
+}
+
+func TestSupervisorFinishedTask(t *testing.T) {
+	s := testSupervisor(t)
+
+	var runs int32
+	task := func(<-chan struct{}) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+	_ = s.Go("once", task)
+	waitFor(t, "finish", func() bool { return !s.Running("once") })
+
+	if got := taskStatus(s, "once"); got.State != TaskStopped || got.Restarts != 0 {
+		t.Errorf("status = %+v", got)
+	}
+
+	// done tasks can be started again
+	if err := s.Go("once", task); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "second run", func() bool { return atomic.LoadInt32(&runs) == 2 })
+}
+
+func TestEntryTask(t *testing.T) {
+	s := testSupervisor(t)
+
+	var starts, stops int32
+	_ = s.Go("entry", EntryTask(func() (func() error, error) {
+		if atomic.AddInt32(&starts, 1) == 1 {
+			return nil, errors.New("port in use")
+		}
+		return func() error {
+			atomic.AddInt32(&stops, 1)
+			return nil
+		}, nil
+	}))
+
+	waitFor(t, "retry", func() bool { return atomic.LoadInt32(&starts) == 2 })
+	s.Stop()
+	if atomic.LoadInt32(&stops) != 1 {
+		t.Errorf("entry stopped %d times", stops)
+	}
+	if got := taskStatus(s, "entry").LastError; got != "port in use" {
+		t.Errorf("last error = %q", got)
+	}
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	s := testSupervisor(t)
+
+	var running, runs int32
+	task := func(stop <-chan struct{}) error {
+		if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+			return errors.New("two runs at once")
+		}
+		atomic.AddInt32(&runs, 1)
+		<-stop
+		atomic.StoreInt32(&running, 0)
+		return nil
+	}
+
+	// not running yet is just a start
+	if err := s.Restart("task", task); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "first run", func() bool { return atomic.LoadInt32(&runs) == 1 })
+
+	if err := s.Restart("task", task); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "second run", func() bool { return atomic.LoadInt32(&runs) == 2 })
+	if got := taskStatus(s, "task"); got.State != TaskRunning || got.LastError != "" {
+		t.Errorf("status = %+v", got)
+	}
+}
@@ -47,6 +47,40 @@ func ListZip(path string) ([]string, error) {
 	return files, nil
 }
 
+type zipFileReader struct {
+	io.ReadCloser
+	zr *zip.ReadCloser
+}
+
+func (z zipFileReader) Close() error {
+	z.ReadCloser.Close()
+	return z.zr.Close()
+}
+
+// OpenZipFile opens a file inside a zip, by a name as returned by ListZip.
+// The size is the file's uncompressed size.
+func OpenZipFile(path string, name string) (io.ReadCloser, int64, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			zr.Close()
+			return nil, 0, err
+		}
+		return zipFileReader{rc, zr}, int64(f.UncompressedSize64), nil
+	}
+
+	zr.Close()
+	return nil, 0, fmt.Errorf("file not found in zip: %s", name)
+}
+
 func CopyFile(sourcePath, destPath string) error {
 	inputFile, err := os.Open(sourcePath)
 	if err != nil {
@@ -85,6 +119,46 @@ func MoveFile(sourcePath, destPath string) error {
 	return nil
 }
 
+// WriteFileAtomic writes a file so it's never left half written, even if the
+// power is cut. The data goes to a temporary file in the same folder, which
+// is synced to disk and then renamed over the original. Filesystems which
+// can't set perm, like the exFAT SD card, keep their own permissions.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp makes the file 0600. On exFAT the mode comes from the mount
+	// and chmod fails with EPERM, so the error is ignored.
+	_ = os.Chmod(tmpPath, perm)
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// make the rename itself durable
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
 // Max returns the highest value in a slice.
 func Max[T constraints.Ordered](xs []T) T {
 	if len(xs) == 0 {
@@ -272,6 +346,11 @@ func RemoveEmptyDirs(path string) error {
 		}
 	}
 
+	// the walk includes path, so it may already be gone
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
 	rootEmpty, err := IsEmptyDir(path)
 	if err != nil {
 		return err
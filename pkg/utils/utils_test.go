@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -40,6 +41,22 @@ func TestListZip(t *testing.T) {
 	}
 }
 
+func TestOpenZipFile(t *testing.T) {
+	rc, size, err := OpenZipFile("testdata/test.zip", "f2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 0 {
+		t.Errorf("got size %d, want 0", size)
+	}
+	if err := rc.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := OpenZipFile("testdata/test.zip", "f9"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
 func TestMoveFile(t *testing.T) {
 	orig_path := "testdata/test_file"
 	dest_path := "testdata/test_file_moved"
@@ -66,6 +83,25 @@ func TestMoveFile(t *testing.T) {
 	}
 }
 
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "u-boot.txt")
+	for _, data := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != data {
+			t.Errorf("file = %q, want %q", got, data)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("file mode = %v, %v, want 0644", info.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
 func TestMax(t *testing.T) {
 	var tests = []struct {
 		xs   []int